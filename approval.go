@@ -0,0 +1,103 @@
+package instructor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolApproval is the decision of a ToolApprover on a tool call
+type ToolApproval struct {
+	// Deny skips the tool call, Message is sent back to the model as the error result
+	Deny    bool
+	Message string
+	// Arguments replaces the arguments of the tool call if not nil, either decoded or raw JSON
+	Arguments any
+}
+
+// ApproveTool approves the tool call as is
+func ApproveTool() ToolApproval {
+	return ToolApproval{}
+}
+
+// DenyTool denies the tool call, the message is fed back to the model as the error result
+func DenyTool(message string) ToolApproval {
+	return ToolApproval{Deny: true, Message: message}
+}
+
+// ModifyTool approves the tool call with the modified arguments
+func ModifyTool(args any) ToolApproval {
+	return ToolApproval{Arguments: args}
+}
+
+// ToolApprover is consulted before every MCP or local tool call, the call is denied if it returns an error
+type ToolApprover func(ctx context.Context, call *ToolCall) (ToolApproval, error)
+
+// PendingApproval is a tool call paused until the stream consumer resolves it
+type PendingApproval struct {
+	ToolCall *ToolCall
+	ch       chan ToolApproval
+	once     sync.Once
+}
+
+// Resolve resumes the stream with the approval, only the first resolution counts
+func (p *PendingApproval) Resolve(v ToolApproval) {
+	p.once.Do(func() {
+		p.ch <- v
+	})
+}
+
+func (p *PendingApproval) wait(ctx context.Context) (ToolApproval, error) {
+	select {
+	case <-ctx.Done():
+		return ToolApproval{}, ctx.Err()
+	case v := <-p.ch:
+		return v, nil
+	}
+}
+
+type approverKey struct{}
+
+// StreamApprovalContext returns the context in which the tool calls are sent to the stream as ToolApprovalStream
+// and paused until resolved, if WithStreamToolApproval is set
+func (i Options) StreamApprovalContext(ctx context.Context, ch chan<- StreamData) context.Context {
+	if !i.streamApproval {
+		return ctx
+	}
+	return context.WithValue(ctx, approverKey{}, ToolApprover(func(ctx context.Context, call *ToolCall) (ToolApproval, error) {
+		p := &PendingApproval{ToolCall: call, ch: make(chan ToolApproval, 1)}
+		select {
+		case <-ctx.Done():
+			return ToolApproval{}, ctx.Err()
+		case ch <- StreamData{Type: ToolApprovalStream, Approval: p}:
+		}
+		return p.wait(ctx)
+	}))
+}
+
+// approve consults the approver of the context, falling back to the one set by WithToolApprover,
+// the call gets an error result if it is denied
+func (i Options) approve(ctx context.Context, call *ToolCall) {
+	approver, _ := ctx.Value(approverKey{}).(ToolApprover)
+	if approver == nil {
+		approver = i.toolApprover
+	}
+	if approver == nil {
+		return
+	}
+	approval, err := approver(ctx, call)
+	switch {
+	case err != nil:
+		call.Result = mcp.NewToolResultError(fmt.Sprintf("tool approval error: %v", err))
+	case approval.Deny:
+		msg := approval.Message
+		if msg == "" {
+			msg = "tool call denied"
+		}
+		call.Result = mcp.NewToolResultError(msg)
+	case approval.Arguments != nil:
+		*call = NewToolCall(call.Request.Params.Name, approval.Arguments)
+	}
+}
@@ -0,0 +1,57 @@
+package instructor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Transcriber transcribes the audio to text for the providers which do not accept audio input
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio Audio) (string, error)
+}
+
+type TranscriberFunc func(ctx context.Context, audio Audio) (string, error)
+
+func (fn TranscriberFunc) Transcribe(ctx context.Context, audio Audio) (string, error) {
+	return fn(ctx, audio)
+}
+
+// ErrAudioNotSupported is returned if the provider does not accept the audio and no transcriber is set
+var ErrAudioNotSupported = errors.New("audio input is not supported by the provider, set WithTranscriber to transcribe it")
+
+// PrepareAudios replaces the audios of the message which the provider does not support with their transcripts,
+// the unsupported audios only referenced by ID, e.g. the audio replied by OpenAI, are dropped as they have no data to transcribe
+func (i Options) PrepareAudios(ctx context.Context, msg *Message, supported func(audio *Audio) bool) error {
+	if len(msg.Audios) == 0 {
+		return nil
+	}
+	audios := make([]Audio, 0, len(msg.Audios))
+	var texts []string
+	for _, v := range msg.Audios {
+		if supported(&v) {
+			audios = append(audios, v)
+			continue
+		}
+		if v.Data == "" {
+			continue
+		}
+		if i.transcriber == nil {
+			return fmt.Errorf("%w: %s audio", ErrAudioNotSupported, v.Format)
+		}
+		text, err := i.transcriber.Transcribe(ctx, v)
+		if err != nil {
+			return fmt.Errorf("transcribe audio: %w", err)
+		}
+		texts = append(texts, fmt.Sprintf("Transcript of the audio:\n%s", text))
+	}
+	msg.Audios = audios
+	if len(texts) > 0 {
+		if msg.Text != "" {
+			texts = append(texts, msg.Text)
+		}
+		msg.Text = strings.Join(texts, "\n\n")
+	}
+	return nil
+}
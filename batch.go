@@ -0,0 +1,310 @@
+package instructor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBatchWorkers      = 4
+	DefaultBatchRetryBackoff = time.Second
+)
+
+// BatchProgress is reported after every item of a batch is done
+type BatchProgress struct {
+	// Done is the number of the finished items, including the failed ones
+	Done   int
+	Failed int
+	Total  int
+	Usage  UsageSum
+}
+
+type batchOptions struct {
+	workers           int
+	requestsPerMinute int
+	tokensPerMinute   int
+	tokenizer         Tokenizer
+	retries           int
+	backoff           time.Duration
+	progress          func(BatchProgress)
+}
+
+type BatchOption func(o *batchOptions)
+
+// WithBatchWorkers sets the number of requests sent concurrently
+func WithBatchWorkers(n int) BatchOption {
+	return func(o *batchOptions) {
+		o.workers = n
+	}
+}
+
+// WithBatchRequestsPerMinute limits the requests sent per minute
+func WithBatchRequestsPerMinute(n int) BatchOption {
+	return func(o *batchOptions) {
+		o.requestsPerMinute = n
+	}
+}
+
+// WithBatchTokensPerMinute limits the tokens used per minute, the tokens of a request are estimated with the tokenizer
+// before sending it and corrected by the usage of the response
+func WithBatchTokensPerMinute(n int, t Tokenizer) BatchOption {
+	return func(o *batchOptions) {
+		o.tokensPerMinute = n
+		o.tokenizer = t
+	}
+}
+
+// WithBatchRetries retries an item failed with a transient error, e.g. a rate limit, a server error or a timeout,
+// up to n times waiting backoff doubled on every attempt
+func WithBatchRetries(n int, backoff time.Duration) BatchOption {
+	return func(o *batchOptions) {
+		o.retries = n
+		o.backoff = backoff
+	}
+}
+
+// WithBatchProgress sets the callback called after every item is done, the calls are serialized
+func WithBatchProgress(fn func(BatchProgress)) BatchOption {
+	return func(o *batchOptions) {
+		o.progress = fn
+	}
+}
+
+// BatchItem is the result of a request of the batch
+type BatchItem[T any] struct {
+	// Index is the index of the request
+	Index    int
+	Value    T
+	Err      error
+	Attempts int
+	Usage    UsageSum
+}
+
+// BatchResult holds the results of the requests in the order of the requests
+type BatchResult[T any] struct {
+	Items     []BatchItem[T]
+	Succeeded int
+	Failed    int
+	// Usage is the usage summed up over every attempt of the items
+	Usage UsageSum
+}
+
+// Err joins the errors of the failed items
+func (r *BatchResult[T]) Err() error {
+	var errs []error
+	for _, v := range r.Items {
+		if v.Err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", v.Index, v.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Batch extracts T from every request through a pool of workers, a failed item does not stop the batch.
+// The returned error is only set if the context is done before every item is processed,
+// the items not processed then fail with the error of the context
+func Batch[T any, REQ any, RESP any](ctx context.Context, i ChatInstructor[REQ, RESP], requests []*REQ, opts ...BatchOption) (*BatchResult[T], error) {
+	o := batchOptions{
+		workers: DefaultBatchWorkers,
+		backoff: DefaultBatchRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.tokenizer == nil {
+		o.tokenizer = DefaultTokenizer
+	}
+	transient := IsTransientError
+	if c, ok := any(i).(TransientErrorChecker); ok {
+		transient = c.IsTransientError
+	}
+	var (
+		ret = &BatchResult[T]{Items: make([]BatchItem[T], len(requests))}
+		rpm = newTokenBucket(o.requestsPerMinute)
+		tpm = newTokenBucket(o.tokensPerMinute)
+		mu  sync.Mutex
+	)
+	process := func(idx int) {
+		item := &ret.Items[idx]
+		item.Index = idx
+		var estimated int
+		if tpm != nil {
+			bs, _ := json.Marshal(requests[idx])
+			estimated = o.tokenizer.Count(string(bs))
+		}
+		for attempt := 0; attempt <= o.retries; attempt++ {
+			if attempt > 0 {
+				if item.Err = sleepContext(ctx, o.backoff<<(attempt-1)); item.Err != nil {
+					break
+				}
+			}
+			if item.Err = rpm.wait(ctx, 1); item.Err != nil {
+				break
+			}
+			if item.Err = tpm.wait(ctx, estimated); item.Err != nil {
+				break
+			}
+			item.Attempts++
+			item.Value = *new(T)
+			var (
+				resp  = new(RESP)
+				usage UsageSum
+			)
+			item.Err = i.Chat(ctx, requests[idx], &item.Value, resp)
+			i.CountUsageFromResponse(resp, &usage)
+			item.Usage.Add(usage)
+			used := usage.TotalTokens
+			if used == 0 {
+				// some providers only report the input and the output tokens
+				used = usage.InputTokens + usage.OutputTokens
+			}
+			tpm.take(int(used) - estimated)
+			if item.Err == nil || ctx.Err() != nil || !transient(item.Err) {
+				break
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ret.Usage.Add(item.Usage)
+		if item.Err != nil {
+			item.Value = *new(T)
+			ret.Failed++
+		} else {
+			ret.Succeeded++
+		}
+		if o.progress != nil {
+			o.progress(BatchProgress{
+				Done:   ret.Succeeded + ret.Failed,
+				Failed: ret.Failed,
+				Total:  len(requests),
+				Usage:  ret.Usage,
+			})
+		}
+	}
+	if len(requests) == 0 {
+		return ret, nil
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(o.workers, len(requests))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				process(idx)
+			}
+		}()
+	}
+	var next int
+	for ; next < len(requests) && ctx.Err() == nil; next++ {
+		jobs <- next
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		for idx := next; idx < len(requests); idx++ {
+			ret.Items[idx] = BatchItem[T]{Index: idx, Err: err}
+			ret.Failed++
+		}
+		return ret, err
+	}
+	return ret, nil
+}
+
+// TransientErrorChecker is implemented by the instructors which tell the transient errors of their provider apart
+type TransientErrorChecker interface {
+	IsTransientError(err error) bool
+}
+
+// IsTransientStatus reports if a request failed with the HTTP status is worth retrying
+func IsTransientStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// IsTransientError reports if the error is a timeout or a dropped connection,
+// the errors of the providers are checked by their instructors implementing TransientErrorChecker
+func IsTransientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// tokenBucket allows perMinute tokens per minute with bursts up to perMinute, a nil bucket does not limit
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	// rate is the tokens refilled per second
+	rate float64
+	last time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait takes n tokens once available, n larger than the capacity is taken once the bucket is full
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		b.refill()
+		want := min(float64(n), b.capacity)
+		if b.tokens >= want {
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return nil
+		}
+		d := time.Duration((want - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		if err := sleepContext(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// take takes n tokens without waiting, a negative n gives the tokens back
+func (b *tokenBucket) take(n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = min(b.capacity, b.tokens-float64(n))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
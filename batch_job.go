@@ -0,0 +1,160 @@
+package instructor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBatchPollInterval is the interval between the status checks of WaitBatchJob
+const DefaultBatchPollInterval = 30 * time.Second
+
+// batchCustomIDPrefix prefixes the index of a request in the custom id sent to the provider
+const batchCustomIDPrefix = "request-"
+
+// ErrBatchJobNotDone is returned when fetching the results of a job which is still running
+var ErrBatchJobNotDone = errors.New("batch job is not done")
+
+// BatchJobStatus is the status of a provider batch job
+type BatchJobStatus string
+
+const (
+	BatchJobPending   BatchJobStatus = "pending"
+	BatchJobRunning   BatchJobStatus = "running"
+	BatchJobCompleted BatchJobStatus = "completed"
+	BatchJobFailed    BatchJobStatus = "failed"
+	BatchJobCanceled  BatchJobStatus = "canceled"
+	BatchJobExpired   BatchJobStatus = "expired"
+)
+
+// Done returns true if the job will not change anymore
+func (s BatchJobStatus) Done() bool {
+	switch s {
+	case BatchJobCompleted, BatchJobFailed, BatchJobCanceled, BatchJobExpired:
+		return true
+	}
+	return false
+}
+
+// BatchJob is a job submitted to the asynchronous batch API of a provider, it can be stored to fetch the results later by ID
+type BatchJob struct {
+	ID       string         `json:"id"`
+	Provider Provider       `json:"provider"`
+	Status   BatchJobStatus `json:"status"`
+	// Total is the number of the requests of the job
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Error is the reason of a failed job
+	Error string `json:"error,omitempty"`
+}
+
+// BatchJobResult is the raw output of a request of a job
+type BatchJobResult struct {
+	// Index is the index of the request in the submitted requests
+	Index int
+	Text  string
+	Usage UsageSum
+	Err   error
+}
+
+// BatchJobInstructor is implemented by the instructors of the providers offering an asynchronous batch API
+type BatchJobInstructor[REQ any] interface {
+	Instructor
+	// SubmitBatchJob applies the schema and the tools of the mode for responseType to the requests and submits them as a single job
+	SubmitBatchJob(ctx context.Context, requests []*REQ, responseType any) (*BatchJob, error)
+	RetrieveBatchJob(ctx context.Context, id string) (*BatchJob, error)
+	CancelBatchJob(ctx context.Context, id string) error
+	// BatchJobResults returns the raw outputs of the requests of a done job in any order
+	BatchJobResults(ctx context.Context, id string) ([]BatchJobResult, error)
+	// DecodeBatchJobResult decodes and validates the output of a request into responseType
+	DecodeBatchJobResult(text string, responseType any) error
+}
+
+// BatchCustomID returns the custom id of the request at idx which matches the results back to the requests
+func BatchCustomID(idx int) string {
+	return batchCustomIDPrefix + strconv.Itoa(idx)
+}
+
+// ParseBatchCustomID returns the index of the request of the custom id
+func ParseBatchCustomID(id string) (int, error) {
+	idx, err := strconv.Atoi(strings.TrimPrefix(id, batchCustomIDPrefix))
+	if err != nil || idx < 0 || !strings.HasPrefix(id, batchCustomIDPrefix) {
+		return 0, fmt.Errorf("invalid batch custom id: %s", id)
+	}
+	return idx, nil
+}
+
+// SubmitBatchJob submits the requests extracting T as a provider batch job
+func SubmitBatchJob[T any, REQ any](ctx context.Context, i BatchJobInstructor[REQ], requests []*REQ) (*BatchJob, error) {
+	return i.SubmitBatchJob(ctx, requests, new(T))
+}
+
+// WaitBatchJob polls the job every interval until it is done, DefaultBatchPollInterval is used if interval is not positive
+func WaitBatchJob[REQ any](ctx context.Context, i BatchJobInstructor[REQ], id string, interval time.Duration) (*BatchJob, error) {
+	if interval <= 0 {
+		interval = DefaultBatchPollInterval
+	}
+	for {
+		job, err := i.RetrieveBatchJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status.Done() {
+			return job, nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return job, err
+		}
+	}
+}
+
+// DecodeBatchJob fetches the results of the done job and decodes them into T in the order of the requests,
+// the requests without a result, e.g. of a canceled job, fail. If the total of the job is known,
+// the results out of the requests of the job are skipped and returned as the error along with the decoded result
+func DecodeBatchJob[T any, REQ any](ctx context.Context, i BatchJobInstructor[REQ], job *BatchJob) (*BatchResult[T], error) {
+	if !job.Status.Done() {
+		return nil, ErrBatchJobNotDone
+	}
+	results, err := i.BatchJobResults(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	total := job.Total
+	if total <= 0 {
+		for _, v := range results {
+			total = max(total, v.Index+1)
+		}
+	}
+	ret := &BatchResult[T]{Items: make([]BatchItem[T], total)}
+	for idx := range ret.Items {
+		ret.Items[idx] = BatchItem[T]{Index: idx, Err: fmt.Errorf("no result of the batch job %s", job.Status)}
+	}
+	var errs []error
+	for _, v := range results {
+		if v.Index < 0 || v.Index >= total {
+			errs = append(errs, fmt.Errorf("result %d out of the %d requests of the batch job %s", v.Index, total, job.ID))
+			continue
+		}
+		item := &ret.Items[v.Index]
+		item.Err, item.Attempts, item.Usage = v.Err, 1, v.Usage
+		if item.Err == nil {
+			item.Err = i.DecodeBatchJobResult(v.Text, &item.Value)
+		}
+		if item.Err != nil {
+			item.Value = *new(T)
+		}
+		ret.Usage.Add(v.Usage)
+	}
+	for _, v := range ret.Items {
+		if v.Err != nil {
+			ret.Failed++
+		} else {
+			ret.Succeeded++
+		}
+	}
+	return ret, errors.Join(errs...)
+}
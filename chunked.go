@@ -0,0 +1,325 @@
+package instructor
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultChunkTokens   = 2000
+	DefaultChunkOverlap  = 200
+	DefaultChunkWorkers  = 4
+	chunkParagraphSuffix = "\n\n"
+)
+
+var textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+// MergeFunc merges the results extracted from the chunks in the order of the chunks
+type MergeFunc[T any] func(results []T) (T, error)
+
+type chunkOptions struct {
+	tokens    int
+	overlap   int
+	tokenizer Tokenizer
+	workers   int
+}
+
+type ChunkOption func(o *chunkOptions)
+
+// WithChunkTokens sets the max tokens of a chunk
+func WithChunkTokens(n int) ChunkOption {
+	return func(o *chunkOptions) {
+		o.tokens = n
+	}
+}
+
+// WithChunkOverlap sets the tokens of the end of a chunk which are repeated at the beginning of the next chunk
+func WithChunkOverlap(n int) ChunkOption {
+	return func(o *chunkOptions) {
+		o.overlap = n
+	}
+}
+
+// WithChunkTokenizer sets the tokenizer counting the tokens of the chunks, DefaultTokenizer is used by default
+func WithChunkTokenizer(t Tokenizer) ChunkOption {
+	return func(o *chunkOptions) {
+		o.tokenizer = t
+	}
+}
+
+// WithChunkWorkers sets the number of chunks extracted concurrently
+func WithChunkWorkers(n int) ChunkOption {
+	return func(o *chunkOptions) {
+		o.workers = n
+	}
+}
+
+// ChunkedResult is the merged result of a chunked extraction
+type ChunkedResult[T any] struct {
+	Value T
+	// Chunks is the number of chunks the text was split into
+	Chunks int
+	// Usage is the usage summed up over the chunks
+	Usage UsageSum
+}
+
+// ChunkedExtractor extracts T from a long text by extracting every chunk of the text and merging the results
+type ChunkedExtractor[T any, REQ any, RESP any] struct {
+	inst       ChatInstructor[REQ, RESP]
+	newRequest func(chunk string) *REQ
+	merge      MergeFunc[T]
+	opts       chunkOptions
+}
+
+// NewChunkedExtractor creates the extractor, newRequest builds the provider request from a chunk
+// and DefaultMerge is used if merge is nil
+func NewChunkedExtractor[T any, REQ any, RESP any](i ChatInstructor[REQ, RESP], newRequest func(chunk string) *REQ, merge MergeFunc[T], opts ...ChunkOption) *ChunkedExtractor[T, REQ, RESP] {
+	e := &ChunkedExtractor[T, REQ, RESP]{
+		inst:       i,
+		newRequest: newRequest,
+		merge:      merge,
+		opts: chunkOptions{
+			tokens:    DefaultChunkTokens,
+			overlap:   DefaultChunkOverlap,
+			tokenizer: DefaultTokenizer,
+			workers:   DefaultChunkWorkers,
+		},
+	}
+	if e.merge == nil {
+		e.merge = DefaultMerge[T]
+	}
+	for _, opt := range opts {
+		opt(&e.opts)
+	}
+	return e
+}
+
+// Extract splits the text and extracts the chunks concurrently, the extraction stops at the first chunk which fails
+func (e *ChunkedExtractor[T, REQ, RESP]) Extract(ctx context.Context, text string) (*ChunkedResult[T], error) {
+	chunks := SplitText(text, e.opts.tokens, e.opts.overlap, e.opts.tokenizer)
+	ret := &ChunkedResult[T]{Chunks: len(chunks)}
+	if len(chunks) == 0 {
+		return ret, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		results = make([]T, len(chunks))
+		mu      sync.Mutex
+		errs    []error
+	)
+	extract := func(idx int) {
+		resp := new(RESP)
+		err := e.inst.Chat(ctx, e.newRequest(chunks[idx]), &results[idx], resp)
+		mu.Lock()
+		defer mu.Unlock()
+		e.inst.CountUsageFromResponse(resp, &ret.Usage)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chunk %d: %w", idx, err))
+			cancel()
+		}
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(e.opts.workers, len(chunks))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				extract(idx)
+			}
+		}()
+	}
+	for idx := range chunks {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+	if len(errs) > 0 {
+		return ret, errors.Join(errs...)
+	}
+	value, err := e.merge(results)
+	if err != nil {
+		return ret, fmt.Errorf("merge chunks: %w", err)
+	}
+	ret.Value = value
+	return ret, nil
+}
+
+// SplitText splits the text into chunks of at most maxTokens by paragraphs, the paragraphs longer than maxTokens
+// are split by lines and words. The last paragraphs of a chunk within overlap tokens are repeated in the next chunk,
+// DefaultTokenizer is used if t is nil
+func SplitText(text string, maxTokens int, overlap int, t Tokenizer) []string {
+	if t == nil {
+		t = DefaultTokenizer
+	}
+	counter := t.Count
+	var units []string
+	for _, p := range strings.Split(text, chunkParagraphSuffix) {
+		if p = strings.TrimSpace(p); p != "" {
+			units = append(units, splitUnit(p, maxTokens, counter)...)
+		}
+	}
+	var (
+		chunks  []string
+		current []string
+		tokens  int
+	)
+	for _, unit := range units {
+		n := counter(unit)
+		if len(current) > 0 && tokens+n > maxTokens {
+			chunks = append(chunks, strings.Join(current, chunkParagraphSuffix))
+			// carry over the tail of the chunk within the overlap
+			var (
+				tail       []string
+				tailTokens int
+			)
+			for i := len(current) - 1; i >= 0; i-- {
+				m := counter(current[i])
+				if tailTokens+m > overlap || tailTokens+m+n > maxTokens {
+					break
+				}
+				tail = append([]string{current[i]}, tail...)
+				tailTokens += m
+			}
+			current, tokens = tail, tailTokens
+		}
+		current = append(current, unit)
+		tokens += n
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, chunkParagraphSuffix))
+	}
+	return chunks
+}
+
+// splitUnit splits the paragraph by lines, then by words, until every piece is within maxTokens
+func splitUnit(p string, maxTokens int, counter func(text string) int) []string {
+	if maxTokens <= 0 || counter(p) <= maxTokens {
+		return []string{p}
+	}
+	sep := "\n"
+	parts := strings.Split(p, sep)
+	if len(parts) == 1 {
+		sep = " "
+		parts = strings.Fields(p)
+	}
+	if len(parts) == 1 {
+		return parts
+	}
+	var (
+		ret     []string
+		current []string
+	)
+	for _, part := range parts {
+		candidate := strings.Join(append(current, part), sep)
+		if len(current) > 0 && counter(candidate) > maxTokens {
+			ret = append(ret, splitUnit(strings.Join(current, sep), maxTokens, counter)...)
+			current = current[:0]
+		}
+		current = append(current, part)
+	}
+	if len(current) > 0 {
+		ret = append(ret, splitUnit(strings.Join(current, sep), maxTokens, counter)...)
+	}
+	return ret
+}
+
+// DefaultMerge merges the results by concatenating the slices without the items of the earlier results, merging the maps and
+// the nested structs, and keeping the first non-zero value of the other fields, e.g. time.Time
+func DefaultMerge[T any](results []T) (T, error) {
+	var ret T
+	dst := reflect.ValueOf(&ret).Elem()
+	for _, v := range results {
+		mergeValue(dst, reflect.ValueOf(v))
+	}
+	return ret, nil
+}
+
+func mergeValue(dst reflect.Value, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeSlice(dst.Type(), 0, src.Len()))
+		}
+		// only the items of the earlier results are duplicates, the repeated items of a result are kept
+		merged := dst.Slice(0, dst.Len())
+		for i := range src.Len() {
+			item := src.Index(i)
+			if !containsValue(merged, item) {
+				dst.Set(reflect.Append(dst, item))
+			}
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			if !dst.MapIndex(iter.Key()).IsValid() {
+				dst.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+	case reflect.Struct:
+		if isScalarStruct(dst.Type()) {
+			if dst.IsZero() {
+				dst.Set(src)
+			}
+			return
+		}
+		for i := range dst.NumField() {
+			if dst.Type().Field(i).IsExported() {
+				mergeValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		mergeValue(dst.Elem(), src.Elem())
+	default:
+		if dst.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+// isScalarStruct reports whether the struct is merged as a whole, e.g. time.Time,
+// which is the case of the text marshalers and the structs without exported fields
+func isScalarStruct(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return true
+	}
+	for i := range t.NumField() {
+		if t.Field(i).IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+func containsValue(list reflect.Value, item reflect.Value) bool {
+	for i := range list.Len() {
+		if reflect.DeepEqual(list.Index(i).Interface(), item.Interface()) {
+			return true
+		}
+	}
+	return false
+}
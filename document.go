@@ -0,0 +1,183 @@
+package instructor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/ledongthuc/pdf"
+)
+
+// FileFromPath reads the local file, the MIME type is detected from the content
+func FileFromPath(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	return FileFromReader(filepath.Base(path), f)
+}
+
+// FileFromReader reads the file of the name from the reader, the size is limited by DefaultMediaMaxBytes
+func FileFromReader(name string, r io.Reader) (File, error) {
+	data, err := readLimited(r, DefaultMediaMaxBytes)
+	if err != nil {
+		return File{}, fmt.Errorf("read file %s: %w", name, err)
+	}
+	return File{
+		Name:     name,
+		Data:     base64.StdEncoding.EncodeToString(data),
+		MimeType: detectMimeType(data, name),
+	}, nil
+}
+
+// NewFileMessage creates the message with the files, the images, audios and videos are attached as such
+// and the other files, e.g. PDF or text, as documents
+func NewFileMessage(role Role, text string, files ...File) Message {
+	msg := Message{Role: role, Text: text}
+	for _, v := range files {
+		kind, format, _ := strings.Cut(v.MimeType, "/")
+		switch kind {
+		case "image":
+			msg.Images = append(msg.Images, Image{URL: fmt.Sprintf("data:%s;base64,%s", v.MimeType, v.Data)})
+		case "video":
+			msg.Videos = append(msg.Videos, Video{URL: fmt.Sprintf("data:%s;base64,%s", v.MimeType, v.Data)})
+		case "audio":
+			msg.Audios = append(msg.Audios, Audio{Data: v.Data, Format: strings.TrimPrefix(format, "x-")})
+		default:
+			msg.Files = append(msg.Files, v)
+		}
+	}
+	return msg
+}
+
+// MessageFromPaths creates the message with the local files
+func MessageFromPaths(role Role, text string, paths ...string) (Message, error) {
+	files := make([]File, 0, len(paths))
+	for _, path := range paths {
+		f, err := FileFromPath(path)
+		if err != nil {
+			return Message{}, err
+		}
+		files = append(files, f)
+	}
+	return NewFileMessage(role, text, files...), nil
+}
+
+// DocumentConverter converts a document the provider does not support natively,
+// the text and images of the returned message are attached in place of the document, e.g. the extracted text or the page images
+type DocumentConverter func(ctx context.Context, file File) (Message, error)
+
+// ExtractPDFText is the default DocumentConverter of the PDF documents, it extracts the text layer of the pages.
+// The scanned PDFs without a text layer have no text, they need a converter rendering the pages as images
+func ExtractPDFText(ctx context.Context, file File) (Message, error) {
+	data, err := base64.StdEncoding.DecodeString(file.Data)
+	if err != nil {
+		return Message{}, err
+	}
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := r.GetPlainText()
+	if err != nil {
+		return Message{}, err
+	}
+	bs, err := io.ReadAll(text)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(bytes.TrimSpace(bs)) == 0 {
+		return Message{}, fmt.Errorf("no text layer in the PDF %s", file.Name)
+	}
+	return Message{Text: string(bs)}, nil
+}
+
+// PrepareDocuments replaces the documents of the message which the provider does not support with their text,
+// the text documents are inlined and the PDF documents are converted by ExtractPDFText unless a converter is set WithDocumentConverter.
+// The other binary documents, e.g. DOCX, fail without a converter
+func (i Options) PrepareDocuments(ctx context.Context, msg *Message, supported func(mimeType string) bool) error {
+	if len(msg.Files) == 0 {
+		return nil
+	}
+	files := make([]File, 0, len(msg.Files))
+	var texts []string
+	for _, v := range msg.Files {
+		mimeType := v.MimeType
+		if mimeType == "" && v.Data != "" {
+			if data, err := base64.StdEncoding.DecodeString(v.Data); err == nil {
+				mimeType = detectMimeType(data, v.Name)
+			}
+		}
+		if v.Data == "" || supported(mimeType) {
+			files = append(files, v)
+			continue
+		}
+		if IsTextMimeType(mimeType) {
+			data, err := base64.StdEncoding.DecodeString(v.Data)
+			if err != nil {
+				return fmt.Errorf("decode file %s: %w", v.Name, err)
+			}
+			texts = append(texts, fmt.Sprintf("File %s:\n%s", v.Name, data))
+			continue
+		}
+		conv := i.documentConv
+		if conv == nil && mimeType == "application/pdf" {
+			conv = ExtractPDFText
+		}
+		if conv == nil {
+			return fmt.Errorf("unsupported document %s of type %s", v.Name, mimeType)
+		}
+		v.MimeType = mimeType
+		converted, err := conv(ctx, v)
+		if err != nil {
+			return fmt.Errorf("convert document %s: %w", v.Name, err)
+		}
+		if converted.Text != "" {
+			texts = append(texts, fmt.Sprintf("File %s:\n%s", v.Name, converted.Text))
+		}
+		msg.Images = append(slices.Clip(msg.Images), converted.Images...)
+	}
+	msg.Files = files
+	if len(texts) > 0 {
+		if msg.Text != "" {
+			texts = append(texts, msg.Text)
+		}
+		msg.Text = strings.Join(texts, "\n\n")
+	}
+	return nil
+}
+
+// IsTextMimeType reports if the documents of the MIME type could be inlined as text
+func IsTextMimeType(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"),
+		mimeType == "application/json",
+		mimeType == "application/xml",
+		mimeType == "application/x-yaml",
+		mimeType == "application/yaml":
+		return true
+	}
+	return false
+}
+
+// detectMimeType detects the MIME type from the content, falling back to the extension of the name for the plain text
+func detectMimeType(data []byte, name string) string {
+	detected := mimetype.Detect(data)
+	if detected.Is("text/plain") {
+		if byExt := mime.TypeByExtension(filepath.Ext(name)); byExt != "" {
+			byExt, _, _ = strings.Cut(byExt, ";")
+			return byExt
+		}
+	}
+	mimeType, _, _ := strings.Cut(detected.String(), ";")
+	return mimeType
+}
@@ -26,15 +26,7 @@ type StreamEncoder struct {
 
 func NewStreamEncoder(req any, validate bool, namer instructor.SchemaNamer) (*StreamEncoder, error) {
 	t := reflect.TypeOf(req)
-	streamWrapperType := reflect.StructOf([]reflect.StructField{
-		{
-			Name:      "Items",
-			Type:      reflect.SliceOf(t),
-			Tag:       `json:"items"`,
-			Anonymous: false,
-		},
-	})
-	schema, err := instructor.NewSchema(streamWrapperType, namer)
+	schema, err := instructor.NewSchema(instructor.ListWrapperType(t), namer)
 	if err != nil {
 		return nil, err
 	}
@@ -15,7 +15,7 @@ func TestYaml(t *testing.T) {
 		Name       string    `yaml:"name" comment:"这里是姓名字段" jsonschema:"description=用户的名字" fake:"Syd Xu"`
 		Age        *int      `yaml:"age" jsonschema:"description=用户的年龄" fake:"24"`
 		Details    *Details  `yaml:"details" jsonschema:"description=附加的详细信息"`
-		DetailList []Details `yaml:"details" jsonschema:"description=附加的详细信息数组" fakesize="2"`
+		DetailList []Details `yaml:"details" jsonschema:"description=附加的详细信息数组" fakesize:"2"`
 	}
 	var p Person
 	enc := NewEncoder(p).WithCommentStyle(LineComment)
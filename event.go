@@ -0,0 +1,219 @@
+package instructor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+)
+
+// Event is a typed streaming event, one of Item[T], ContentDelta, ThinkingDelta, *ToolCall, *PendingApproval, Usage, Done or Error
+type Event interface {
+	isEvent()
+}
+
+// Item is a response item parsed from the stream
+type Item[T any] struct {
+	Value *T
+}
+
+// ContentDelta is a chunk of the model's response text
+type ContentDelta struct {
+	Text string
+}
+
+// ThinkingDelta is a chunk of the model's reasoning text
+type ThinkingDelta struct {
+	Text string
+}
+
+// Usage is the token usage of the whole stream, emitted once before Done
+type Usage struct {
+	UsageSum
+}
+
+// Done is the last event of a stream with the final response metadata
+type Done struct {
+	ResponseMeta
+}
+
+// Error is a stream error, Raw keeps the item which failed to decode or validate if any
+type Error struct {
+	Err error
+	Raw json.RawMessage
+}
+
+func (e Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+func (Item[T]) isEvent()          {}
+func (ContentDelta) isEvent()     {}
+func (ThinkingDelta) isEvent()    {}
+func (*ToolCall) isEvent()        {}
+func (*PendingApproval) isEvent() {}
+func (Usage) isEvent()            {}
+func (Done) isEvent()             {}
+func (Error) isEvent()            {}
+
+// UsageCounter is implemented by the instructors to sum up the usage of a response
+type UsageCounter[RESP any] interface {
+	CountUsageFromResponse(response *RESP, usage *UsageSum)
+}
+
+// Event converts the stream data to a typed event
+func (d StreamData) Event() Event {
+	switch d.Type {
+	case ContentStream:
+		return ContentDelta{Text: d.Content}
+	case ThinkingStream:
+		return ThinkingDelta{Text: d.Content}
+	case ToolCallStream:
+		if d.ToolCall == nil {
+			return nil
+		}
+		return d.ToolCall
+	case ToolApprovalStream:
+		if d.Approval == nil {
+			return nil
+		}
+		return d.Approval
+	case ErrorStream, ValidationErrorStream:
+		return Error{Err: d.Err, Raw: d.Raw}
+	case DoneStream:
+		if d.Meta == nil {
+			return Done{}
+		}
+		return Done{ResponseMeta: *d.Meta}
+	}
+	return nil
+}
+
+// SchemaStreamEvents streams the items of T extracted by the instructor together with the content, thinking,
+// tool call and usage events in a single sequence.
+// Breaking out of the loop cancels the request and releases the underlying goroutines.
+func SchemaStreamEvents[T any, REQ any, RESP any](ctx context.Context, i SchemaStreamInstructor[REQ, RESP], request *REQ, response *RESP) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if response == nil {
+			response = new(RESP)
+		}
+		var zero T
+		itemCh, dataCh, err := i.SchemaStream(ctx, request, zero, response)
+		if err != nil {
+			yield(Error{Err: err}, err)
+			return
+		}
+		defer drain(itemCh, dataCh)
+		var done *Done
+		for itemCh != nil || dataCh != nil {
+			var ev Event
+			select {
+			case v, ok := <-itemCh:
+				if !ok {
+					itemCh = nil
+					continue
+				}
+				switch item := v.(type) {
+				case *T:
+					ev = Item[T]{Value: item}
+				case T:
+					ev = Item[T]{Value: &item}
+				default:
+					ev = Error{Err: fmt.Errorf("unexpected item type %T", v)}
+				}
+			case v, ok := <-dataCh:
+				if !ok {
+					dataCh = nil
+					continue
+				}
+				if ev = v.Event(); ev == nil {
+					continue
+				}
+			}
+			if v, ok := ev.(Done); ok {
+				done = &v
+				continue
+			}
+			if !yieldEvent(yield, ev) {
+				return
+			}
+		}
+		finishEvents(i, response, done, yield)
+	}
+}
+
+// StreamEvents streams the response of the instructor as content, thinking, tool call and usage events.
+// Breaking out of the loop cancels the request and releases the underlying goroutines.
+func StreamEvents[REQ any, RESP any](ctx context.Context, i StreamInstructor[REQ, RESP], request *REQ, responseType any, response *RESP) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		if response == nil {
+			response = new(RESP)
+		}
+		dataCh, err := i.Stream(ctx, request, responseType, response)
+		if err != nil {
+			yield(Error{Err: err}, err)
+			return
+		}
+		defer drain[any](nil, dataCh)
+		var done *Done
+		for v := range dataCh {
+			ev := v.Event()
+			if ev == nil {
+				continue
+			}
+			if v, ok := ev.(Done); ok {
+				done = &v
+				continue
+			}
+			if !yieldEvent(yield, ev) {
+				return
+			}
+		}
+		finishEvents(i, response, done, yield)
+	}
+}
+
+func yieldEvent(yield func(Event, error) bool, ev Event) bool {
+	if e, ok := ev.(Error); ok {
+		return yield(e, e.Err)
+	}
+	return yield(ev, nil)
+}
+
+// finishEvents yields the Usage and Done events, falling back to the response usage for instructors which did not send DoneStream
+func finishEvents[RESP any](i any, response *RESP, done *Done, yield func(Event, error) bool) {
+	if done == nil {
+		done = new(Done)
+		if counter, ok := i.(UsageCounter[RESP]); ok {
+			counter.CountUsageFromResponse(response, &done.Usage)
+		}
+	}
+	if !yield(Usage{UsageSum: done.Usage}, nil) {
+		return
+	}
+	yield(*done, nil)
+}
+
+// drain consumes the remaining values so the producers are never blocked after the consumer stopped
+func drain[T any](itemCh <-chan T, dataCh <-chan StreamData) {
+	if itemCh != nil {
+		go func() {
+			for range itemCh {
+			}
+		}()
+	}
+	if dataCh != nil {
+		go func() {
+			for range dataCh {
+			}
+		}()
+	}
+}
@@ -18,6 +18,18 @@ func (c *MockMCPClient) Close() error {
 	return nil
 }
 
+func (c *MockMCPClient) Initialize(ctx context.Context, req mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	return &mcp.InitializeResult{
+		ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+		ServerInfo: mcp.Implementation{
+			Name:    "mock",
+			Version: "1.0.0",
+		},
+	}, nil
+}
+
+func (c *MockMCPClient) OnNotification(handler func(notification mcp.JSONRPCNotification)) {}
+
 func (c *MockMCPClient) ListTools(ctx context.Context, req mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
 	return &mcp.ListToolsResult{
 		Tools: []mcp.Tool{
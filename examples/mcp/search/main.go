@@ -24,41 +24,15 @@ func main() {
 		log.Fatalln(err)
 		return
 	}
-	// if err := mcpClt.Start(ctx); err != nil {
-	// 	log.Fatalf("Failed to start client: %v", err)
-	// }
-	// Initialize the client
-	fmt.Println("Initializing client...")
-	initRequest := mcp.InitializeRequest{}
-	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-	initRequest.Params.ClientInfo = mcp.Implementation{
+	registry := instructor.NewMCPRegistry(instructor.WithMCPClientInfo(mcp.Implementation{
 		Name:    "MCP-Go Client for instructor-go",
 		Version: "1.0.0",
-	}
-	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
-
-	serverInfo, err := mcpClt.Initialize(ctx, initRequest)
-	if err != nil {
-		log.Fatalf("Failed to initialize: %v", err)
-	}
-
-	// Display server information
-	fmt.Printf("Connected to server: %s (version %s)\n",
-		serverInfo.ServerInfo.Name,
-		serverInfo.ServerInfo.Version)
-	fmt.Printf("Server capabilities: %+v\n", serverInfo.Capabilities)
-	toolListResult, err := mcpClt.ListTools(ctx, mcp.ListToolsRequest{})
-	if err != nil {
-		log.Fatalln(err)
-		return
-	}
-	tools := make([]instructor.MCPTool, 0, len(toolListResult.Tools))
-	for _, v := range toolListResult.Tools {
-		tools = append(tools, instructor.MCPTool{
-			ServerName: serverInfo.ServerInfo.Name,
-			Client:     mcpClt,
-			Tool:       &v,
-		})
+	}))
+	defer registry.Close()
+	// the stdio client is started on creation, Register initializes it and lists the tools
+	fmt.Println("Initializing client...")
+	if err := registry.Register(ctx, "firecrawl", mcpClt); err != nil {
+		log.Fatalf("Failed to register: %v", err)
 	}
 
   clt := openai.NewClient(option.WithAPIKey(os.Getenv("OPENAI_API_KEY")), option.WithBaseURL(os.Getenv("OPENAI_BASE_URL")))
@@ -70,7 +44,7 @@ func main() {
 		instructor.WithExtraBody(map[string]any{
 			"enable_thinking": true,
 		}),
-		instructor.WithMCPTools(tools...),
+		instructor.WithMCPRegistry(registry),
 	)
 
 	var result string
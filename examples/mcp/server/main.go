@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+	"github.com/bububa/instructor-go/mcpserver"
+)
+
+type Input struct {
+	Text string `json:"text" jsonschema:"description=text containing the person"`
+}
+
+type Person struct {
+	Name string `json:"name" jsonschema:"title=the name,description=The name of the person" validate:"required"`
+	Age  int    `json:"age" jsonschema:"title=the age,description=The age of the person"`
+}
+
+func main() {
+	clt := openai.NewClient(option.WithAPIKey(os.Getenv("OPENAI_API_KEY")), option.WithBaseURL(os.Getenv("OPENAI_BASE_URL")))
+	client := instructors.FromOpenAI(
+		&clt,
+		instructor.WithMode(instructor.ModeJSON),
+		instructor.WithValidation(),
+		instructor.WithMaxRetries(3),
+	)
+	extractor, err := mcpserver.NewExtractor[Input, Person](
+		"extract_person",
+		"Extract the name and age of the person from the text",
+		"Extract the person from the following text:\n{{.Text}}",
+		client,
+		func(prompt string) *openai.ChatCompletionNewParams {
+			return &openai.ChatCompletionNewParams{
+				Model:    os.Getenv("OPENAI_MODEL"),
+				Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(prompt)},
+			}
+		},
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	srv := mcpserver.NewServer("extractors", "1.0.0", []*mcpserver.Extractor{extractor})
+	if addr := os.Getenv("MCP_HTTP_ADDR"); addr != "" {
+		log.Fatalln(srv.ListenAndServe(addr))
+	}
+	if err := srv.ServeStdio(); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"log"
 	"os"
 
-	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 
@@ -18,20 +17,12 @@ import (
 
 func main() {
 	ctx := context.Background()
-	mcpClt := new(mock.MockMCPClient)
-	toolListResult, err := mcpClt.ListTools(ctx, mcp.ListToolsRequest{})
-	if err != nil {
+	registry := instructor.NewMCPRegistry()
+	defer registry.Close()
+	if err := registry.Register(ctx, "mock", new(mock.MockMCPClient)); err != nil {
 		log.Fatalln(err)
 		return
 	}
-	tools := make([]instructor.MCPTool, 0, len(toolListResult.Tools))
-	for _, v := range toolListResult.Tools {
-		tools = append(tools, instructor.MCPTool{
-			ServerName: "mock",
-			Client:     mcpClt,
-			Tool:       &v,
-		})
-	}
 
   clt := openai.NewClient(option.WithAPIKey(os.Getenv("OPENAI_API_KEY")), option.WithBaseURL(os.Getenv("OPENAI_BASE_URL")))
 	client := instructors.FromOpenAI(
@@ -42,7 +33,7 @@ func main() {
 		instructor.WithExtraBody(map[string]any{
 			"enable_thinking": false,
 		}),
-		instructor.WithMCPTools(tools...),
+		instructor.WithMCPRegistry(registry),
 	)
 
 	var result string
@@ -79,7 +79,7 @@ Preferred Shopping Times: Weekend Evenings
 		productList += product.String() + "\n"
 	}
 
-	recommendationChan, ch, err := client.SchemaStream(ctx, &openai.ChatCompletionNewParams{
+	events := instructor.SchemaStreamEvents[Recommendation](ctx, client, &openai.ChatCompletionNewParams{
 		Model: os.Getenv("OPENAI_MODEL"),
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(fmt.Sprintf(`
@@ -91,41 +91,32 @@ Product list:
           * Do not show output instruction and schema in reasoning content!`, productList)),
 			openai.UserMessage(fmt.Sprintf("User profile:\n%s", profileData)),
 		},
-	},
-		Recommendation{},
-		nil,
-	)
-	if err != nil {
-		panic(err)
-	}
+	}, nil)
 
-	go func() {
-		var thinking bool
-		for item := range ch {
-			switch item.Type {
-			case instructor.ThinkingStream:
-				if !thinking {
-					fmt.Println("Thinking start...")
-				}
-				thinking = true
-				fmt.Print(item.Content)
-			case instructor.ContentStream:
-				if thinking {
-					fmt.Println("Thinking end!")
-				}
-				thinking = false
-				fmt.Print(item.Content)
-			case instructor.ErrorStream:
-				fmt.Println("ERROR:", item.Err)
-			case instructor.ToolCallStream:
-				continue
+	var thinking bool
+	for event, err := range events {
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			continue
+		}
+		switch ev := event.(type) {
+		case instructor.ThinkingDelta:
+			if !thinking {
+				fmt.Println("Thinking start...")
 			}
+			thinking = true
+			fmt.Print(ev.Text)
+		case instructor.ContentDelta:
+			if thinking {
+				fmt.Println("Thinking end!")
+			}
+			thinking = false
+			fmt.Print(ev.Text)
+		case instructor.Item[Recommendation]:
+			println(ev.Value.String())
+		case instructor.Usage:
+			fmt.Printf("Usage: %+v\n", ev.UsageSum)
 		}
-	}()
-
-	for instance := range recommendationChan {
-		recommendation, _ := instance.(*Recommendation)
-		println(recommendation.String())
 	}
 	/*
 		Recommendation [
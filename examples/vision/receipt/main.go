@@ -52,6 +52,11 @@ func (r *Receipt) Validate() error {
 }
 
 func extract(ctx context.Context, client instructor.ChatInstructor[openai.ChatCompletionNewParams, openai.ChatCompletion], url string) (*Receipt, error) {
+	// downscale the scan within the OpenAI limits and strip the EXIF before sending it inline
+	msg := instructor.Message{Role: instructor.UserRole, Images: []instructor.Image{{URL: url}}}
+	if err := instructor.PrepareImages(ctx, instructor.DefaultMediaLoader, &msg, instructor.ProviderImageOptions(instructor.ProviderOpenAI)); err != nil {
+		return nil, err
+	}
 	var receipt Receipt
 	err := client.Chat(
 		ctx,
@@ -61,7 +66,7 @@ func extract(ctx context.Context, client instructor.ChatInstructor[openai.ChatCo
 				openai.SystemMessage(`Analyze the image and return the items (include tax and coupons as their own items) in the receipt and the total amount.`),
 				openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
 					openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
-						URL: url,
+						URL: msg.Images[0].URL,
 					}),
 				}),
 			},
@@ -4,15 +4,18 @@ go 1.25.1
 
 require (
 	github.com/BurntSushi/toml v1.5.0
+	github.com/HugoSmits86/nativewebp v0.9.3
 	github.com/brianvoe/gofakeit/v7 v7.6.0
 	github.com/bububa/ljson v1.0.1
 	github.com/cohere-ai/cohere-go/v2 v2.15.3
 	github.com/gabriel-vasile/mimetype v1.4.10
 	github.com/go-playground/validator/v10 v10.27.0
 	github.com/invopop/jsonschema v0.13.0
+	github.com/ledongthuc/pdf v0.0.0-20260907135840-6c8c28e0e8a0
 	github.com/liushuangls/go-anthropic/v2 v2.15.2
 	github.com/mark3labs/mcp-go v0.39.1
 	github.com/openai/openai-go v1.12.0
+	golang.org/x/image v0.31.0
 	google.golang.org/api v0.249.0
 	google.golang.org/genai v1.24.0
 	gopkg.in/yaml.v3 v3.0.1
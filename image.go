@@ -0,0 +1,405 @@
+package instructor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+	_ "golang.org/x/image/webp"
+)
+
+type ImageFormat string
+
+// The WebP images are encoded lossless, so the quality is ignored
+const (
+	ImageJPEG ImageFormat = "jpeg"
+	ImagePNG  ImageFormat = "png"
+	ImageWebP ImageFormat = "webp"
+)
+
+// DefaultImageQuality is the JPEG quality used if the quality is not set
+const DefaultImageQuality = 85
+
+// MaxImagePixels bounds the width x height of the decoded images, the size is checked before decoding
+// so a small file with huge dimensions does not exhaust the memory
+const MaxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned if the image has more than MaxImagePixels pixels
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImageEncoder encodes the image, the quality is within [1, 100] and ignored by the lossless formats
+type ImageEncoder func(w io.Writer, img image.Image, quality int) error
+
+var (
+	imageEncodersMu sync.RWMutex
+	imageEncoders   = map[ImageFormat]ImageEncoder{
+		ImageJPEG: func(w io.Writer, img image.Image, quality int) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		},
+		ImagePNG: func(w io.Writer, img image.Image, _ int) error {
+			enc := png.Encoder{CompressionLevel: png.BestCompression}
+			return enc.Encode(w, img)
+		},
+		ImageWebP: func(w io.Writer, img image.Image, _ int) error {
+			return nativewebp.Encode(w, img, nil)
+		},
+	}
+)
+
+// RegisterImageEncoder registers the encoder of the format, e.g. a lossy WebP encoder
+func RegisterImageEncoder(format ImageFormat, enc ImageEncoder) {
+	imageEncodersMu.Lock()
+	defer imageEncodersMu.Unlock()
+	imageEncoders[format] = enc
+}
+
+// ImageOptions are the options of the image pipeline
+type ImageOptions struct {
+	// MaxWidth and MaxHeight bound the size of the image, the image is downscaled keeping the aspect ratio
+	MaxWidth  int
+	MaxHeight int
+	// Format is the format the image is encoded to, JPEG if empty
+	Format  ImageFormat
+	Quality int
+}
+
+// ProviderImageOptions returns the image options within the limits of the provider
+func ProviderImageOptions(provider Provider) ImageOptions {
+	opts := ImageOptions{Format: ImageJPEG, Quality: DefaultImageQuality}
+	switch provider {
+	case ProviderOpenAI:
+		opts.MaxWidth, opts.MaxHeight = 2048, 2048
+	case ProviderAnthropic:
+		opts.MaxWidth, opts.MaxHeight = 1568, 1568
+	case ProviderGemini:
+		opts.MaxWidth, opts.MaxHeight = 3072, 3072
+	default:
+		opts.MaxWidth, opts.MaxHeight = 2048, 2048
+	}
+	return opts
+}
+
+// DecodeImage decodes the JPEG, PNG, GIF or WebP image, the EXIF orientation of JPEG is applied.
+// ErrImageTooLarge is returned without decoding if the image has more than MaxImagePixels pixels
+func DecodeImage(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > MaxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	if format == "jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+	return img, nil
+}
+
+// EncodeImage encodes the image, the metadata such as EXIF is not kept
+func EncodeImage(img image.Image, format ImageFormat, quality int) (*Media, error) {
+	if format == "" {
+		format = ImageJPEG
+	}
+	if quality <= 0 || quality > 100 {
+		quality = DefaultImageQuality
+	}
+	imageEncodersMu.RLock()
+	enc, ok := imageEncoders[format]
+	imageEncodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no encoder registered for image format %s", format)
+	}
+	if format == ImageJPEG {
+		img = flatten(img)
+	}
+	var buf bytes.Buffer
+	if err := enc(&buf, img, quality); err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return &Media{Data: buf.Bytes(), MimeType: "image/" + string(format)}, nil
+}
+
+// ProcessImage decodes, downscales and re-encodes the image, which strips the EXIF metadata
+func ProcessImage(data []byte, opts ImageOptions) (*Media, error) {
+	img, err := DecodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeImage(ResizeImage(img, opts.MaxWidth, opts.MaxHeight), opts.Format, opts.Quality)
+}
+
+// ImageMediaLoader processes the images loaded by the loader, the other media are returned as is
+type ImageMediaLoader struct {
+	loader MediaLoader
+	opts   ImageOptions
+}
+
+func NewImageMediaLoader(loader MediaLoader, opts ImageOptions) *ImageMediaLoader {
+	return &ImageMediaLoader{loader: loader, opts: opts}
+}
+
+func (l *ImageMediaLoader) Load(ctx context.Context, link string) (*Media, error) {
+	media, err := l.loader.Load(ctx, link)
+	if err != nil || !strings.HasPrefix(media.MimeType, "image/") {
+		return media, err
+	}
+	return ProcessImage(media.Data, l.opts)
+}
+
+// PrepareImages replaces the images of the message with the processed images as data URLs, the images are loaded by the loader
+func PrepareImages(ctx context.Context, loader MediaLoader, msg *Message, opts ImageOptions) error {
+	if len(msg.Images) == 0 {
+		return nil
+	}
+	images := make([]Image, 0, len(msg.Images))
+	for _, v := range msg.Images {
+		media, err := loader.Load(ctx, v.URL)
+		if err != nil {
+			return fmt.Errorf("load image: %w", err)
+		}
+		processed, err := ProcessImage(media.Data, opts)
+		if err != nil {
+			return err
+		}
+		v.URL = processed.DataURL()
+		images = append(images, v)
+	}
+	msg.Images = images
+	return nil
+}
+
+// ResizeImage downscales the image to fit within the max width and height by area averaging,
+// the image is returned as is if it fits or the bounds are not set
+func ResizeImage(img image.Image, maxWidth int, maxHeight int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if maxWidth > 0 && w > maxWidth {
+		scale = float64(maxWidth) / float64(w)
+	}
+	if maxHeight > 0 && h > maxHeight {
+		scale = math.Min(scale, float64(maxHeight)/float64(h))
+	}
+	if scale >= 1 {
+		return img
+	}
+	dw, dh := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	src := toNRGBA(img)
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := range dw {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				off := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[off])
+					g += int(src.Pix[off+1])
+					bl += int(src.Pix[off+2])
+					a += int(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := y*dst.Stride + x*4
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(bl / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// TileImage splits the image into tiles of at most size x size pixels overlapping by overlap pixels,
+// e.g. to keep the small text of a long receipt readable. The tiles are ordered row by row
+func TileImage(img image.Image, size int, overlap int) []image.Image {
+	b := img.Bounds()
+	if size <= 0 || (b.Dx() <= size && b.Dy() <= size) {
+		return []image.Image{img}
+	}
+	overlap = min(max(overlap, 0), size/2)
+	step := size - overlap
+	src := toNRGBA(img)
+	var tiles []image.Image
+	for y := 0; ; y += step {
+		for x := 0; ; x += step {
+			tiles = append(tiles, src.SubImage(image.Rect(x, y, min(x+size, b.Dx()), min(y+size, b.Dy()))))
+			if x+size >= b.Dx() {
+				break
+			}
+		}
+		if y+size >= b.Dy() {
+			break
+		}
+	}
+	return tiles
+}
+
+// EstimateImageTokens estimates the input tokens of an image of the size sent to the provider,
+// detail is the OpenAI image detail
+func EstimateImageTokens(provider Provider, width int, height int, detail string) int {
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	switch provider {
+	case ProviderOpenAI:
+		if detail == "low" {
+			return 85
+		}
+		// fit in 2048 x 2048 then scale the shortest side to 768, 170 tokens per 512px tile
+		w, h := fitSize(width, height, 2048, 2048)
+		if short := min(w, h); short > 768 {
+			w, h = w*768/short, h*768/short
+		}
+		tiles := ((w + 511) / 512) * ((h + 511) / 512)
+		return 85 + 170*tiles
+	case ProviderAnthropic:
+		w, h := fitSize(width, height, 1568, 1568)
+		return (w*h + 749) / 750
+	case ProviderGemini:
+		if width <= 384 && height <= 384 {
+			return 258
+		}
+		// 258 tokens per 768px tile
+		return 258 * ((width + 767) / 768) * ((height + 767) / 768)
+	case ProviderCohere:
+		return 0
+	}
+	return (width*height + 749) / 750
+}
+
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := math.Min(1, math.Min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height)))
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if v, ok := img.(*image.NRGBA); ok && v.Rect.Min == (image.Point{}) {
+		return v
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// flatten composes the image on a white background as JPEG has no alpha
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// exifOrientation reads the orientation tag of the EXIF segment of the JPEG, 1 if not found
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := range n {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient transforms the image by the EXIF orientation so it is displayed upright without the metadata
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
@@ -2,6 +2,7 @@ package instructor
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -17,6 +18,7 @@ type Instructor interface {
 	StreamEncoder() StreamEncoder
 	SchemaNamer() SchemaNamer
 	MCPTools() []MCPTool
+	Tools() []Tool
 	Memory() *Memory
 	SetMemory(*Memory)
 	MaxRetries() int
@@ -77,11 +79,21 @@ const (
 	ThinkingStream
 	ToolCallStream
 	ErrorStream
+	// ValidationErrorStream reports a streamed item which could not be decoded or validated,
+	// the raw item is kept in StreamData.Raw
+	ValidationErrorStream
+	// DoneStream is the last data of a stream, StreamData.Meta holds the final response metadata
+	DoneStream
+	// ToolApprovalStream pauses the stream until StreamData.Approval is resolved
+	ToolApprovalStream
 )
 
 type StreamData struct {
-	Type     StreamDataType `json:"type,omitempty"`
-	Content  string         `json:"content,omitempty"`
-	ToolCall *ToolCall      `json:"tool_call,omitempty"`
-	Err      error          `json:"error,omitempty"`
+	Type     StreamDataType   `json:"type,omitempty"`
+	Content  string           `json:"content,omitempty"`
+	ToolCall *ToolCall        `json:"tool_call,omitempty"`
+	Raw      json.RawMessage  `json:"raw,omitempty"`
+	Meta     *ResponseMeta    `json:"meta,omitempty"`
+	Approval *PendingApproval `json:"-"`
+	Err      error            `json:"error,omitempty"`
 }
@@ -0,0 +1,188 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	anthropic "github.com/liushuangls/go-anthropic/v2"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/internal/chat"
+)
+
+var _ instructor.BatchJobInstructor[anthropic.MessagesRequest] = (*Instructor)(nil)
+
+// batchResultLine is a line of the results of a message batch, the error is kept unlike anthropic.BatchResult
+type batchResultLine struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    anthropic.ResultType       `json:"type"`
+		Message anthropic.MessagesResponse `json:"message"`
+		Error   *struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+			Error   *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+// SubmitBatchJob creates a message batch of the requests
+func (i *Instructor) SubmitBatchJob(ctx context.Context, requests []*anthropic.MessagesRequest, responseType any) (*instructor.BatchJob, error) {
+	if _, err := chat.Encoder(i, responseType); err != nil {
+		return nil, err
+	}
+	batch := anthropic.BatchRequest{
+		Requests: make([]anthropic.InnerRequests, 0, len(requests)),
+	}
+	for idx, v := range requests {
+		req, err := i.batchRequest(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", idx, err)
+		}
+		batch.Requests = append(batch.Requests, anthropic.InnerRequests{
+			CustomId: instructor.BatchCustomID(idx),
+			Params:   *req,
+		})
+	}
+	resp, err := i.CreateBatch(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+	return i.convertBatch(&resp.BatchRespCore), nil
+}
+
+func (i *Instructor) RetrieveBatchJob(ctx context.Context, id string) (*instructor.BatchJob, error) {
+	resp, err := i.RetrieveBatch(ctx, anthropic.BatchId(id))
+	if err != nil {
+		return nil, err
+	}
+	return i.convertBatch(&resp.BatchRespCore), nil
+}
+
+func (i *Instructor) CancelBatchJob(ctx context.Context, id string) error {
+	_, err := i.CancelBatch(ctx, anthropic.BatchId(id))
+	return err
+}
+
+func (i *Instructor) BatchJobResults(ctx context.Context, id string) ([]instructor.BatchJobResult, error) {
+	resp, err := i.RetrieveBatchResults(ctx, anthropic.BatchId(id))
+	if err != nil {
+		return nil, err
+	}
+	var ret []instructor.BatchJobResult
+	for _, line := range bytes.Split(resp.RawResponse, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var result batchResultLine
+		if err := json.Unmarshal(line, &result); err != nil {
+			return nil, err
+		}
+		idx, err := instructor.ParseBatchCustomID(result.CustomID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, i.batchResult(idx, &result))
+	}
+	return ret, nil
+}
+
+func (i *Instructor) DecodeBatchJobResult(text string, responseType any) error {
+	enc, err := chat.Encoder(i, responseType)
+	if err != nil {
+		return err
+	}
+	return chat.Decode(i, enc, text, responseType)
+}
+
+// batchRequest applies the setup of the mode to the request as the Handler does,
+// the MCP tools are not sent as a batch can not run the tool loop
+func (i *Instructor) batchRequest(ctx context.Context, request *anthropic.MessagesRequest) (*anthropic.MessagesRequest, error) {
+	req := *request
+	i.setThinking(&req)
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
+	switch i.Mode() {
+	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+		extraction, err := i.setToolCallFormat(&req)
+		if err != nil {
+			return nil, err
+		}
+		i.applyToolChoice(&req, 1, extraction)
+	default:
+		i.setSchemaContext(&req)
+	}
+	if err := i.Preflight(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (i *Instructor) batchResult(idx int, line *batchResultLine) instructor.BatchJobResult {
+	ret := instructor.BatchJobResult{Index: idx}
+	switch result := line.Result; result.Type {
+	case anthropic.ResultTypeSucceeded:
+	case anthropic.ResultTypeErrored:
+		ret.Err = errors.New("batch request errored")
+		if e := result.Error; e != nil {
+			if e.Error != nil {
+				ret.Err = fmt.Errorf("%s: %s", e.Error.Type, e.Error.Message)
+			} else {
+				ret.Err = fmt.Errorf("%s: %s", e.Type, e.Message)
+			}
+		}
+		return ret
+	default:
+		ret.Err = fmt.Errorf("batch request %s", result.Type)
+		return ret
+	}
+	resp := &line.Result.Message
+	i.CountUsageFromResponse(resp, &ret.Usage)
+	for _, c := range resp.Content {
+		switch i.Mode() {
+		case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+			if c.Type != anthropic.MessagesContentTypeToolUse {
+				continue
+			}
+			bs, err := json.Marshal(c.Input)
+			ret.Text, ret.Err = string(bs), err
+			return ret
+		default:
+			if c.Type == anthropic.MessagesContentTypeText && c.Text != nil {
+				ret.Text = *c.Text
+				return ret
+			}
+		}
+	}
+	ret.Err = errors.New("received no content from model")
+	return ret
+}
+
+func (i *Instructor) convertBatch(batch *anthropic.BatchRespCore) *instructor.BatchJob {
+	counts := batch.RequestCounts
+	job := &instructor.BatchJob{
+		ID:        string(batch.Id),
+		Provider:  i.Provider(),
+		Total:     counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired,
+		Succeeded: counts.Succeeded,
+		Failed:    counts.Errored + counts.Canceled + counts.Expired,
+	}
+	switch {
+	case batch.ProcessingStatus != anthropic.ProcessingStatusEnded:
+		job.Status = instructor.BatchJobRunning
+	case counts.Succeeded+counts.Errored > 0:
+		job.Status = instructor.BatchJobCompleted
+	case counts.Expired > 0:
+		job.Status = instructor.BatchJobExpired
+	default:
+		job.Status = instructor.BatchJobCanceled
+	}
+	return job
+}
@@ -19,6 +19,21 @@ func (i *Instructor) Chat(ctx context.Context, request *anthropic.MessagesReques
 }
 
 func (i *Instructor) Handler(ctx context.Context, request *anthropic.MessagesRequest, response *anthropic.MessagesResponse) (string, error) {
+	i.setThinking(request)
+	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return "", err
+	}
+	switch i.Mode() {
+	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+		return i.completionToolCall(ctx, req, response)
+	default:
+		return i.completion(ctx, req, response)
+	}
+}
+
+// setThinking sets the thinking config to the request
+func (i *Instructor) setThinking(request *anthropic.MessagesRequest) {
 	if thinking := i.ThinkingConfig(); thinking != nil {
 		request.Thinking = &anthropic.Thinking{
 			BudgetTokens: thinking.Budget,
@@ -29,24 +44,17 @@ func (i *Instructor) Handler(ctx context.Context, request *anthropic.MessagesReq
 			request.Thinking.Type = anthropic.ThinkingTypeDisabled
 		}
 	}
-	switch i.Mode() {
-	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
-		return i.completionToolCall(ctx, *request, response)
-	default:
-		return i.completion(ctx, *request, response)
-	}
 }
 
-func (i *Instructor) completionToolCall(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse) (string, error) {
-	var schema *instructor.Schema
-	if enc, ok := i.Encoder().(*jsonenc.Encoder); ok {
-		schema = enc.Schema()
-	} else {
+// setToolCallFormat sets the schema of the encoder as the tools of the request and returns the name of the extraction tool
+func (i *Instructor) setToolCallFormat(request *anthropic.MessagesRequest) (string, error) {
+	enc, ok := i.Encoder().(*jsonenc.Encoder)
+	if !ok {
 		return "", errors.New("encoder must be JSON Encoder")
 	}
+	schema := enc.Schema()
 	request.Stream = false
-	request.Tools = []anthropic.ToolDefinition{}
-
+	request.Tools = make([]anthropic.ToolDefinition, 0, len(schema.Functions))
 	for _, function := range schema.Functions {
 		t := anthropic.ToolDefinition{
 			Name:        function.Name,
@@ -55,6 +63,30 @@ func (i *Instructor) completionToolCall(ctx context.Context, request anthropic.M
 		}
 		request.Tools = append(request.Tools, t)
 	}
+	return extractionTool(request.Tools), nil
+}
+
+// extractionTool returns the name of the extraction tool of the tools created from the schema
+func extractionTool(tools []anthropic.ToolDefinition) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	return tools[0].Name
+
+}
+
+func (i *Instructor) completionToolCall(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse) (string, error) {
+	extraction, err := i.setToolCallFormat(&request)
+	if err != nil {
+		return "", err
+	}
+	if err := i.InjectMCPContext(ctx, &request); err != nil {
+		return "", err
+	}
+	i.applyToolChoice(&request, 1, extraction)
+	if err := i.Preflight(&request); err != nil {
+		return "", err
+	}
 
 	if i.Verbose() {
 		bs, _ := json.MarshalIndent(request, "", "  ")
@@ -107,7 +139,8 @@ func (i *Instructor) completionToolCall(ctx context.Context, request anthropic.M
 	return "", errors.New("more than 1 tool response at a time is not implemented")
 }
 
-func (i *Instructor) completion(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse) (string, error) {
+// setSchemaContext adds the output schema to the system prompt
+func (i *Instructor) setSchemaContext(request *anthropic.MessagesRequest) {
 	request.Stream = false
 	if bs := i.Encoder().Context(); bs != nil {
 		if request.System == "" {
@@ -116,6 +149,10 @@ func (i *Instructor) completion(ctx context.Context, request anthropic.MessagesR
 			request.System = fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", request.System, bs)
 		}
 	}
+}
+
+func (i *Instructor) completion(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse) (string, error) {
+	i.setSchemaContext(&request)
 	if memory := i.Memory(); memory != nil {
 		if len(request.Messages) > 0 {
 			var msg instructor.Message
@@ -127,40 +164,68 @@ func (i *Instructor) completion(ctx context.Context, request anthropic.MessagesR
 	return i.chatCompletionWrapper(ctx, request, response)
 }
 
+// chatCompletionWrapper runs the tool loop until the model stops calling tools or hits the max tool iterations
 func (i *Instructor) chatCompletionWrapper(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse) (string, error) {
 	i.InjectMCP(ctx, &request)
-	if i.Verbose() {
-		bs, _ := json.MarshalIndent(request, "", "  ")
-		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
-	}
-	resp, err := i.CreateMessages(ctx, request)
-	if err != nil {
+	if err := i.InjectMCPContext(ctx, &request); err != nil {
 		return "", err
 	}
-	if i.Verbose() {
-		bs, _ := json.MarshalIndent(resp, "", "  ")
-		log.Printf("%s Response: %s\n", i.Provider(), string(bs))
-	}
-	if response != nil {
-		*response = resp
-	}
-	memory := i.Memory()
-	var messageContents []anthropic.MessageContent
-	for _, c := range resp.Content {
-		if c.Type == anthropic.MessagesContentTypeToolUse {
-			messageContent, call := i.CallMCP(ctx, c.MessageContentToolUse)
-			if i.Verbose() && call != nil {
-				bs, _ := json.MarshalIndent(call, "", "  ")
-				log.Printf("%s ToolCall Result: %s\n", i.Provider(), string(bs))
-			}
-			messageContents = append(messageContents, messageContent)
+	var (
+		memory = i.Memory()
+		usage  anthropic.MessagesUsage
+	)
+	for iteration := 1; ; iteration++ {
+		i.applyToolChoice(&request, iteration, "")
+		if err := i.Preflight(&request); err != nil {
+			return "", err
 		}
-	}
-	if len(messageContents) > 0 {
-		var usage anthropic.MessagesUsage
+		if i.Verbose() {
+			bs, _ := json.MarshalIndent(request, "", "  ")
+			log.Printf("%s Request: %s\n", i.Provider(), string(bs))
+		}
+		resp, err := i.CreateMessages(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		if i.Verbose() {
+			bs, _ := json.MarshalIndent(resp, "", "  ")
+			log.Printf("%s Response: %s\n", i.Provider(), string(bs))
+		}
+		usage.InputTokens += resp.Usage.InputTokens
+		usage.OutputTokens += resp.Usage.OutputTokens
 		if response != nil {
-			usage = response.Usage
+			*response = resp
+			response.Usage = usage
+		}
+		var (
+			toolUses []anthropic.MessageContentToolUse
+			text     string
+		)
+		for _, c := range resp.Content {
+			switch c.Type {
+			case anthropic.MessagesContentTypeToolUse:
+				if c.MessageContentToolUse != nil {
+					toolUses = append(toolUses, *c.MessageContentToolUse)
+				}
+			case anthropic.MessagesContentTypeText:
+				if c.Text != nil && text == "" {
+					text = *c.Text
+				}
+			}
+		}
+		if len(toolUses) == 0 {
+			if memory != nil && text != "" {
+				memory.Add(instructor.Message{
+					Role: instructor.AssistantRole,
+					Text: text,
+				})
+			}
+			return text, nil
 		}
+		if iteration > i.MaxToolIterations() {
+			return "", instructor.ErrMaxToolIterations
+		}
+		messageContents, _ := i.CallMCP(ctx, iteration, toolUses)
 		newMessages := []anthropic.Message{
 			{
 				Role:    anthropic.RoleAssistant,
@@ -180,23 +245,7 @@ func (i *Instructor) chatCompletionWrapper(ctx context.Context, request anthropi
 			}
 		}
 		request.Messages = append(request.Messages, newMessages...)
-		text, err := i.chatCompletionWrapper(ctx, request, response)
-		if response != nil {
-			response.Usage.InputTokens += usage.InputTokens
-			response.Usage.OutputTokens += usage.OutputTokens
-		}
-		return text, err
-	}
-	if text := resp.Content[0].Text; text != nil {
-		if memory != nil && *text != "" {
-			memory.Add(instructor.Message{
-				Role: instructor.AssistantRole,
-				Text: *text,
-			})
-		}
-		return *text, nil
 	}
-	return "", nil
 }
 
 func (i *Instructor) EmptyResponseWithUsageSum(ret *anthropic.MessagesResponse, usage *instructor.UsageSum) {
@@ -0,0 +1,25 @@
+package anthropic
+
+import (
+	"errors"
+
+	anthropic "github.com/liushuangls/go-anthropic/v2"
+
+	"github.com/bububa/instructor-go"
+)
+
+var _ instructor.TransientErrorChecker = (*Instructor)(nil)
+
+// IsTransientError reports if the request failed with a rate limit, a server error or a timeout
+func (i *Instructor) IsTransientError(err error) bool {
+	var reqErr *anthropic.RequestError
+	if errors.As(err, &reqErr) {
+		return instructor.IsTransientStatus(reqErr.StatusCode)
+	}
+	// the status is dropped by the client once the error body is parsed
+	var apiErr *anthropic.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.IsRateLimitErr() || apiErr.IsOverloadedErr() || apiErr.IsApiErr()
+	}
+	return instructor.IsTransientError(err)
+}
@@ -2,67 +2,69 @@ package anthropic
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 
 	anthropic "github.com/liushuangls/go-anthropic/v2"
-	"github.com/mark3labs/mcp-go/mcp"
 
 	"github.com/bububa/instructor-go"
 )
 
+// InjectMCP appends the MCP and local tools, the tools are hidden with ToolChoiceNone
 func (i *Instructor) InjectMCP(ctx context.Context, req *anthropic.MessagesRequest) {
-	l := len(i.MCPTools())
-	if l == 0 {
+	tools := i.Tools()
+	l := len(tools)
+	if choice, _ := i.ToolChoiceOf(1, ""); l == 0 || choice == instructor.ToolChoiceNone {
 		return
 	}
 	if req.Tools == nil {
 		req.Tools = make([]anthropic.ToolDefinition, 0, l)
 	}
-	for _, v := range i.MCPTools() {
+	for _, v := range tools {
+		def := v.Definition()
 		tool := anthropic.ToolDefinition{
-			Name:        fmt.Sprintf("%s_%s", v.ServerName, v.Tool.GetName()),
-			Description: v.Tool.Description,
-			InputSchema: v.Tool.InputSchema,
+			Name:        v.Name(),
+			Description: def.Description,
+			InputSchema: def.InputSchema,
 		}
 		req.Tools = append(req.Tools, tool)
 	}
 }
 
-func (i *Instructor) CallMCP(ctx context.Context, toolUse *anthropic.MessageContentToolUse) (anthropic.MessageContent, *instructor.ToolCall) {
-	var toolContent string
-	for _, v := range i.MCPTools() {
-		if name := fmt.Sprintf("%s_%s", v.ServerName, v.Tool.GetName()); name == toolUse.Name {
-			var (
-				toolArgs map[string]any
-				isError  bool
-			)
-			ret := new(instructor.ToolCall)
-			if err := json.Unmarshal([]byte(toolUse.Input), &toolArgs); err != nil {
-				ret.Result = mcp.NewToolResultError(fmt.Sprintf("error parsing tool arguments: %v", err))
-				if bs, err := json.Marshal(ret.Result); err == nil {
-					toolContent = string(bs)
-				}
-				isError = true
-			} else {
-				ret.Request = new(mcp.CallToolRequest)
-				ret.Request.Params.Name = v.Tool.GetName()
-				ret.Request.Params.Arguments = toolArgs
-				ret.Result, err = v.Client.CallTool(ctx, *ret.Request)
-				if err != nil {
-					ret.Result = mcp.NewToolResultError(fmt.Sprintf("tool call error: %v", err))
-					isError = true
-				}
-				if bs, err := json.Marshal(ret.Result); err == nil {
-					toolContent = string(bs)
-				}
-			}
-			return anthropic.NewToolResultMessageContent(toolUse.ID, toolContent, isError), ret
-		}
+// CallMCP executes the tool calls of the step and returns the tool result contents in the same order
+func (i *Instructor) CallMCP(ctx context.Context, iteration int, toolUses []anthropic.MessageContentToolUse) ([]anthropic.MessageContent, []instructor.ToolCall) {
+	calls := make([]instructor.ToolCall, 0, len(toolUses))
+	for _, v := range toolUses {
+		calls = append(calls, instructor.NewToolCall(v.Name, v.Input))
+	}
+	i.CallTools(ctx, iteration, calls)
+	contents := make([]anthropic.MessageContent, 0, len(toolUses))
+	for idx, v := range toolUses {
+		isError := calls[idx].Result != nil && calls[idx].Result.IsError
+		contents = append(contents, anthropic.NewToolResultMessageContent(v.ID, calls[idx].ToolResultContent(), isError))
+	}
+	return contents, calls
+}
+
+// InjectMCPContext prepends the messages of the MCP prompts and resources to the messages of the request
+func (i *Instructor) InjectMCPContext(ctx context.Context, req *anthropic.MessagesRequest) error {
+	msgs, err := i.MCPMessages(ctx)
+	if err != nil {
+		return err
+	}
+	return i.prependMessages(ctx, req, msgs)
+}
+
+// applyToolChoice sets the tool choice of the step of the tool loop,
+// extraction is the name of the extraction tool in the tool call modes, empty otherwise
+func (i *Instructor) applyToolChoice(req *anthropic.MessagesRequest, iteration int, extraction string) {
+	if len(req.Tools) == 0 {
+		return
 	}
-	toolRet := mcp.NewToolResultError("invalid tool name")
-	if bs, err := json.Marshal(toolRet); err == nil {
-		toolContent = string(bs)
+	switch choice, name := i.ToolChoiceOf(iteration, extraction); {
+	case name != "":
+		req.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: name}
+	case choice == instructor.ToolChoiceRequired:
+		req.ToolChoice = &anthropic.ToolChoice{Type: "any"}
+	case choice != "":
+		req.ToolChoice = &anthropic.ToolChoice{Type: string(choice)}
 	}
-	return anthropic.NewToolResultMessageContent(toolUse.ID, toolContent, true), nil
 }
@@ -2,12 +2,12 @@ package anthropic
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -17,18 +17,20 @@ import (
 )
 
 func ConvertMessageFrom(src *instructor.Message, dist *anthropic.Message) error {
-	if src.Role != instructor.SystemRole {
-		if src.Text != "" {
-			dist.Role = anthropic.RoleAssistant
-			dist.Content = []anthropic.MessageContent{
-				anthropic.NewTextMessageContent(src.Text),
-			}
-			return nil
-		}
+	return ConvertMessageFromContext(context.Background(), instructor.DefaultMediaLoader, src, dist)
+}
+
+// ConvertMessageFromContext converts the message with the images and videos loaded by the loader,
+// the media which fails to load is reported as error
+func ConvertMessageFromContext(ctx context.Context, loader instructor.MediaLoader, src *instructor.Message, dist *anthropic.Message) error {
+	if src.Role == instructor.SystemRole {
 		return errors.New("do not support role")
 	}
 	if len(src.ToolUses) > 0 {
-		list := make([]anthropic.MessageContent, 0, len(src.ToolUses))
+		list := make([]anthropic.MessageContent, 0, len(src.ToolUses)+1)
+		if thinking := thinkingContent(src); thinking != nil {
+			list = append(list, *thinking)
+		}
 		for _, v := range src.ToolUses {
 			part := anthropic.NewToolUseMessageContent(v.ID, v.Name, []byte(v.Arguments))
 			list = append(list, part)
@@ -50,12 +52,15 @@ func ConvertMessageFrom(src *instructor.Message, dist *anthropic.Message) error
 	list := make([]anthropic.MessageContent, 0, len(src.Files)+len(src.Audios)+len(src.Images)+1)
 	var buf bytes.Buffer
 	for _, v := range src.Files {
-		mediaTypeStr := "text/plain"
-		if data, err := base64.StdEncoding.DecodeString(v.Data); err == nil {
-			buf.Reset()
-			buf.Write(data)
-			if mediaType, err := mimetype.DetectReader(&buf); err == nil {
-				mediaTypeStr = mediaType.String()
+		mediaTypeStr := v.MimeType
+		if mediaTypeStr == "" {
+			mediaTypeStr = "text/plain"
+			if data, err := base64.StdEncoding.DecodeString(v.Data); err == nil {
+				buf.Reset()
+				buf.Write(data)
+				if mediaType, err := mimetype.DetectReader(&buf); err == nil {
+					mediaTypeStr = mediaType.String()
+				}
 			}
 		}
 		msg := anthropic.NewDocumentMessageContent(anthropic.NewMessageContentSource(anthropic.MessagesContentSourceTypeBase64, mediaTypeStr, v.Data), v.Name, "", false)
@@ -76,33 +81,24 @@ func ConvertMessageFrom(src *instructor.Message, dist *anthropic.Message) error
 		list = append(list, msg)
 	}
 	for _, v := range src.Videos {
-		buf.Reset()
-		if err := DataFromURL(v.URL, &buf); err != nil {
-			continue
+		media, err := loader.Load(ctx, v.URL)
+		if err != nil {
+			return fmt.Errorf("load video: %w", err)
 		}
-		data := base64.StdEncoding.EncodeToString(buf.Bytes())
-		mediaTypeStr := "video/mp4"
-		mediaType, err := mimetype.DetectReader(&buf)
-		if err == nil {
-			mediaTypeStr = mediaType.String()
-		}
-		msg := anthropic.NewDocumentMessageContent(anthropic.NewMessageContentSource(anthropic.MessagesContentSourceTypeBase64, mediaTypeStr, data), "", "", false)
+		msg := anthropic.NewDocumentMessageContent(anthropic.NewMessageContentSource(anthropic.MessagesContentSourceTypeBase64, media.MimeType, media.Base64()), "", "", false)
 		list = append(list, msg)
 	}
 	for _, v := range src.Images {
-		buf.Reset()
-		if err := DataFromURL(v.URL, &buf); err != nil {
-			continue
-		}
-		data := base64.StdEncoding.EncodeToString(buf.Bytes())
-		mediaTypeStr := "image/jpeg"
-		mediaType, err := mimetype.DetectReader(&buf)
-		if err == nil {
-			mediaTypeStr = mediaType.String()
+		media, err := loader.Load(ctx, v.URL)
+		if err != nil {
+			return fmt.Errorf("load image: %w", err)
 		}
-		msg := anthropic.NewImageMessageContent(anthropic.NewMessageContentSource(anthropic.MessagesContentSourceTypeBase64, mediaTypeStr, data))
+		msg := anthropic.NewImageMessageContent(anthropic.NewMessageContentSource(anthropic.MessagesContentSourceTypeBase64, media.MimeType, media.Base64()))
 		list = append(list, msg)
 	}
+	if thinking := thinkingContent(src); thinking != nil {
+		list = append([]anthropic.MessageContent{*thinking}, list...)
+	}
 	if src.Text != "" {
 		list = append(list, anthropic.NewTextMessageContent(src.Text))
 	}
@@ -124,7 +120,10 @@ func ConvertMessageTo(src *anthropic.Message, dist *instructor.Message) error {
 		dist.Role = instructor.UserRole
 	}
 	for _, content := range src.Content {
-		if call := content.MessageContentToolUse; call != nil {
+		if thinking := content.MessageContentThinking; thinking != nil && content.Type == anthropic.MessagesContentTypeThinking {
+			dist.Thinking = thinking.Thinking
+			dist.ThinkingSignature = thinking.Signature
+		} else if call := content.MessageContentToolUse; call != nil {
 			bs, _ := json.Marshal(call.Input)
 			dist.ToolUses = append(dist.ToolUses, instructor.ToolUse{
 				ID:        call.ID,
@@ -159,7 +158,8 @@ func ConvertMessageTo(src *anthropic.Message, dist *instructor.Message) error {
 					}
 				} else if data, ok := source.Data.(string); ok {
 					dist.Files = append(dist.Files, instructor.File{
-						Data: data,
+						Data:     data,
+						MimeType: source.MediaType,
 					})
 				}
 			}
@@ -171,28 +171,75 @@ func ConvertMessageTo(src *anthropic.Message, dist *instructor.Message) error {
 	return nil
 }
 
-func DataFromURL(link string, w io.Writer) error {
-	if strings.HasPrefix(link, "data:") && strings.Contains(link, ";base64,") {
-		b64 := link
-		parts := strings.Split(b64, ",")
-		if len(parts) == 2 {
-			b64 = strings.TrimSpace(parts[1])
-		}
-		if bs, err := base64.StdEncoding.DecodeString(b64); err != nil {
-			return err
-		} else {
-			w.Write(bs)
-		}
+// SupportsDocument reports if the documents of the MIME type are sent as document blocks, the other documents are prepared by PrepareDocuments
+func SupportsDocument(mimeType string) bool {
+	return mimeType == "application/pdf"
+}
+
+// convertMessage converts the message with the media loader and the documents and audios prepared for Anthropic
+func (i *Instructor) convertMessage(ctx context.Context, src instructor.Message, dist *anthropic.Message) error {
+	if err := i.PrepareDocuments(ctx, &src, SupportsDocument); err != nil {
+		return err
+	}
+	// Anthropic does not accept audio
+	if err := i.PrepareAudios(ctx, &src, func(*instructor.Audio) bool { return false }); err != nil {
+		return err
+	}
+	return ConvertMessageFromContext(ctx, i.MediaLoader(), &src, dist)
+}
+
+// thinkingContent replays the signed thinking of the assistant, the thinking without signature is rejected by the API
+func thinkingContent(src *instructor.Message) *anthropic.MessageContent {
+	if src.Role != instructor.AssistantRole || src.Thinking == "" || src.ThinkingSignature == "" {
 		return nil
 	}
-	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
-		return errors.New("invalid link")
+	return &anthropic.MessageContent{
+		Type: anthropic.MessagesContentTypeThinking,
+		MessageContentThinking: &anthropic.MessageContentThinking{
+			Thinking:  src.Thinking,
+			Signature: src.ThinkingSignature,
+		},
 	}
-	resp, err := http.Get(link)
+}
+
+// DataFromURL writes the data of the link to w
+//
+// Deprecated: use instructor.MediaLoader which respects the context and limits the size
+func DataFromURL(link string, w io.Writer) error {
+	media, err := instructor.DefaultMediaLoader.Load(context.Background(), link)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	io.Copy(w, resp.Body)
+	_, err = w.Write(media.Data)
+	return err
+}
+
+// InjectMemory prepends the messages of the memory to the messages of the request, if WithMemoryInjection is set
+func (i *Instructor) InjectMemory(ctx context.Context, req *anthropic.MessagesRequest) error {
+	msgs, err := i.MemoryMessages(ctx)
+	if err != nil {
+		return err
+	}
+	return i.prependMessages(ctx, req, msgs)
+}
+
+// prependMessages prepends the messages to the request without modifying the original messages,
+// the system messages are skipped as the system prompt is set by the request
+func (i *Instructor) prependMessages(ctx context.Context, req *anthropic.MessagesRequest, msgs []instructor.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	list := make([]anthropic.Message, 0, len(req.Messages)+len(msgs))
+	for _, v := range msgs {
+		if v.Role == instructor.SystemRole {
+			continue
+		}
+		var msg anthropic.Message
+		if err := i.convertMessage(ctx, v, &msg); err != nil {
+			return err
+		}
+		list = append(list, msg)
+	}
+	req.Messages = append(list, req.Messages...)
 	return nil
 }
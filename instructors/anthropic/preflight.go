@@ -0,0 +1,40 @@
+package anthropic
+
+import (
+	"encoding/json"
+
+	anthropic "github.com/liushuangls/go-anthropic/v2"
+
+	"github.com/bububa/instructor-go"
+)
+
+// Preflight returns an instructor.ContextTooLargeError if the messages, the tools and the max output tokens of the request
+// do not fit in the context window of the model, it is skipped unless WithContextPreflight is set.
+// It checks the final request of every round trip of the tool loop
+func (i *Instructor) Preflight(req *anthropic.MessagesRequest) error {
+	if !i.ContextPreflight() {
+		return nil
+	}
+	list := make([]instructor.Message, 0, len(req.Messages)+1)
+	system := req.System
+	for _, v := range req.MultiSystem {
+		system += v.Text
+	}
+	if system != "" {
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: system})
+	}
+	for _, v := range req.Messages {
+		var msg instructor.Message
+		if err := ConvertMessageTo(&v, &msg); err != nil {
+			continue
+		}
+		list = append(list, msg)
+	}
+	// the tool definitions are counted as their JSON
+	if len(req.Tools) > 0 {
+		bs, _ := json.Marshal(req.Tools)
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: string(bs)})
+	}
+	model := string(req.Model)
+	return instructor.CheckContext(i.Tokenizer(model), model, list, req.MaxTokens)
+}
@@ -7,12 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 
 	anthropic "github.com/liushuangls/go-anthropic/v2"
 	"github.com/mark3labs/mcp-go/mcp"
 
 	"github.com/bububa/instructor-go"
 	jsonenc "github.com/bububa/instructor-go/encoding/json"
+	"github.com/bububa/instructor-go/internal"
 	"github.com/bububa/instructor-go/internal/chat"
 )
 
@@ -26,11 +29,15 @@ func (i *Instructor) SchemaStream(
 }
 
 func (i *Instructor) SchemaStreamHandler(ctx context.Context, request *anthropic.MessagesRequest, response *anthropic.MessagesResponse) (<-chan instructor.StreamData, error) {
+	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
 	switch i.Mode() {
 	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
-		return i.chatToolCallStream(ctx, *request, response)
+		return i.chatToolCallStream(ctx, req, response)
 	case instructor.ModeJSON, instructor.ModeJSONSchema:
-		return i.chatSchemaStream(ctx, *request, response)
+		return i.chatSchemaStream(ctx, req, response)
 	default:
 		return nil, fmt.Errorf("mode '%s' is not supported for %s", i.Mode(), i.Provider())
 	}
@@ -54,7 +61,7 @@ func (i *Instructor) chatToolCallStream(ctx context.Context, request anthropic.M
 		}
 		request.Tools = append(request.Tools, t)
 	}
-	return i.createStream(ctx, request, response, false)
+	return i.createStream(ctx, request, response, nil, 1, extractionTool(request.Tools))
 }
 
 func (i *Instructor) chatSchemaStream(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse) (<-chan instructor.StreamData, error) {
@@ -66,10 +73,16 @@ func (i *Instructor) chatSchemaStream(ctx context.Context, request anthropic.Mes
 			request.System = fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", request.System, bs)
 		}
 	}
-	return i.createStream(ctx, request, response, false)
+	return i.createStream(ctx, request, response, nil, 1, "")
 }
 
-func (i *Instructor) createStream(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse, toolRequest bool) (<-chan instructor.StreamData, error) {
+// createStream streams the request, the follow up requests of the tool calls share the meta of the outermost stream
+// which sends it with DoneStream once every round trip finished, extraction is the name of the extraction tool in the tool call modes
+func (i *Instructor) createStream(ctx context.Context, request anthropic.MessagesRequest, response *anthropic.MessagesResponse, meta *instructor.ResponseMeta, iteration int, extraction string) (<-chan instructor.StreamData, error) {
+	toolRequest := meta != nil
+	if !toolRequest {
+		meta = new(instructor.ResponseMeta)
+	}
 	request.Stream = true
 	if thinking := i.ThinkingConfig(); thinking != nil {
 		request.Thinking = &anthropic.Thinking{
@@ -90,6 +103,13 @@ func (i *Instructor) createStream(ctx context.Context, request anthropic.Message
 				memory.Add(msg)
 			}
 		}
+		if err := i.InjectMCPContext(ctx, &request); err != nil {
+			return nil, err
+		}
+	}
+	i.applyToolChoice(&request, iteration, extraction)
+	if err := i.Preflight(&request); err != nil {
+		return nil, err
 	}
 	ch := make(chan instructor.StreamData)
 	sb := new(bytes.Buffer)
@@ -119,21 +139,15 @@ func (i *Instructor) createStream(ctx context.Context, request anthropic.Message
 				}
 			case anthropic.MessagesContentTypeText:
 				if thinking := data.Delta.MessageContentThinking; thinking != nil {
-					ch <- instructor.StreamData{Type: instructor.ThinkingStream, Content: thinking.Thinking}
+					internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ThinkingStream, Content: thinking.Thinking})
 				} else if text := data.Delta.Text; text != nil {
 					if i.Verbose() {
 						sb.WriteString(*text)
 					}
-					ch <- instructor.StreamData{Type: instructor.ContentStream, Content: *text}
+					internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ContentStream, Content: *text})
 				}
 			}
 		},
-		OnMessageDelta: func(data anthropic.MessagesEventMessageDeltaData) {
-			if response != nil {
-				response.Usage.InputTokens += data.Usage.InputTokens
-				response.Usage.OutputTokens += data.Usage.OutputTokens
-			}
-		},
 	}
 	if thinkingConfig := i.ThinkingConfig(); thinkingConfig != nil {
 		request.Thinking = &anthropic.Thinking{
@@ -147,11 +161,16 @@ func (i *Instructor) createStream(ctx context.Context, request anthropic.Message
 	}
 	go func() {
 		defer close(ch)
-		var usage anthropic.MessagesUsage
+		if !toolRequest {
+			defer func() {
+				if response != nil {
+					response.Usage.InputTokens = int(meta.Usage.InputTokens)
+					response.Usage.OutputTokens = int(meta.Usage.OutputTokens)
+				}
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.DoneStream, Meta: meta})
+			}()
+		}
 		defer func() {
-			if response != nil {
-				usage = response.Usage
-			}
 			txt := sb.String()
 			if memory != nil && txt != "" {
 				memory.Add(instructor.Message{
@@ -164,7 +183,9 @@ func (i *Instructor) createStream(ctx context.Context, request anthropic.Message
 			}
 			toolCalls := make([]anthropic.MessageContentToolUse, 0, len(toolCallMap))
 			contents := make([]anthropic.MessageContent, 0, len(toolCallMap))
-			for idx, toolCall := range toolCallMap {
+			// keep the order of the content blocks
+			for _, idx := range slices.Sorted(maps.Keys(toolCallMap)) {
+				toolCall := toolCallMap[idx]
 				input, ok := toolUseInput[idx]
 				if !ok {
 					continue
@@ -176,35 +197,38 @@ func (i *Instructor) createStream(ctx context.Context, request anthropic.Message
 			if len(toolCalls) == 0 {
 				return
 			}
+			// the extraction tool calls are the final answer, the items are parsed by the schema stream handler
+			var extracted bool
+			for _, toolCall := range toolCalls {
+				if _, ok := i.LookupTool(toolCall.Name); ok {
+					continue
+				}
+				for _, tool := range request.Tools {
+					if tool.Name == toolCall.Name {
+						callReq := new(mcp.CallToolRequest)
+						callReq.Params.Name = toolCall.Name
+						callReq.Params.Arguments = toolCall.Input
+						internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &instructor.ToolCall{Request: callReq}})
+						extracted = true
+						break
+					}
+				}
+			}
+			if extracted {
+				return
+			}
+			if iteration > i.MaxToolIterations() {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: instructor.ErrMaxToolIterations})
+				return
+			}
 			oldMessageCount := len(request.Messages)
 			request.Messages = append(request.Messages, anthropic.Message{
 				Role:    anthropic.RoleAssistant,
 				Content: contents,
 			})
-			messageContents := make([]anthropic.MessageContent, 0, len(toolCalls))
-			for _, toolCall := range toolCalls {
-				content, call := i.CallMCP(ctx, &toolCall)
-				if call != nil {
-					ch <- instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: call}
-				} else {
-					var shouldReturn bool
-					for _, tool := range request.Tools {
-						if tool.Name == toolCall.Name {
-							callReq := new(mcp.CallToolRequest)
-							callReq.Params.Name = toolCall.Name
-							callReq.Params.Arguments = toolCall.Input
-							call := instructor.ToolCall{
-								Request: callReq,
-							}
-							ch <- instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &call}
-							shouldReturn = true
-						}
-					}
-					if shouldReturn {
-						return
-					}
-				}
-				messageContents = append(messageContents, content)
+			messageContents, calls := i.CallMCP(i.StreamApprovalContext(ctx, ch), iteration, toolCalls)
+			for idx := range calls {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &calls[idx]})
 			}
 			request.Messages = append(request.Messages, anthropic.Message{
 				Role:    anthropic.RoleUser,
@@ -218,28 +242,33 @@ func (i *Instructor) createStream(ctx context.Context, request anthropic.Message
 					}
 				}
 			}
-			tmpCh, err := i.createStream(ctx, request, response, true)
+			tmpCh, err := i.createStream(ctx, request, response, meta, iteration+1, extraction)
 			if err != nil {
-				ch <- instructor.StreamData{Type: instructor.ErrorStream, Err: err}
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
 				return
 			}
 			for v := range tmpCh {
 				if i.Verbose() && v.Type == instructor.ContentStream {
 					sb.WriteString(v.Content)
 				}
-				ch <- v
-			}
-			if response != nil {
-				response.Usage.InputTokens += usage.InputTokens
-				response.Usage.OutputTokens += usage.OutputTokens
+				internal.Send(ctx, ch, v)
 			}
 		}()
 		resp, err := i.CreateMessagesStream(ctx, streamReq)
 		if response != nil {
 			*response = resp
 		}
+		meta.ID = resp.ID
+		meta.Model = string(resp.Model)
+		meta.FinishReason = string(resp.StopReason)
+		meta.StopSequence = resp.StopSequence
+		meta.Usage.Add(instructor.UsageSum{
+			InputTokens:  int64(resp.Usage.InputTokens),
+			OutputTokens: int64(resp.Usage.OutputTokens),
+			TotalTokens:  int64(resp.Usage.InputTokens + resp.Usage.OutputTokens),
+		})
 		if err != nil {
-			ch <- instructor.StreamData{Type: instructor.ErrorStream, Err: err}
+			internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
 		}
 	}()
 
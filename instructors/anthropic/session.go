@@ -0,0 +1,41 @@
+package anthropic
+
+import (
+	"context"
+	"slices"
+
+	anthropic "github.com/liushuangls/go-anthropic/v2"
+
+	"github.com/bububa/instructor-go"
+)
+
+// NewSession creates a session which replays the memory after the messages of the base request,
+// the system messages of the memory are appended to the system prompt
+func (i *Instructor) NewSession(base *anthropic.MessagesRequest, memory *instructor.Memory) *instructor.Session[anthropic.MessagesRequest, anthropic.MessagesResponse] {
+	return instructor.NewSession(i, memory, func(ctx context.Context, list []instructor.Message) (*anthropic.MessagesRequest, error) {
+		req := *base
+		req.Messages = slices.Clone(base.Messages)
+		for _, v := range list {
+			if v.Role == instructor.SystemRole {
+				req.System = joinText(req.System, v.Text)
+				continue
+			}
+			var msg anthropic.Message
+			if err := i.convertMessage(ctx, v, &msg); err != nil {
+				return nil, err
+			}
+			req.Messages = append(req.Messages, msg)
+		}
+		return &req, nil
+	})
+}
+
+func joinText(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + "\n\n" + b
+}
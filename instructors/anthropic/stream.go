@@ -17,6 +17,9 @@ func (i *Instructor) Stream(
 	response *anthropic.MessagesResponse,
 ) (<-chan instructor.StreamData, error) {
 	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
 	if responseType != nil {
 		if i.Encoder() == nil {
 			if enc, err := encoding.PredefinedEncoder(i.Mode(), responseType, i.SchemaNamer()); err != nil {
@@ -33,5 +36,5 @@ func (i *Instructor) Stream(
 			}
 		}
 	}
-	return i.createStream(ctx, req, response, false)
+	return i.createStream(ctx, req, response, nil, 1, "")
 }
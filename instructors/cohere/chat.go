@@ -25,16 +25,21 @@ func (i *Instructor) Chat(
 }
 
 func (i *Instructor) Handler(ctx context.Context, request *cohere.ChatRequest, response *cohere.NonStreamedChatResponse) (string, error) {
+	req := *request
+	if err := i.InjectMemory(ctx, &req.ChatHistory); err != nil {
+		return "", err
+	}
 	switch i.Mode() {
 	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
-		return i.chatToolCall(ctx, *request, response)
+		return i.chatToolCall(ctx, req, response)
 	case instructor.ModeJSON, instructor.ModeJSONSchema, instructor.ModeJSONStrict:
-		return i.completion(ctx, *request, response)
+		return i.completion(ctx, req, response)
 	default:
 		return "", fmt.Errorf("mode '%s' is not supported for %s", i.Mode(), i.Provider())
 	}
 }
 
+// chatToolCall sends the extraction tool alone, the chat API of Cohere has no tool choice so the tool choice options don't apply
 func (i *Instructor) chatToolCall(ctx context.Context, request cohere.ChatRequest, response *cohere.NonStreamedChatResponse) (string, error) {
 	var schema *instructor.Schema
 	if enc, ok := i.Encoder().(*jsonenc.Encoder); ok {
@@ -43,19 +48,25 @@ func (i *Instructor) chatToolCall(ctx context.Context, request cohere.ChatReques
 		return "", errors.New("encoder must be JSON Encoder")
 	}
 	request.Tools = []*cohere.Tool{createCohereTools(schema)}
+	if err := i.InjectMCPContext(ctx, &request.ChatHistory); err != nil {
+		return "", err
+	}
 
 	if i.Verbose() {
 		bs, _ := json.MarshalIndent(request, "", "  ")
 		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
 	}
+	if err := i.Preflight(&request); err != nil {
+		return "", err
+	}
 
 	resp, err := i.Client.Chat(ctx, &request)
-	if response != nil {
-		*response = *resp
-	}
 	if err != nil {
 		return "", err
 	}
+	if response != nil {
+		*response = *resp
+	}
 	if len(resp.ToolCalls) > 0 {
 		toolInput, err := json.Marshal(resp.ToolCalls[0].Parameters)
 		if err != nil {
@@ -81,20 +92,66 @@ func (i *Instructor) completion(ctx context.Context, request cohere.ChatRequest,
 	return i.chat(ctx, request, response)
 }
 
+// chat runs the tool loop until the model stops calling tools or hits the max tool iterations
 func (i *Instructor) chat(ctx context.Context, request cohere.ChatRequest, response *cohere.NonStreamedChatResponse) (string, error) {
-	if i.Verbose() {
-		bs, _ := json.MarshalIndent(request, "", "  ")
-		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
-	}
-
-	resp, err := i.Client.Chat(ctx, &request)
-	if response != nil {
-		*response = *resp
-	}
-	if err != nil {
+	i.InjectMCP(ctx, &request.Tools)
+	if err := i.InjectMCPContext(ctx, &request.ChatHistory); err != nil {
 		return "", err
 	}
-	return resp.Text, nil
+	memory := i.Memory()
+	if memory != nil && request.Message != "" {
+		memory.Add(instructor.Message{
+			Role: instructor.UserRole,
+			Text: request.Message,
+		})
+	}
+	var usage instructor.UsageSum
+	for iteration := 1; ; iteration++ {
+		if i.Verbose() {
+			bs, _ := json.MarshalIndent(request, "", "  ")
+			log.Printf("%s Request: %s\n", i.Provider(), string(bs))
+		}
+		if err := i.Preflight(&request); err != nil {
+			return "", err
+		}
+		resp, err := i.Client.Chat(ctx, &request)
+		if err != nil {
+			return "", err
+		}
+		i.CountUsageFromResponse(resp, &usage)
+		if response != nil {
+			*response = *resp
+			i.SetUsageSumToResponse(response, &usage)
+		}
+		if len(resp.ToolCalls) == 0 {
+			if memory != nil && resp.Text != "" {
+				memory.Add(instructor.Message{
+					Role: instructor.AssistantRole,
+					Text: resp.Text,
+				})
+			}
+			return resp.Text, nil
+		}
+		if iteration > i.MaxToolIterations() {
+			return "", instructor.ErrMaxToolIterations
+		}
+		results, _ := i.CallMCP(ctx, iteration, resp.ToolCalls)
+		if memory != nil {
+			for _, v := range []*cohere.Message{
+				{Role: "CHATBOT", Chatbot: &cohere.ChatMessage{Message: resp.Text, ToolCalls: resp.ToolCalls}},
+				{Role: "TOOL", Tool: &cohere.ChatToolMessage{ToolResults: results}},
+			} {
+				var msg instructor.Message
+				if err := ConvertMessageTo(v, &msg); err == nil {
+					memory.Add(msg)
+				}
+			}
+		}
+		// the chat history of the response already contains the message and the tool calls
+		request.ChatHistory = resp.ChatHistory
+		request.Message = ""
+		request.ToolResults = results
+	}
 }
 
 func (i *Instructor) EmptyResponseWithUsageSum(ret *cohere.NonStreamedChatResponse, usage *instructor.UsageSum) {
@@ -116,7 +173,7 @@ func (i *Instructor) EmptyResponseWithResponseUsage(ret *cohere.NonStreamedChatR
 		return
 	}
 	var resp cohere.NonStreamedChatResponse
-	if response == nil {
+	if response == nil || response.Meta == nil {
 		*ret = resp
 		return
 	}
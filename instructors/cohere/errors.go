@@ -0,0 +1,20 @@
+package cohere
+
+import (
+	"errors"
+
+	"github.com/cohere-ai/cohere-go/v2/core"
+
+	"github.com/bububa/instructor-go"
+)
+
+var _ instructor.TransientErrorChecker = (*Instructor)(nil)
+
+// IsTransientError reports if the request failed with a rate limit, a server error or a timeout
+func (i *Instructor) IsTransientError(err error) bool {
+	var apiErr *core.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode != 0 {
+		return instructor.IsTransientStatus(apiErr.StatusCode)
+	}
+	return instructor.IsTransientError(err)
+}
@@ -0,0 +1,98 @@
+package cohere
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/internal"
+)
+
+// InjectMCP appends the MCP and local tools, the chat API of Cohere has no tool choice
+// so ToolChoiceNone hides the tools and the other tool choices are ignored
+func (i *Instructor) InjectMCP(ctx context.Context, tools *[]*cohere.Tool) {
+	list := i.Tools()
+	l := len(list)
+	if choice, _ := i.ToolChoiceOf(1, ""); l == 0 || choice == instructor.ToolChoiceNone {
+		return
+	}
+	if *tools == nil {
+		*tools = make([]*cohere.Tool, 0, l)
+	}
+	for _, v := range list {
+		def := v.Definition()
+		tool := cohere.Tool{
+			Name:                 v.Name(),
+			Description:          def.Description,
+			ParameterDefinitions: make(map[string]*cohere.ToolParameterDefinitionsValue, len(def.InputSchema.Properties)),
+		}
+		for name, prop := range def.InputSchema.Properties {
+			param := &cohere.ToolParameterDefinitionsValue{
+				Type: "str",
+			}
+			if m, ok := prop.(map[string]any); ok {
+				if typ, ok := m["type"].(string); ok {
+					param.Type = toPythonType(typ)
+				}
+				if desc, ok := m["description"].(string); ok {
+					param.Description = internal.ToPtr(desc)
+				}
+			}
+			if slices.Contains(def.InputSchema.Required, name) {
+				param.Required = internal.ToPtr(true)
+			}
+			tool.ParameterDefinitions[name] = param
+		}
+		*tools = append(*tools, &tool)
+	}
+}
+
+// CallMCP executes the tool calls of the step and returns the tool results in the same order
+func (i *Instructor) CallMCP(ctx context.Context, iteration int, toolUses []*cohere.ToolCall) ([]*cohere.ToolResult, []instructor.ToolCall) {
+	calls := make([]instructor.ToolCall, 0, len(toolUses))
+	for _, v := range toolUses {
+		calls = append(calls, instructor.NewToolCall(v.Name, v.Parameters))
+	}
+	i.CallTools(ctx, iteration, calls)
+	results := make([]*cohere.ToolResult, 0, len(toolUses))
+	for idx, v := range toolUses {
+		output := make(map[string]any)
+		json.Unmarshal([]byte(calls[idx].ToolResultContent()), &output)
+		results = append(results, &cohere.ToolResult{
+			Call:    v,
+			Outputs: []map[string]any{output},
+		})
+	}
+	return results, calls
+}
+
+// toPythonType maps the JSON schema type to the python type expected by the parameter definitions
+func toPythonType(typ string) string {
+	switch typ {
+	case "integer":
+		return "int"
+	case "number":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "list"
+	case "object":
+		return "dict"
+	default:
+		return "str"
+	}
+}
+
+// InjectMCPContext prepends the messages of the MCP prompts and resources to the chat history,
+// only the text is kept as the chat history of Cohere does not support media
+func (i *Instructor) InjectMCPContext(ctx context.Context, history *[]*cohere.Message) error {
+	msgs, err := i.MCPMessages(ctx)
+	if err != nil {
+		return err
+	}
+	return i.prependHistory(ctx, history, msgs)
+}
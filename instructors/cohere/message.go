@@ -1,6 +1,7 @@
 package cohere
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 
@@ -34,7 +35,7 @@ func ConvertMessageFrom(src *instructor.Message, dist *cohere.Message) {
 			}
 			list = append(list, &msg)
 		}
-		dist.Role = "USER"
+		dist.Role = "TOOL"
 		dist.Tool = &cohere.ChatToolMessage{
 			ToolResults: list,
 		}
@@ -66,8 +67,8 @@ func ConvertMessageFrom(src *instructor.Message, dist *cohere.Message) {
 			Message: src.Text,
 		}
 	case instructor.UserRole:
-		dist.Role = "CHATBOT"
-		dist.Chatbot = &cohere.ChatMessage{
+		dist.Role = "USER"
+		dist.User = &cohere.ChatMessage{
 			Message: src.Text,
 		}
 	}
@@ -90,15 +91,62 @@ func ConvertMessageTo(src *cohere.Message, dist *instructor.Message) error {
 	} else if msg := src.User; msg != nil {
 		dist.Role = instructor.UserRole
 		dist.Text = msg.Message
+	} else if msg := src.System; msg != nil {
+		dist.Role = instructor.SystemRole
+		dist.Text = msg.Message
 	} else if msg := src.Tool; msg != nil {
 		dist.Role = instructor.ToolRole
 		for _, v := range msg.ToolResults {
-			bs, _ := json.Marshal(v.Outputs[0])
+			var content string
+			if len(v.Outputs) > 0 {
+				bs, _ := json.Marshal(v.Outputs[0])
+				content = string(bs)
+			}
 			dist.ToolResults = append(dist.ToolResults, instructor.ToolResult{
-				Name:    v.Call.Name,
-				Content: string(bs),
+				Name:    v.Call.GetName(),
+				Content: content,
 			})
 		}
+	} else {
+		return errors.New("role not support")
+	}
+	return nil
+}
+
+// InjectMemory prepends the messages of the memory to the chat history, if WithMemoryInjection is set
+func (i *Instructor) InjectMemory(ctx context.Context, history *[]*cohere.Message) error {
+	msgs, err := i.MemoryMessages(ctx)
+	if err != nil {
+		return err
+	}
+	return i.prependHistory(ctx, history, msgs)
+}
+
+// prependHistory prepends the messages to the chat history without modifying the original history
+func (i *Instructor) prependHistory(ctx context.Context, history *[]*cohere.Message, msgs []instructor.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	list := make([]*cohere.Message, 0, len(*history)+len(msgs))
+	for _, v := range msgs {
+		msg := new(cohere.Message)
+		if err := i.convertMessage(ctx, v, msg); err != nil {
+			return err
+		}
+		list = append(list, msg)
+	}
+	*history = append(list, *history...)
+	return nil
+}
+
+// convertMessage converts the message with the documents and the audio transcripts inlined as text, as Cohere only accepts text
+func (i *Instructor) convertMessage(ctx context.Context, src instructor.Message, dist *cohere.Message) error {
+	if err := i.PrepareDocuments(ctx, &src, func(string) bool { return false }); err != nil {
+		return err
+	}
+	if err := i.PrepareAudios(ctx, &src, func(*instructor.Audio) bool { return false }); err != nil {
+		return err
 	}
-	return errors.New("role not support")
+	ConvertMessageFrom(&src, dist)
+	return nil
 }
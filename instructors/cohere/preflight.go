@@ -0,0 +1,52 @@
+package cohere
+
+import (
+	"encoding/json"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+
+	"github.com/bububa/instructor-go"
+)
+
+// Preflight returns an instructor.ContextTooLargeError if the messages, the tools, the tool results and the max output tokens
+// of the request do not fit in the context window of the model, it is skipped unless WithContextPreflight is set.
+// It checks the final request of every round trip of the tool loop
+func (i *Instructor) Preflight(req *cohere.ChatRequest) error {
+	return i.preflight(req.Model, req.Preamble, req.ChatHistory, req.Message, req.Tools, req.ToolResults, req.MaxTokens)
+}
+
+func (i *Instructor) preflightStream(req *cohere.ChatStreamRequest) error {
+	return i.preflight(req.Model, req.Preamble, req.ChatHistory, req.Message, req.Tools, req.ToolResults, req.MaxTokens)
+}
+
+func (i *Instructor) preflight(model *string, preamble *string, history []*cohere.Message, message string, tools []*cohere.Tool, results []*cohere.ToolResult, maxTokens *int) error {
+	if !i.ContextPreflight() || model == nil {
+		return nil
+	}
+	list := make([]instructor.Message, 0, len(history)+2)
+	if preamble != nil {
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: *preamble})
+	}
+	for _, v := range history {
+		var msg instructor.Message
+		if err := ConvertMessageTo(v, &msg); err != nil {
+			continue
+		}
+		list = append(list, msg)
+	}
+	list = append(list, instructor.Message{Role: instructor.UserRole, Text: message})
+	// the tool definitions and the tool results are counted as their JSON
+	if len(tools) > 0 {
+		bs, _ := json.Marshal(tools)
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: string(bs)})
+	}
+	if len(results) > 0 {
+		bs, _ := json.Marshal(results)
+		list = append(list, instructor.Message{Role: instructor.ToolRole, Text: string(bs)})
+	}
+	var reserved int
+	if maxTokens != nil {
+		reserved = *maxTokens
+	}
+	return instructor.CheckContext(i.Tokenizer(*model), *model, list, reserved)
+}
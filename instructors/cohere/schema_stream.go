@@ -10,6 +10,7 @@ import (
 	"log"
 
 	cohere "github.com/cohere-ai/cohere-go/v2"
+	"github.com/cohere-ai/cohere-go/v2/core"
 
 	"github.com/bububa/instructor-go"
 	"github.com/bububa/instructor-go/internal"
@@ -36,56 +37,153 @@ func (i *Instructor) SchemaStreamHandler(ctx context.Context, request *cohere.Ch
 	return i.createStream(ctx, request, response)
 }
 
+// createStream runs the tool loop, every round trip is streamed to the same channel
+// and the aggregated meta is sent with DoneStream once the loop finished
 func (i *Instructor) createStream(ctx context.Context, request *cohere.ChatStreamRequest, response *cohere.NonStreamedChatResponse) (<-chan instructor.StreamData, error) {
-	if i.Verbose() {
-		bs, _ := json.MarshalIndent(request, "", "  ")
-		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
+	req := *request
+	if err := i.InjectMemory(ctx, &req.ChatHistory); err != nil {
+		return nil, err
+	}
+	i.InjectMCP(ctx, &req.Tools)
+	if err := i.InjectMCPContext(ctx, &req.ChatHistory); err != nil {
+		return nil, err
 	}
-	stream, err := i.ChatStream(ctx, request)
+	memory := i.Memory()
+	stream, err := i.chatStream(ctx, &req)
 	if err != nil {
 		return nil, err
 	}
+	if memory != nil && req.Message != "" {
+		memory.Add(instructor.Message{
+			Role: instructor.UserRole,
+			Text: req.Message,
+		})
+	}
 
 	ch := make(chan instructor.StreamData)
 
 	go func() {
-		defer stream.Close()
 		defer close(ch)
-		sb := new(bytes.Buffer)
-		if i.Verbose() {
-			fmt.Fprintf(sb, "%s Response: \n", i.Provider())
-			defer func() {
-				log.Println(sb.String())
-			}()
+		meta := new(instructor.ResponseMeta)
+		if model := req.Model; model != nil {
+			meta.Model = *model
 		}
-		for {
-			message, err := stream.Recv()
-			if errors.Is(err, io.EOF) {
+		defer func() {
+			if response != nil {
+				i.SetUsageSumToResponse(response, &meta.Usage)
+			}
+			internal.Send(ctx, ch, instructor.StreamData{Type: instructor.DoneStream, Meta: meta})
+		}()
+		for iteration := 1; ; iteration++ {
+			resp := i.recvStream(ctx, stream, ch, meta)
+			stream.Close()
+			if resp == nil {
+				return
+			}
+			if response != nil {
+				*response = *resp
+			}
+			if len(resp.ToolCalls) == 0 {
+				if memory != nil && resp.Text != "" {
+					memory.Add(instructor.Message{
+						Role: instructor.AssistantRole,
+						Text: resp.Text,
+					})
+				}
 				return
 			}
-			if err != nil {
+			if iteration > i.MaxToolIterations() {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: instructor.ErrMaxToolIterations})
 				return
 			}
-			switch message.EventType {
-			case "stream-start":
-				continue
-			case "stream-end":
-				if response != nil {
-					*response = *message.StreamEnd.Response
+			results, calls := i.CallMCP(i.StreamApprovalContext(ctx, ch), iteration, resp.ToolCalls)
+			for idx := range calls {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &calls[idx]})
+			}
+			if memory != nil {
+				for _, v := range []*cohere.Message{
+					{Role: "CHATBOT", Chatbot: &cohere.ChatMessage{Message: resp.Text, ToolCalls: resp.ToolCalls}},
+					{Role: "TOOL", Tool: &cohere.ChatToolMessage{ToolResults: results}},
+				} {
+					var msg instructor.Message
+					if err := ConvertMessageTo(v, &msg); err == nil {
+						memory.Add(msg)
+					}
 				}
+			}
+			// the chat history of the response already contains the message and the tool calls
+			req.ChatHistory = resp.ChatHistory
+			req.Message = ""
+			req.ToolResults = results
+			if stream, err = i.chatStream(ctx, &req); err != nil {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
 				return
-			case "tool-calls-generation":
-				if i.Verbose() {
-					sb.WriteString(*message.ToolCallsGeneration.Text)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (i *Instructor) chatStream(ctx context.Context, request *cohere.ChatStreamRequest) (*core.Stream[cohere.StreamedChatResponse], error) {
+	if i.Verbose() {
+		bs, _ := json.MarshalIndent(request, "", "  ")
+		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
+	}
+	if err := i.preflightStream(request); err != nil {
+		return nil, err
+	}
+	return i.ChatStream(ctx, request)
+}
+
+// recvStream forwards a single round trip and returns the consolidated response of the stream end
+func (i *Instructor) recvStream(ctx context.Context, stream *core.Stream[cohere.StreamedChatResponse], ch chan<- instructor.StreamData, meta *instructor.ResponseMeta) *cohere.NonStreamedChatResponse {
+	sb := new(bytes.Buffer)
+	if i.Verbose() {
+		fmt.Fprintf(sb, "%s Response: \n", i.Provider())
+		defer func() {
+			log.Println(sb.String())
+		}()
+	}
+	for {
+		message, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
+			return nil
+		}
+		switch message.EventType {
+		case "stream-start":
+			if start := message.StreamStart; start != nil {
+				meta.ID = start.GenerationId
+			}
+			continue
+		case "stream-end":
+			meta.FinishReason = string(message.StreamEnd.FinishReason)
+			resp := message.StreamEnd.Response
+			if resp != nil {
+				if resp.ResponseId != nil {
+					meta.ID = *resp.ResponseId
 				}
-				ch <- instructor.StreamData{Type: instructor.ContentStream, Content: *message.ToolCallsGeneration.Text}
-			case "text-generation":
+				var usage instructor.UsageSum
+				i.CountUsageFromResponse(resp, &usage)
+				usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+				meta.Usage.Add(usage)
+			}
+			return resp
+		case "tool-calls-generation":
+			if text := message.ToolCallsGeneration.Text; text != nil {
 				if i.Verbose() {
-					sb.WriteString(message.TextGeneration.Text)
+					sb.WriteString(*text)
 				}
-				ch <- instructor.StreamData{Type: instructor.ContentStream, Content: message.TextGeneration.Text}
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ContentStream, Content: *text})
 			}
+		case "text-generation":
+			if i.Verbose() {
+				sb.WriteString(message.TextGeneration.Text)
+			}
+			internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ContentStream, Content: message.TextGeneration.Text})
 		}
-	}()
-	return ch, nil
+	}
 }
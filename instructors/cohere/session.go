@@ -0,0 +1,43 @@
+package cohere
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+
+	"github.com/bububa/instructor-go"
+)
+
+// NewSession creates a session which replays the memory after the chat history of the base request,
+// the new turn is sent as the message of the request and the system messages of the memory are appended to the preamble
+func (i *Instructor) NewSession(base *cohere.ChatRequest, memory *instructor.Memory) *instructor.Session[cohere.ChatRequest, cohere.NonStreamedChatResponse] {
+	return instructor.NewSession(i, memory, func(ctx context.Context, list []instructor.Message) (*cohere.ChatRequest, error) {
+		req := *base
+		req.ChatHistory = slices.Clone(base.ChatHistory)
+		for idx, v := range list {
+			if v.Role == instructor.SystemRole {
+				preamble := v.Text
+				if req.Preamble != nil && *req.Preamble != "" {
+					preamble = *req.Preamble + "\n\n" + preamble
+				}
+				req.Preamble = &preamble
+				continue
+			}
+			msg := new(cohere.Message)
+			if err := i.convertMessage(ctx, v, msg); err != nil {
+				return nil, err
+			}
+			if idx == len(list)-1 {
+				if msg.User == nil {
+					return nil, errors.New("the new turn of the session must be a user message")
+				}
+				req.Message = msg.User.Message
+				break
+			}
+			req.ChatHistory = append(req.ChatHistory, msg)
+		}
+		return &req, nil
+	})
+}
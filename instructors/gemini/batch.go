@@ -0,0 +1,288 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	gemini "google.golang.org/genai"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/internal/chat"
+)
+
+var _ instructor.BatchJobInstructor[Request] = (*Instructor)(nil)
+
+// batchDisplayNameFormat keeps the number of the requests in the display name of the job,
+// as the job only reports the counts of the requests in the output file once it succeeded
+const batchDisplayNameFormat = "instructor batch of %d requests"
+
+// batchLine is a line of the JSONL input file of a batch
+type batchLine struct {
+	Key     string              `json:"key"`
+	Request batchContentRequest `json:"request"`
+}
+
+// batchContentRequest is the GenerateContentRequest of the REST API
+type batchContentRequest struct {
+	Contents          []*gemini.Content        `json:"contents"`
+	SystemInstruction *gemini.Content          `json:"systemInstruction,omitempty"`
+	Tools             []*gemini.Tool           `json:"tools,omitempty"`
+	ToolConfig        *gemini.ToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *gemini.GenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// batchOutputLine is a line of the JSONL output file of a batch, a failed request has an error instead of a response
+type batchOutputLine struct {
+	Key      string                          `json:"key"`
+	Response *gemini.GenerateContentResponse `json:"response"`
+	Error    *gemini.JobError                `json:"error"`
+}
+
+// SubmitBatchJob uploads the requests as the JSONL input file of a batch, the requests must use the same model.
+// The files are only supported by the Gemini API backend.
+func (i *Instructor) SubmitBatchJob(ctx context.Context, requests []*Request, responseType any) (*instructor.BatchJob, error) {
+	if _, err := chat.Encoder(i, responseType); err != nil {
+		return nil, err
+	}
+	var (
+		model string
+		buf   bytes.Buffer
+		enc   = json.NewEncoder(&buf)
+	)
+	for idx, v := range requests {
+		if model == "" {
+			model = v.Model
+		} else if v.Model != model {
+			return nil, fmt.Errorf("request %d: the requests of a batch must use the same model", idx)
+		}
+		req, err := i.batchRequest(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", idx, err)
+		}
+		if err := enc.Encode(batchLine{Key: instructor.BatchCustomID(idx), Request: *req}); err != nil {
+			return nil, err
+		}
+	}
+	file, err := i.Files.Upload(ctx, &buf, &gemini.UploadFileConfig{
+		DisplayName: "batch.jsonl",
+		MIMEType:    "application/jsonl",
+	})
+	if err != nil {
+		return nil, err
+	}
+	job, err := i.Batches.Create(ctx, model, &gemini.BatchJobSource{FileName: file.Name}, &gemini.CreateBatchJobConfig{
+		DisplayName: fmt.Sprintf(batchDisplayNameFormat, len(requests)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := i.convertBatch(job)
+	ret.Total = len(requests)
+	return ret, nil
+}
+
+func (i *Instructor) RetrieveBatchJob(ctx context.Context, id string) (*instructor.BatchJob, error) {
+	job, err := i.Batches.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	return i.convertBatch(job), nil
+}
+
+func (i *Instructor) CancelBatchJob(ctx context.Context, id string) error {
+	return i.Batches.Cancel(ctx, id, nil)
+}
+
+// BatchJobResults reads the output file of the job, the inlined responses of the jobs submitted inline are returned in the order of the requests
+func (i *Instructor) BatchJobResults(ctx context.Context, id string) ([]instructor.BatchJobResult, error) {
+	job, err := i.Batches.Get(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if job.Dest == nil {
+		return nil, nil
+	}
+	if job.Dest.FileName != "" {
+		return i.readBatchFile(ctx, job.Dest.FileName)
+	}
+	ret := make([]instructor.BatchJobResult, 0, len(job.Dest.InlinedResponses))
+	for idx, v := range job.Dest.InlinedResponses {
+		ret = append(ret, i.batchResult(idx, v))
+	}
+	return ret, nil
+}
+
+func (i *Instructor) DecodeBatchJobResult(text string, responseType any) error {
+	enc, err := chat.Encoder(i, responseType)
+	if err != nil {
+		return err
+	}
+	return chat.Decode(i, enc, text, responseType)
+}
+
+// readBatchFile downloads the output file and matches the lines back to the requests by key
+func (i *Instructor) readBatchFile(ctx context.Context, name string) ([]instructor.BatchJobResult, error) {
+	bs, err := i.Files.Download(ctx, gemini.NewDownloadURIFromFile(&gemini.File{DownloadURI: name}), nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret []instructor.BatchJobResult
+	scanner := bufio.NewScanner(bytes.NewReader(bs))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(bs)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var v batchOutputLine
+		if err := json.Unmarshal(line, &v); err != nil {
+			return nil, fmt.Errorf("decode batch output: %w", err)
+		}
+		idx, err := instructor.ParseBatchCustomID(v.Key)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, i.batchResult(idx, &gemini.InlinedResponse{Response: v.Response, Error: v.Error}))
+	}
+	return ret, scanner.Err()
+}
+
+// batchRequest applies the setup of the mode to the request as the Handler does,
+// the MCP tools are not sent as a batch can not run the tool loop
+func (i *Instructor) batchRequest(ctx context.Context, request *Request) (*batchContentRequest, error) {
+	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
+	var (
+		cfg        gemini.GenerateContentConfig
+		extraction string
+		err        error
+	)
+	switch i.Mode() {
+	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+		if cfg, extraction, err = i.toolCallConfig(&req); err != nil {
+			return nil, err
+		}
+		i.applyToolChoice(&cfg, 1, extraction)
+	default:
+		if cfg, err = i.completionConfig(&req, i.Mode() == instructor.ModeJSONStrict); err != nil {
+			return nil, err
+		}
+		i.setThinking(&cfg)
+	}
+	contents := make([]*gemini.Content, 0, len(req.History)+1)
+	contents = append(contents, req.History...)
+	contents = append(contents, gemini.NewContentFromParts(req.Parts, gemini.RoleUser))
+	if err := i.Preflight(req.Model, contents, &cfg); err != nil {
+		return nil, err
+	}
+	return &batchContentRequest{
+		Contents:          contents,
+		SystemInstruction: cfg.SystemInstruction,
+		Tools:             cfg.Tools,
+		ToolConfig:        cfg.ToolConfig,
+		GenerationConfig:  generationConfig(&cfg),
+	}, nil
+}
+
+// generationConfig returns the generation settings of the config, which the REST API expects apart from the instructions and the tools
+func generationConfig(cfg *gemini.GenerateContentConfig) *gemini.GenerationConfig {
+	ret := &gemini.GenerationConfig{
+		Temperature:        cfg.Temperature,
+		TopP:               cfg.TopP,
+		TopK:               cfg.TopK,
+		CandidateCount:     cfg.CandidateCount,
+		MaxOutputTokens:    cfg.MaxOutputTokens,
+		StopSequences:      cfg.StopSequences,
+		PresencePenalty:    cfg.PresencePenalty,
+		FrequencyPenalty:   cfg.FrequencyPenalty,
+		Seed:               cfg.Seed,
+		ResponseMIMEType:   cfg.ResponseMIMEType,
+		ResponseSchema:     cfg.ResponseSchema,
+		ResponseJsonSchema: cfg.ResponseJsonSchema,
+	}
+	if thinking := cfg.ThinkingConfig; thinking != nil {
+		ret.ThinkingConfig = &gemini.GenerationConfigThinkingConfig{
+			IncludeThoughts: thinking.IncludeThoughts,
+			ThinkingBudget:  thinking.ThinkingBudget,
+		}
+	}
+	return ret
+}
+
+func (i *Instructor) batchResult(idx int, v *gemini.InlinedResponse) instructor.BatchJobResult {
+	ret := instructor.BatchJobResult{Index: idx}
+	if v.Error != nil {
+		ret.Err = errors.New(v.Error.Message)
+		return ret
+	}
+	resp := v.Response
+	if resp == nil {
+		ret.Err = errors.New("empty batch response")
+		return ret
+	}
+	i.CountUsageFromResponse(resp, &ret.Usage)
+	switch i.Mode() {
+	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+		toolCalls := functionCalls(resp)
+		if len(toolCalls) == 0 {
+			ret.Err = errors.New("received no tool calls from model, expected at least 1")
+			return ret
+		}
+		ret.Text, ret.Err = toolCallsText(toolCalls)
+	default:
+		for _, cand := range resp.Candidates {
+			if cand.Content == nil {
+				continue
+			}
+			for _, part := range cand.Content.Parts {
+				if part.Text != "" && !part.Thought {
+					ret.Text = part.Text
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func (i *Instructor) convertBatch(job *gemini.BatchJob) *instructor.BatchJob {
+	ret := &instructor.BatchJob{
+		ID:       job.Name,
+		Provider: i.Provider(),
+	}
+	switch job.State {
+	case gemini.JobStateSucceeded:
+		ret.Status = instructor.BatchJobCompleted
+	case gemini.JobStateFailed:
+		ret.Status = instructor.BatchJobFailed
+	case gemini.JobStateCancelled:
+		ret.Status = instructor.BatchJobCanceled
+	case gemini.JobStateExpired:
+		ret.Status = instructor.BatchJobExpired
+	case gemini.JobStateRunning, gemini.JobStateCancelling, gemini.JobStatePaused, gemini.JobStateUpdating:
+		ret.Status = instructor.BatchJobRunning
+	default:
+		ret.Status = instructor.BatchJobPending
+	}
+	if job.Error != nil {
+		ret.Error = job.Error.Message
+	}
+	// the failed and canceled jobs have no output, the requests are counted by the display name set on submit
+	fmt.Sscanf(job.DisplayName, batchDisplayNameFormat, &ret.Total)
+	if job.Dest != nil && len(job.Dest.InlinedResponses) > 0 {
+		ret.Total = len(job.Dest.InlinedResponses)
+		for _, v := range job.Dest.InlinedResponses {
+			if v.Error != nil {
+				ret.Failed++
+			} else {
+				ret.Succeeded++
+			}
+		}
+	}
+	return ret
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"slices"
 
 	"github.com/invopop/jsonschema"
 	gemini "google.golang.org/genai"
@@ -25,35 +26,62 @@ func (i *Instructor) Chat(
 }
 
 func (i *Instructor) Handler(ctx context.Context, request *Request, response *gemini.GenerateContentResponse) (string, error) {
+	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return "", err
+	}
 	switch i.Mode() {
 	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
-		return i.chatToolCall(ctx, *request, response)
+		return i.chatToolCall(ctx, req, response)
 	case instructor.ModeJSONStrict:
-		return i.completion(ctx, *request, response, true)
+		return i.completion(ctx, req, response, true)
 	default:
-		return i.completion(ctx, *request, response, false)
+		return i.completion(ctx, req, response, false)
 	}
 }
 
-func (i *Instructor) chatToolCall(ctx context.Context, request Request, response *gemini.GenerateContentResponse) (string, error) {
-	var schema *instructor.Schema
-	if enc, ok := i.Encoder().(*jsonenc.Encoder); ok {
-		schema = enc.Schema()
-	} else {
-		return "", errors.New("encoder must be JSON Encoder")
+// toolCallConfig returns the config with the schema of the encoder as the tools and the name of the extraction tool
+func (i *Instructor) toolCallConfig(request *Request) (gemini.GenerateContentConfig, string, error) {
+	enc, ok := i.Encoder().(*jsonenc.Encoder)
+	if !ok {
+		return gemini.GenerateContentConfig{}, "", errors.New("encoder must be JSON Encoder")
 	}
-
 	cfg := gemini.GenerateContentConfig{
 		ResponseMIMEType:  "application/json",
 		SystemInstruction: request.System,
-		Tools:             createTools(schema),
+		Tools:             createTools(enc.Schema()),
+	}
+	i.setThinking(&cfg)
+	return cfg, extractionTool(cfg.Tools), nil
+}
+
+// extractionTool returns the name of the extraction function of the tools created by createTools
+func extractionTool(tools []*gemini.Tool) string {
+	if len(tools) == 0 || len(tools[0].FunctionDeclarations) == 0 {
+		return ""
 	}
+	return tools[0].FunctionDeclarations[0].Name
+}
+
+// setThinking sets the thinking config to the config
+func (i *Instructor) setThinking(cfg *gemini.GenerateContentConfig) {
 	if thinkingConfig := i.ThinkingConfig(); thinkingConfig != nil {
 		cfg.ThinkingConfig = &gemini.ThinkingConfig{
 			IncludeThoughts: thinkingConfig.Enabled,
 			ThinkingBudget:  internal.ToPtr(int32(thinkingConfig.Budget)),
 		}
 	}
+}
+
+func (i *Instructor) chatToolCall(ctx context.Context, request Request, response *gemini.GenerateContentResponse) (string, error) {
+	cfg, extraction, err := i.toolCallConfig(&request)
+	if err != nil {
+		return "", err
+	}
+	if err := i.InjectMCPContext(ctx, &request.History); err != nil {
+		return "", err
+	}
+	i.applyToolChoice(&cfg, 1, extraction)
 
 	if i.Verbose() {
 		cfgBytes, _ := json.MarshalIndent(cfg, "", "  ")
@@ -64,10 +92,12 @@ func (i *Instructor) chatToolCall(ctx context.Context, request Request, response
 
 	var (
 		resp    *gemini.GenerateContentResponse
-		err     error
 		memory  = i.Memory()
 		content = gemini.NewContentFromParts(request.Parts, gemini.RoleUser)
 	)
+	if err := i.Preflight(request.Model, append(slices.Clip(request.History), content), &cfg); err != nil {
+		return "", err
+	}
 	if memory != nil {
 		var msg instructor.Message
 		ConvertMessageTo(content, &msg)
@@ -94,19 +124,7 @@ func (i *Instructor) chatToolCall(ctx context.Context, request Request, response
 		*response = *resp
 	}
 
-	var toolCalls []gemini.FunctionCall
-	for _, cand := range resp.Candidates {
-		if cand.Content == nil {
-			continue
-		}
-		for _, part := range cand.Content.Parts {
-			if toolCall := part.FunctionCall; toolCall != nil {
-				toolCalls = append(toolCalls, *toolCall)
-				break
-			}
-		}
-	}
-
+	toolCalls := functionCalls(resp)
 	numTools := len(toolCalls)
 
 	if numTools < 1 {
@@ -128,40 +146,55 @@ func (i *Instructor) chatToolCall(ctx context.Context, request Request, response
 			ToolUses: calls,
 		})
 	}
+	text, err := toolCallsText(toolCalls)
+	if err != nil {
+		i.EmptyResponseWithResponseUsage(response, resp)
+		return "", err
+	}
+	return text, nil
+}
 
-	if numTools == 1 {
-		if response != nil {
-			*response = *resp
+// functionCalls returns the first function call of every candidate
+func functionCalls(resp *gemini.GenerateContentResponse) []gemini.FunctionCall {
+	var toolCalls []gemini.FunctionCall
+	for _, cand := range resp.Candidates {
+		if cand.Content == nil {
+			continue
 		}
+		for _, part := range cand.Content.Parts {
+			if toolCall := part.FunctionCall; toolCall != nil {
+				toolCalls = append(toolCalls, *toolCall)
+				break
+			}
+		}
+	}
+	return toolCalls
+}
+
+// toolCallsText returns the arguments of a single tool call, or the JSON array of the arguments of the tool calls
+func toolCallsText(toolCalls []gemini.FunctionCall) (string, error) {
+	if len(toolCalls) == 1 {
 		resultJSON, err := json.Marshal(toolCalls[0].Args)
 		if err != nil {
-			i.EmptyResponseWithResponseUsage(response, resp)
 			return "", err
 		}
 		return string(resultJSON), nil
 	}
-
 	jsonArray := make([]map[string]any, len(toolCalls))
-
 	for idx, toolCall := range toolCalls {
 		jsonArray[idx] = toolCall.Args
 	}
-
 	resultJSON, err := json.Marshal(jsonArray)
 	if err != nil {
-		i.EmptyResponseWithResponseUsage(response, resp)
 		return "", err
 	}
-
-	if response != nil {
-		*response = *resp
-	}
 	return string(resultJSON), nil
 }
 
-func (i *Instructor) completion(ctx context.Context, request Request, response *gemini.GenerateContentResponse, strict bool) (string, error) {
+// completionConfig appends the output schema to the parts of the request and returns the config of the response format
+func (i *Instructor) completionConfig(request *Request, strict bool) (gemini.GenerateContentConfig, error) {
 	if bs := i.Encoder().Context(); bs != nil {
-		request.Parts = append(request.Parts, &gemini.Part{Text: string(bs)})
+		request.Parts = append(slices.Clip(request.Parts), &gemini.Part{Text: string(bs)})
 	}
 
 	cfg := gemini.GenerateContentConfig{
@@ -177,12 +210,20 @@ func (i *Instructor) completion(ctx context.Context, request Request, response *
 	}
 	if strict {
 		if !isJSON {
-			return "", errors.New("encoder must be JSON Encoder")
+			return cfg, errors.New("encoder must be JSON Encoder")
 		}
 		schema := enc.Schema()
 		cfg.ResponseSchema = new(gemini.Schema)
 		convertSchema(schema.Schema, cfg.ResponseSchema)
 	}
+	return cfg, nil
+}
+
+func (i *Instructor) completion(ctx context.Context, request Request, response *gemini.GenerateContentResponse, strict bool) (string, error) {
+	cfg, err := i.completionConfig(&request, strict)
+	if err != nil {
+		return "", err
+	}
 	if memory := i.Memory(); memory != nil {
 		var msg instructor.Message
 		ConvertMessageTo(gemini.NewContentFromParts(request.Parts, gemini.RoleUser), &msg)
@@ -191,111 +232,91 @@ func (i *Instructor) completion(ctx context.Context, request Request, response *
 	return i.chat(ctx, cfg, request, response)
 }
 
+// chat runs the tool loop until the model stops calling tools or hits the max tool iterations
 func (i *Instructor) chat(ctx context.Context, cfg gemini.GenerateContentConfig, request Request, response *gemini.GenerateContentResponse) (string, error) {
-	if thinkingConfig := i.ThinkingConfig(); thinkingConfig != nil {
-		cfg.ThinkingConfig = &gemini.ThinkingConfig{
-			IncludeThoughts: thinkingConfig.Enabled,
-			ThinkingBudget:  internal.ToPtr(int32(thinkingConfig.Budget)),
-		}
-	}
+	i.setThinking(&cfg)
 	i.InjectMCP(ctx, &cfg)
-	if i.Verbose() {
-		cfgBytes, _ := json.MarshalIndent(cfg, "", "  ")
-		bs, _ := json.MarshalIndent(request, "", "  ")
-		log.Printf(`%s Request: %s
-      Request Config: %s\n`, i.Provider(), string(bs), string(cfgBytes))
-	}
 	var (
-		resp *gemini.GenerateContentResponse
-		err  error
+		memory   = i.Memory()
+		usage    gemini.GenerateContentResponseUsageMetadata
+		contents = make([]*gemini.Content, 0, len(request.History)+1)
 	)
-	if len(request.History) > 0 {
-		cs, err := i.Chats.Create(ctx, request.Model, &cfg, request.History)
+	contents = append(contents, request.History...)
+	contents = append(contents, gemini.NewContentFromParts(request.Parts, gemini.RoleUser))
+	if err := i.InjectMCPContext(ctx, &contents); err != nil {
+		return "", err
+	}
+	for iteration := 1; ; iteration++ {
+		i.applyToolChoice(&cfg, iteration, "")
+		if i.Verbose() {
+			cfgBytes, _ := json.MarshalIndent(cfg, "", "  ")
+			bs, _ := json.MarshalIndent(contents, "", "  ")
+			log.Printf(`%s Request: %s
+      Request Config: %s\n`, i.Provider(), string(bs), string(cfgBytes))
+		}
+		if err := i.Preflight(request.Model, contents, &cfg); err != nil {
+			return "", err
+		}
+		resp, err := i.Models.GenerateContent(ctx, request.Model, contents, &cfg)
 		if err != nil {
 			return "", err
 		}
-		parts := make([]gemini.Part, 0, len(request.Parts))
-		for _, part := range request.Parts {
-			parts = append(parts, *part)
+		if resp.UsageMetadata != nil {
+			usage.PromptTokenCount += resp.UsageMetadata.PromptTokenCount
+			usage.CandidatesTokenCount += resp.UsageMetadata.CandidatesTokenCount
+			usage.TotalTokenCount += resp.UsageMetadata.TotalTokenCount
 		}
-		resp, err = cs.SendMessage(ctx, parts...)
-	} else {
-		resp, err = i.Models.GenerateContent(ctx, request.Model, []*gemini.Content{
-			gemini.NewContentFromParts(request.Parts, gemini.RoleUser),
-		}, &cfg)
-	}
-
-	if err != nil {
-		return "", err
-	}
-	var usage gemini.GenerateContentResponseUsageMetadata
-	if response != nil {
-		*response = *resp
-		if response.UsageMetadata != nil {
-			usage = *response.UsageMetadata
-		}
-	}
-	var (
-		toolCalls         []gemini.FunctionCall
-		functionCallParts []*gemini.Part
-		responseText      string
-		memory            = i.Memory()
-	)
-	for _, cand := range resp.Candidates {
-		if cand.Content == nil {
-			continue
+		if response != nil {
+			*response = *resp
+			sum := usage
+			response.UsageMetadata = &sum
 		}
-		for _, part := range cand.Content.Parts {
-			if fcCall := part.FunctionCall; fcCall != nil {
-				toolCalls = append(toolCalls, *fcCall)
-				functionCallParts = append(functionCallParts, gemini.NewPartFromFunctionCall(fcCall.Name, fcCall.Args))
+		var (
+			toolCalls         []gemini.FunctionCall
+			functionCallParts []*gemini.Part
+			responseText      string
+		)
+		for _, cand := range resp.Candidates {
+			if cand.Content == nil {
+				continue
 			}
-			if text := part.Text; text != "" {
-				responseText = text
+			for _, part := range cand.Content.Parts {
+				if fcCall := part.FunctionCall; fcCall != nil {
+					toolCalls = append(toolCalls, *fcCall)
+					// keep the original part with the thought signature
+					functionCallParts = append(functionCallParts, part)
+				}
+				if text := part.Text; text != "" && !part.Thought {
+					responseText = text
+				}
 			}
 		}
-	}
-	if len(toolCalls) > 0 {
-		oldMessagesCount := len(request.History)
-		request.History = append(request.History, gemini.NewContentFromParts(functionCallParts, gemini.RoleModel))
-		parts := make([]*gemini.Part, 0, len(toolCalls))
-		for _, toolCall := range toolCalls {
-			part, call := i.CallMCP(ctx, &toolCall)
-			if call != nil && i.Verbose() {
-				bs, _ := json.MarshalIndent(call, "", "  ")
-				log.Printf("%s ToolCall Result: %s\n", i.Provider(), string(bs))
+		if len(toolCalls) == 0 {
+			if memory != nil && responseText != "" {
+				memory.Add(instructor.Message{
+					Role: instructor.AssistantRole,
+					Text: responseText,
+				})
 			}
-			parts = append(parts, part)
+			return responseText, nil
 		}
-		request.History = append(request.History, gemini.NewContentFromParts(parts, "function"))
-		if newMessagesCount := len(request.History); newMessagesCount > oldMessagesCount && memory != nil {
-			for _, v := range request.History[oldMessagesCount:newMessagesCount] {
+		if iteration > i.MaxToolIterations() {
+			return "", instructor.ErrMaxToolIterations
+		}
+		parts, _ := i.CallMCP(ctx, iteration, toolCalls)
+		newContents := []*gemini.Content{
+			gemini.NewContentFromParts(functionCallParts, gemini.RoleModel),
+			gemini.NewContentFromParts(parts, "function"),
+		}
+		if memory != nil {
+			for _, v := range newContents {
 				var msg instructor.Message
 				ConvertMessageTo(v, &msg)
 				memory.Add(msg)
 			}
 		}
-		responseText, err = i.chat(ctx, cfg, request, response)
-		if response != nil {
-			if response.UsageMetadata == nil {
-				response.UsageMetadata = &usage
-			} else {
-				response.UsageMetadata.PromptTokenCount += usage.PromptTokenCount
-				response.UsageMetadata.CandidatesTokenCount += usage.CandidatesTokenCount
-				response.UsageMetadata.TotalTokenCount += usage.TotalTokenCount
-			}
-		}
-		if err != nil {
-			return "", err
-		}
+		contents = append(contents, newContents...)
 	}
-	if memory != nil && responseText != "" {
-		memory.Add(instructor.Message{
-			Role: instructor.AssistantRole,
-			Text: responseText,
-		})
-	}
-	return responseText, nil
 }
 
 func (i *Instructor) EmptyResponseWithUsageSum(ret *gemini.GenerateContentResponse, usage *instructor.UsageSum) {
@@ -347,20 +368,31 @@ func (i *Instructor) CountUsageFromResponse(response *gemini.GenerateContentResp
 }
 
 func convertSchema(src *jsonschema.Schema, dist *gemini.Schema) {
-	dist.Type = gemini.TypeObject
+	dist.Type = toType(src.Type)
+	if dist.Type == gemini.TypeUnspecified {
+		dist.Type = gemini.TypeObject
+	}
 	dist.Format = src.Format
 	dist.Description = src.Description
-	dist.Enum = make([]string, 0, len(src.Enum))
-	for _, v := range src.Enum {
-		if str, ok := v.(string); ok {
-			dist.Enum = append(dist.Enum, str)
+	if len(src.Enum) > 0 {
+		dist.Enum = make([]string, 0, len(src.Enum))
+		for _, v := range src.Enum {
+			if str, ok := v.(string); ok {
+				dist.Enum = append(dist.Enum, str)
+			}
 		}
 	}
-	dist.Properties = make(map[string]*gemini.Schema, src.Properties.Len())
-	for pair := src.Properties.Oldest(); pair != nil; pair.Next() {
-		schema := new(gemini.Schema)
-		convertSchema(pair.Value, schema)
-		dist.Properties[pair.Key] = schema
+	if src.Items != nil {
+		dist.Items = new(gemini.Schema)
+		convertSchema(src.Items, dist.Items)
+	}
+	if src.Properties != nil {
+		dist.Properties = make(map[string]*gemini.Schema, src.Properties.Len())
+		for pair := src.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			schema := new(gemini.Schema)
+			convertSchema(pair.Value, schema)
+			dist.Properties[pair.Key] = schema
+		}
 	}
 	dist.Required = src.Required
 }
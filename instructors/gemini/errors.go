@@ -0,0 +1,20 @@
+package gemini
+
+import (
+	"errors"
+
+	gemini "google.golang.org/genai"
+
+	"github.com/bububa/instructor-go"
+)
+
+var _ instructor.TransientErrorChecker = (*Instructor)(nil)
+
+// IsTransientError reports if the request failed with a rate limit, a server error or a timeout
+func (i *Instructor) IsTransientError(err error) bool {
+	var apiErr gemini.APIError
+	if errors.As(err, &apiErr) {
+		return instructor.IsTransientStatus(apiErr.Code)
+	}
+	return instructor.IsTransientError(err)
+}
@@ -3,7 +3,6 @@ package gemini
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	gemini "google.golang.org/genai"
@@ -12,19 +11,22 @@ import (
 	"github.com/bububa/instructor-go/internal"
 )
 
+// InjectMCP appends the MCP and local tools, the tools are hidden with ToolChoiceNone
 func (i *Instructor) InjectMCP(ctx context.Context, req *gemini.GenerateContentConfig) {
-	l := len(i.MCPTools())
-	if l == 0 {
+	tools := i.Tools()
+	l := len(tools)
+	if choice, _ := i.ToolChoiceOf(1, ""); l == 0 || choice == instructor.ToolChoiceNone {
 		return
 	}
 	if req.Tools == nil {
 		req.Tools = make([]*gemini.Tool, 0, l)
 	}
-	for _, v := range i.MCPTools() {
+	for _, v := range tools {
+		def := v.Definition()
 		f := gemini.FunctionDeclaration{
-			Name:        fmt.Sprintf("%s_%s", v.ServerName, v.Tool.GetName()),
-			Description: v.Tool.Description,
-			Parameters:  translateToGeminiSchema(v.Tool.InputSchema),
+			Name:        v.Name(),
+			Description: def.Description,
+			Parameters:  translateToGeminiSchema(def.InputSchema),
 		}
 		t := gemini.Tool{
 			FunctionDeclarations: []*gemini.FunctionDeclaration{&f},
@@ -33,30 +35,22 @@ func (i *Instructor) InjectMCP(ctx context.Context, req *gemini.GenerateContentC
 	}
 }
 
-func (i *Instructor) CallMCP(ctx context.Context, toolUse *gemini.FunctionCall) (*gemini.Part, *instructor.ToolCall) {
-	toolContent := make(map[string]any)
-	for _, v := range i.MCPTools() {
-		if name := fmt.Sprintf("%s_%s", v.ServerName, v.Tool.GetName()); name == toolUse.Name {
-			ret := new(instructor.ToolCall)
-			ret.Request = new(mcp.CallToolRequest)
-			ret.Request.Params.Name = v.Tool.GetName()
-			ret.Request.Params.Arguments = toolUse.Args
-			if result, err := v.Client.CallTool(ctx, *ret.Request); err != nil {
-				ret.Result = mcp.NewToolResultError(fmt.Sprintf("tool call error: %v", err))
-			} else {
-				ret.Result = result
-			}
-			if bs, err := json.Marshal(ret.Result); err == nil {
-				json.Unmarshal(bs, &toolContent)
-			}
-			return gemini.NewPartFromFunctionResponse(toolUse.Name, toolContent), ret
-		}
+// CallMCP executes the tool calls of the step and returns the function response parts in the same order
+func (i *Instructor) CallMCP(ctx context.Context, iteration int, toolUses []gemini.FunctionCall) ([]*gemini.Part, []instructor.ToolCall) {
+	calls := make([]instructor.ToolCall, 0, len(toolUses))
+	for _, v := range toolUses {
+		calls = append(calls, instructor.NewToolCall(v.Name, v.Args))
 	}
-	toolRet := mcp.NewToolResultError("invalid tool name")
-	if bs, err := json.Marshal(toolRet); err == nil {
-		json.Unmarshal(bs, &toolContent)
+	i.CallTools(ctx, iteration, calls)
+	parts := make([]*gemini.Part, 0, len(toolUses))
+	for idx, v := range toolUses {
+		toolContent := make(map[string]any)
+		json.Unmarshal([]byte(calls[idx].ToolResultContent()), &toolContent)
+		part := gemini.NewPartFromFunctionResponse(v.Name, toolContent)
+		part.FunctionResponse.ID = v.ID
+		parts = append(parts, part)
 	}
-	return gemini.NewPartFromFunctionResponse(toolUse.Name, toolContent), nil
+	return parts, calls
 }
 
 func translateToGeminiSchema(schema mcp.ToolInputSchema) *gemini.Schema {
@@ -130,3 +124,42 @@ func toType(typ string) gemini.Type {
 		return gemini.TypeUnspecified
 	}
 }
+
+// InjectMCPContext prepends the contents of the MCP prompts and resources to the contents of the request
+func (i *Instructor) InjectMCPContext(ctx context.Context, contents *[]*gemini.Content) error {
+	msgs, err := i.MCPMessages(ctx)
+	if err != nil {
+		return err
+	}
+	return i.prependContents(ctx, contents, msgs)
+}
+
+// applyToolChoice sets the function calling config of the step of the tool loop,
+// extraction is the name of the extraction function in the tool call modes, empty otherwise
+func (i *Instructor) applyToolChoice(cfg *gemini.GenerateContentConfig, iteration int, extraction string) {
+	if len(cfg.Tools) == 0 {
+		return
+	}
+	choice, name := i.ToolChoiceOf(iteration, extraction)
+	if choice == "" {
+		return
+	}
+	fc := new(gemini.FunctionCallingConfig)
+	switch choice {
+	case instructor.ToolChoiceRequired:
+		fc.Mode = gemini.FunctionCallingConfigModeAny
+		if name != "" {
+			fc.AllowedFunctionNames = []string{name}
+		}
+	case instructor.ToolChoiceNone:
+		fc.Mode = gemini.FunctionCallingConfigModeNone
+	default:
+		fc.Mode = gemini.FunctionCallingConfigModeAuto
+	}
+	toolConfig := new(gemini.ToolConfig)
+	if cfg.ToolConfig != nil {
+		*toolConfig = *cfg.ToolConfig
+	}
+	toolConfig.FunctionCallingConfig = fc
+	cfg.ToolConfig = toolConfig
+}
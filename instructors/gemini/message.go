@@ -2,12 +2,12 @@ package gemini
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -17,6 +17,12 @@ import (
 )
 
 func ConvertMessageFrom(src *instructor.Message, dist *gemini.Content) error {
+	return ConvertMessageFromContext(context.Background(), instructor.DefaultMediaLoader, src, dist)
+}
+
+// ConvertMessageFromContext converts the message with the images and videos loaded by the loader,
+// the media which fails to load is reported as error
+func ConvertMessageFromContext(ctx context.Context, loader instructor.MediaLoader, src *instructor.Message, dist *gemini.Content) error {
 	if len(src.ToolUses) > 0 {
 		list := make([]*gemini.Part, 0, len(src.ToolUses))
 		for _, v := range src.ToolUses {
@@ -41,25 +47,28 @@ func ConvertMessageFrom(src *instructor.Message, dist *gemini.Content) error {
 			part := gemini.NewPartFromFunctionResponse(v.Name, args)
 			list = append(list, part)
 		}
-		dist.Role = gemini.RoleModel
+		dist.Role = "function"
 		dist.Parts = list
 		return nil
 	}
-	if src.Role != instructor.SystemRole && src.Role != instructor.AssistantRole {
+	if src.Role == instructor.SystemRole {
 		return errors.New("do not support role")
 	}
 	list := make([]*gemini.Part, 0, len(src.Files)+len(src.Audios)+len(src.Images)+1)
 	var buf bytes.Buffer
 	for _, v := range src.Files {
-		mediaTypeStr := "text/plain"
 		data, err := base64.StdEncoding.DecodeString(v.Data)
 		if err != nil {
-			continue
+			return fmt.Errorf("decode file %s: %w", v.Name, err)
 		}
-		buf.Reset()
-		buf.Write(data)
-		if mediaType, err := mimetype.DetectReader(&buf); err == nil {
-			mediaTypeStr = mediaType.String()
+		mediaTypeStr := v.MimeType
+		if mediaTypeStr == "" {
+			mediaTypeStr = "text/plain"
+			buf.Reset()
+			buf.Write(data)
+			if mediaType, err := mimetype.DetectReader(&buf); err == nil {
+				mediaTypeStr = mediaType.String()
+			}
 		}
 		part := gemini.NewPartFromBytes(data, mediaTypeStr)
 		list = append(list, part)
@@ -67,7 +76,7 @@ func ConvertMessageFrom(src *instructor.Message, dist *gemini.Content) error {
 	for _, v := range src.Audios {
 		data, err := base64.StdEncoding.DecodeString(v.Data)
 		if err != nil {
-			continue
+			return fmt.Errorf("decode audio: %w", err)
 		}
 		mediaTypeStr := fmt.Sprintf("audio/%s", v.Format)
 		if v.Format == "" {
@@ -81,32 +90,18 @@ func ConvertMessageFrom(src *instructor.Message, dist *gemini.Content) error {
 		list = append(list, part)
 	}
 	for _, v := range src.Videos {
-		buf.Reset()
-		if err := DataFromURL(v.URL, &buf); err != nil {
-			continue
-		}
-		bs := buf.Bytes()
-		mediaTypeStr := "video/mp4"
-		mediaType, err := mimetype.DetectReader(&buf)
-		if err == nil {
-			mediaTypeStr = mediaType.String()
+		media, err := loader.Load(ctx, v.URL)
+		if err != nil {
+			return fmt.Errorf("load video: %w", err)
 		}
-		part := gemini.NewPartFromBytes(bs, mediaTypeStr)
-		list = append(list, part)
+		list = append(list, gemini.NewPartFromBytes(media.Data, media.MimeType))
 	}
 	for _, v := range src.Images {
-		buf.Reset()
-		if err := DataFromURL(v.URL, &buf); err != nil {
-			continue
-		}
-		bs := buf.Bytes()
-		mediaTypeStr := "image/jpeg"
-		mediaType, err := mimetype.DetectReader(&buf)
-		if err == nil {
-			mediaTypeStr = mediaType.String()
+		media, err := loader.Load(ctx, v.URL)
+		if err != nil {
+			return fmt.Errorf("load image: %w", err)
 		}
-		part := gemini.NewPartFromBytes(bs, mediaTypeStr)
-		list = append(list, part)
+		list = append(list, gemini.NewPartFromBytes(media.Data, media.MimeType))
 	}
 	if src.Text != "" {
 		list = append(list, gemini.NewPartFromText(src.Text))
@@ -186,15 +181,15 @@ func ConvertMessageTo(src *gemini.Content, dist *instructor.Message) {
 						URL: uri,
 					})
 				} else if strings.HasPrefix(source.MIMEType, "audio") {
-					data := base64.StdEncoding.EncodeToString(buf.Bytes())
 					dist.Audios = append(dist.Audios, instructor.Audio{
 						Data:   data,
-						Format: uri,
+						Format: strings.TrimPrefix(source.MIMEType, "audio/"),
 					})
 				} else {
 					dist.Files = append(dist.Files, instructor.File{
-						Data: data,
-						Name: source.DisplayName,
+						Data:     data,
+						Name:     source.DisplayName,
+						MimeType: source.MIMEType,
 					})
 				}
 			}
@@ -205,28 +200,57 @@ func ConvertMessageTo(src *gemini.Content, dist *instructor.Message) {
 	}
 }
 
+// DataFromURL writes the data of the link to w
+//
+// Deprecated: use instructor.MediaLoader which respects the context and limits the size
 func DataFromURL(link string, w io.Writer) error {
-	if strings.HasPrefix(link, "data:") && strings.Contains(link, ";base64,") {
-		b64 := link
-		parts := strings.Split(b64, ",")
-		if len(parts) == 2 {
-			b64 = strings.TrimSpace(parts[1])
-		}
-		if bs, err := base64.StdEncoding.DecodeString(b64); err != nil {
-			return err
-		} else {
-			w.Write(bs)
-		}
-		return nil
+	media, err := instructor.DefaultMediaLoader.Load(context.Background(), link)
+	if err != nil {
+		return err
 	}
-	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
-		return errors.New("invalid link")
+	_, err = w.Write(media.Data)
+	return err
+}
+
+// SupportsDocument reports if the documents of the MIME type are sent as inline data, the other documents are prepared by PrepareDocuments
+func SupportsDocument(mimeType string) bool {
+	return mimeType == "application/pdf" || strings.HasPrefix(mimeType, "text/")
+}
+
+// convertMessage converts the message with the media loader and the documents prepared for Gemini
+func (i *Instructor) convertMessage(ctx context.Context, src instructor.Message, dist *gemini.Content) error {
+	if err := i.PrepareDocuments(ctx, &src, SupportsDocument); err != nil {
+		return err
 	}
-	resp, err := http.Get(link)
+	return ConvertMessageFromContext(ctx, i.MediaLoader(), &src, dist)
+}
+
+// InjectMemory prepends the messages of the memory to the history of the request, if WithMemoryInjection is set
+func (i *Instructor) InjectMemory(ctx context.Context, req *Request) error {
+	msgs, err := i.MemoryMessages(ctx)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	io.Copy(w, resp.Body)
+	return i.prependContents(ctx, &req.History, msgs)
+}
+
+// prependContents prepends the messages to the contents without modifying the original contents,
+// the system messages are skipped as the system instruction is set by the request
+func (i *Instructor) prependContents(ctx context.Context, contents *[]*gemini.Content, msgs []instructor.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	list := make([]*gemini.Content, 0, len(*contents)+len(msgs))
+	for _, v := range msgs {
+		if v.Role == instructor.SystemRole {
+			continue
+		}
+		content := new(gemini.Content)
+		if err := i.convertMessage(ctx, v, content); err != nil {
+			return err
+		}
+		list = append(list, content)
+	}
+	*contents = append(list, *contents...)
 	return nil
 }
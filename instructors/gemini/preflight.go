@@ -0,0 +1,39 @@
+package gemini
+
+import (
+	"encoding/json"
+
+	gemini "google.golang.org/genai"
+
+	"github.com/bububa/instructor-go"
+)
+
+// Preflight returns an instructor.ContextTooLargeError if the contents, the system instruction, the tools, the response schema
+// and the max output tokens of the config do not fit in the context window of the model, it is skipped unless WithContextPreflight is set.
+// It checks the final request of every round trip of the tool loop
+func (i *Instructor) Preflight(model string, contents []*gemini.Content, cfg *gemini.GenerateContentConfig) error {
+	if !i.ContextPreflight() {
+		return nil
+	}
+	list := make([]instructor.Message, 0, len(contents)+3)
+	if cfg.SystemInstruction != nil {
+		var msg instructor.Message
+		ConvertMessageTo(cfg.SystemInstruction, &msg)
+		list = append(list, msg)
+	}
+	for _, v := range contents {
+		var msg instructor.Message
+		ConvertMessageTo(v, &msg)
+		list = append(list, msg)
+	}
+	// the definitions sent besides the contents are counted as their JSON
+	if len(cfg.Tools) > 0 {
+		bs, _ := json.Marshal(cfg.Tools)
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: string(bs)})
+	}
+	if cfg.ResponseSchema != nil {
+		bs, _ := json.Marshal(cfg.ResponseSchema)
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: string(bs)})
+	}
+	return instructor.CheckContext(i.Tokenizer(model), model, list, int(cfg.MaxOutputTokens))
+}
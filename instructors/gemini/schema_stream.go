@@ -30,13 +30,17 @@ func (i *Instructor) SchemaStream(
 }
 
 func (i *Instructor) SchemaStreamHandler(ctx context.Context, request *Request, response *gemini.GenerateContentResponse) (<-chan instructor.StreamData, error) {
+	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
 	switch i.Mode() {
 	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
-		return i.chatToolCallStream(ctx, *request, response)
+		return i.chatToolCallStream(ctx, req, response)
 	case instructor.ModeJSON:
-		return i.chatJSONStream(ctx, *request, response, false)
+		return i.chatJSONStream(ctx, req, response, false)
 	case instructor.ModeJSONStrict, instructor.ModeJSONSchema:
-		return i.chatJSONStream(ctx, *request, response, true)
+		return i.chatJSONStream(ctx, req, response, true)
 	default:
 		return nil, fmt.Errorf("mode '%s' is not supported for %s", i.Mode(), i.Provider())
 	}
@@ -54,7 +58,7 @@ func (i *Instructor) chatToolCallStream(ctx context.Context, request Request, re
 		SystemInstruction: request.System,
 		Tools:             createTools(schema),
 	}
-	return i.stream(ctx, cfg, request, response, false)
+	return i.stream(ctx, cfg, request, response, extractionTool(cfg.Tools))
 }
 
 func (i *Instructor) chatJSONStream(ctx context.Context, request Request, response *gemini.GenerateContentResponse, strict bool) (<-chan instructor.StreamData, error) {
@@ -78,10 +82,12 @@ func (i *Instructor) chatJSONStream(ctx context.Context, request Request, respon
 		schema := enc.Schema()
 		convertSchema(schema.Schema, cfg.ResponseSchema)
 	}
-	return i.stream(ctx, cfg, request, response, false)
+	return i.stream(ctx, cfg, request, response, "")
 }
 
-func (i *Instructor) stream(ctx context.Context, cfg gemini.GenerateContentConfig, request Request, response *gemini.GenerateContentResponse, reRun bool) (<-chan instructor.StreamData, error) {
+// stream runs the tool loop, every round trip is streamed to the same channel
+// and the aggregated meta is sent with DoneStream once the loop finished, extraction is the name of the extraction tool in the tool call modes
+func (i *Instructor) stream(ctx context.Context, cfg gemini.GenerateContentConfig, request Request, response *gemini.GenerateContentResponse, extraction string) (<-chan instructor.StreamData, error) {
 	if thinkingConfig := i.ThinkingConfig(); thinkingConfig != nil {
 		cfg.ThinkingConfig = &gemini.ThinkingConfig{
 			IncludeThoughts: thinkingConfig.Enabled,
@@ -90,176 +96,194 @@ func (i *Instructor) stream(ctx context.Context, cfg gemini.GenerateContentConfi
 	}
 	content := gemini.NewContentFromParts(request.Parts, gemini.RoleUser)
 	memory := i.Memory()
-	if !reRun {
-		i.InjectMCP(ctx, &cfg)
+	i.InjectMCP(ctx, &cfg)
+	if memory != nil {
 		var msg instructor.Message
 		ConvertMessageTo(content, &msg)
 		memory.Add(msg)
 	}
-
-	if i.Verbose() {
-		cfgBytes, _ := json.MarshalIndent(cfg, "", "  ")
-		bs, _ := json.MarshalIndent(request, "", "  ")
-		log.Printf(`%s Request: %s
-      Request Config: %s\n`, i.Provider(), string(bs), string(cfgBytes))
-	}
-	contents := make([]*gemini.Content, len(request.History)+1)
+	contents := make([]*gemini.Content, 0, len(request.History)+1)
 	contents = append(contents, request.History...)
 	contents = append(contents, content)
-	iter := i.Models.GenerateContentStream(ctx, request.Model, contents, &cfg)
+	if err := i.InjectMCPContext(ctx, &contents); err != nil {
+		return nil, err
+	}
+	if err := i.Preflight(request.Model, contents, &cfg); err != nil {
+		return nil, err
+	}
+	meta := new(instructor.ResponseMeta)
 	outCh := make(chan instructor.StreamData)
 	go func() {
 		defer close(outCh)
-		var toolRequest Request
-		defer func() {
-			oldMessagesCount := len(toolRequest.History)
-			if oldMessagesCount > 0 {
-				request.History = append(request.History, toolRequest.History...)
-				tmpCh, err := i.stream(ctx, cfg, request, response, true)
-				if err != nil {
-					return
-				}
-				if newMessagesCount := len(request.History); newMessagesCount > oldMessagesCount && memory != nil {
-					for _, v := range request.History[oldMessagesCount:newMessagesCount] {
-						var msg instructor.Message
-						ConvertMessageTo(v, &msg)
-						memory.Add(msg)
-					}
-				}
-				for v := range tmpCh {
-					outCh <- v
-				}
-			}
-		}()
-		var usage gemini.GenerateContentResponseUsageMetadata
-		if response != nil && response.UsageMetadata != nil {
-			usage = *response.UsageMetadata
-		}
 		defer func() {
 			if response != nil {
 				if response.UsageMetadata == nil {
-					response.UsageMetadata = &usage
-				} else {
-					response.UsageMetadata.PromptTokenCount += usage.PromptTokenCount
-					response.UsageMetadata.CandidatesTokenCount += usage.CandidatesTokenCount
-					response.UsageMetadata.TotalTokenCount += usage.TotalTokenCount
+					response.UsageMetadata = new(gemini.GenerateContentResponseUsageMetadata)
 				}
+				response.UsageMetadata.PromptTokenCount = int32(meta.Usage.InputTokens)
+				response.UsageMetadata.CandidatesTokenCount = int32(meta.Usage.OutputTokens)
+				response.UsageMetadata.TotalTokenCount = int32(meta.Usage.TotalTokens)
 			}
+			internal.Send(ctx, outCh, instructor.StreamData{Type: instructor.DoneStream, Meta: meta})
 		}()
-		ch, err := i.createStream(ctx, &cfg, iter, response, &toolRequest)
-		if err != nil {
-			return
-		}
 		var bs strings.Builder
-		for part := range ch {
-			if !reRun && part.Type == instructor.ContentStream {
-				bs.WriteString(part.Content)
+		defer func() {
+			if text := bs.String(); text != "" && memory != nil {
+				memory.Add(instructor.Message{
+					Role: instructor.AssistantRole,
+					Text: text,
+				})
 			}
-			outCh <- part
-		}
-		if text := bs.String(); text != "" && memory != nil {
-			memory.Add(instructor.Message{
-				Role: instructor.AssistantRole,
-				Text: text,
-			})
+		}()
+		for iteration := 1; ; iteration++ {
+			i.applyToolChoice(&cfg, iteration, extraction)
+			// the first request is checked before streaming
+			if iteration > 1 {
+				if err := i.Preflight(request.Model, contents, &cfg); err != nil {
+					internal.Send(ctx, outCh, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
+					return
+				}
+			}
+			if i.Verbose() {
+				cfgBytes, _ := json.MarshalIndent(cfg, "", "  ")
+				bs, _ := json.MarshalIndent(contents, "", "  ")
+				log.Printf(`%s Request: %s
+      Request Config: %s\n`, i.Provider(), string(bs), string(cfgBytes))
+			}
+			var (
+				iter      = i.Models.GenerateContentStream(ctx, request.Model, contents, &cfg)
+				toolCalls []*gemini.Part
+			)
+			ch, err := i.createStream(ctx, iter, response, &toolCalls, meta)
+			if err != nil {
+				internal.Send(ctx, outCh, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
+				return
+			}
+			for part := range ch {
+				if part.Type == instructor.ContentStream {
+					bs.WriteString(part.Content)
+				}
+				internal.Send(ctx, outCh, part)
+			}
+			if len(toolCalls) == 0 {
+				return
+			}
+			// the extraction tool calls are the final answer, the items are parsed by the schema stream handler
+			var extracted bool
+			for _, part := range toolCalls {
+				toolCall := part.FunctionCall
+				if _, ok := i.LookupTool(toolCall.Name); ok {
+					continue
+				}
+				for _, tool := range cfg.Tools {
+					for _, fn := range tool.FunctionDeclarations {
+						if fn.Name == toolCall.Name {
+							callReq := new(mcp.CallToolRequest)
+							callReq.Params.Name = toolCall.Name
+							callReq.Params.Arguments = toolCall.Args
+							internal.Send(ctx, outCh, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &instructor.ToolCall{Request: callReq}})
+							extracted = true
+						}
+					}
+				}
+			}
+			if extracted {
+				return
+			}
+			if iteration > i.MaxToolIterations() {
+				internal.Send(ctx, outCh, instructor.StreamData{Type: instructor.ErrorStream, Err: instructor.ErrMaxToolIterations})
+				return
+			}
+			functionCalls := make([]gemini.FunctionCall, 0, len(toolCalls))
+			for _, part := range toolCalls {
+				functionCalls = append(functionCalls, *part.FunctionCall)
+			}
+			parts, calls := i.CallMCP(i.StreamApprovalContext(ctx, outCh), iteration, functionCalls)
+			for idx := range calls {
+				internal.Send(ctx, outCh, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &calls[idx]})
+			}
+			newContents := []*gemini.Content{
+				gemini.NewContentFromParts(toolCalls, gemini.RoleModel),
+				gemini.NewContentFromParts(parts, "function"),
+			}
+			if memory != nil {
+				for _, v := range newContents {
+					var msg instructor.Message
+					ConvertMessageTo(v, &msg)
+					memory.Add(msg)
+				}
+			}
+			contents = append(contents, newContents...)
+			// only the text of the final answer is kept in memory
+			bs.Reset()
 		}
 	}()
 	return outCh, nil
 }
 
-func (i *Instructor) createStream(ctx context.Context, cfg *gemini.GenerateContentConfig, iter iter.Seq2[*gemini.GenerateContentResponse, error], response *gemini.GenerateContentResponse, toolRequest *Request) (<-chan instructor.StreamData, error) {
+// createStream streams a single round trip, the function call parts are collected to toolCalls in order
+func (i *Instructor) createStream(ctx context.Context, iter iter.Seq2[*gemini.GenerateContentResponse, error], response *gemini.GenerateContentResponse, toolCalls *[]*gemini.Part, meta *instructor.ResponseMeta) (<-chan instructor.StreamData, error) {
 	ch := make(chan instructor.StreamData)
 
 	go func() {
 		defer close(ch)
+		// every chunk carries the usage of the response so far, only the last one is summed up
+		var usage *gemini.GenerateContentResponseUsageMetadata
+		defer func() {
+			if usage != nil {
+				meta.Usage.Add(instructor.UsageSum{
+					InputTokens:  int64(usage.PromptTokenCount),
+					OutputTokens: int64(usage.CandidatesTokenCount),
+					TotalTokens:  int64(usage.TotalTokenCount),
+				})
+			}
+		}()
 		sb := new(bytes.Buffer)
 		if i.Verbose() {
 			defer func() {
 				log.Printf("%s Response: %s\n", i.Provider(), sb.String())
 			}()
 		}
-		toolCallMap := make(map[int32]gemini.FunctionCall)
-		toolCallInput := make(map[int32]string)
-		defer func() {
-			toolCalls := make([]gemini.FunctionCall, 0, len(toolCallMap))
-			parts := make([]*gemini.Part, 0, len(toolCallMap))
-			for idx, toolCall := range toolCallMap {
-				if input, ok := toolCallInput[idx]; ok {
-					if err := json.Unmarshal([]byte(input), &toolCall.Args); err != nil {
-						toolCalls = append(toolCalls, toolCall)
-						parts = append(parts, gemini.NewPartFromFunctionCall(toolCall.Name, toolCall.Args))
-					}
-				}
-			}
-			if len(toolCalls) == 0 {
-				return
-			}
-			toolRequest.History = append(toolRequest.History, gemini.NewContentFromParts(parts, gemini.RoleModel))
-			contents := make([]*gemini.Part, 0, len(toolCalls))
-			for _, toolCall := range toolCalls {
-				part, call := i.CallMCP(ctx, &toolCall)
-				if call != nil {
-					ch <- instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: call}
-				} else {
-					var shouldReturn bool
-					for _, tool := range cfg.Tools {
-						for _, fn := range tool.FunctionDeclarations {
-							if fn.Name == toolCall.Name {
-								callReq := new(mcp.CallToolRequest)
-								callReq.Params.Name = toolCall.Name
-								callReq.Params.Arguments = toolCall.Args
-								call := instructor.ToolCall{
-									Request: callReq,
-								}
-								ch <- instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &call}
-								shouldReturn = true
-							}
-						}
-					}
-					if shouldReturn {
-						toolRequest.History = nil
-						return
-					}
-				}
-				contents = append(contents, part)
-			}
-			toolRequest.History = append(toolRequest.History, gemini.NewContentFromParts(contents, "function"))
-		}()
 		for resp, err := range iter {
 			if err == iterator.Done {
 				return
 			}
 			if err != nil {
-				ch <- instructor.StreamData{Type: instructor.ErrorStream, Err: err}
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
 				return
 			}
 			if response != nil {
 				response.UsageMetadata = resp.UsageMetadata
 			}
+			if resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata
+			}
+			if resp.ResponseID != "" {
+				meta.ID = resp.ResponseID
+			}
+			if resp.ModelVersion != "" {
+				meta.Model = resp.ModelVersion
+			}
 			for _, cand := range resp.Candidates {
+				if cand.FinishReason != "" {
+					meta.FinishReason = string(cand.FinishReason)
+				}
 				if cand.Content == nil {
 					continue
 				}
 				for _, part := range cand.Content.Parts {
-					if fcCall := part.FunctionCall; fcCall != nil {
-						if _, ok := toolCallMap[cand.Index]; !ok {
-							toolCallMap[cand.Index] = gemini.FunctionCall{
-								ID:   fcCall.ID,
-								Name: fcCall.Name,
-							}
-						}
-						if fcCall.Args != nil {
-							bs, _ := json.Marshal(fcCall.Args)
-							toolCallInput[cand.Index] += string(bs)
-						}
+					if part.FunctionCall != nil {
+						// function calls are streamed as whole parts, keep them with the thought signature
+						*toolCalls = append(*toolCalls, part)
+						continue
 					}
 					if part.Thought {
-						ch <- instructor.StreamData{Type: instructor.ThinkingStream, Content: part.Text}
+						internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ThinkingStream, Content: part.Text})
 					} else if text := part.Text; text != "" {
 						if i.Verbose() {
 							sb.WriteString(text)
 						}
-						ch <- instructor.StreamData{Type: instructor.ContentStream, Content: text}
+						internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ContentStream, Content: text})
 					}
 				}
 			}
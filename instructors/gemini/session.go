@@ -0,0 +1,43 @@
+package gemini
+
+import (
+	"context"
+	"slices"
+
+	gemini "google.golang.org/genai"
+
+	"github.com/bububa/instructor-go"
+)
+
+// NewSession creates a session which replays the memory after the history of the base request,
+// the new turn is sent as the parts of the request and the system messages of the memory are appended to the system instruction
+func (i *Instructor) NewSession(base *Request, memory *instructor.Memory) *instructor.Session[Request, gemini.GenerateContentResponse] {
+	return instructor.NewSession(i, memory, func(ctx context.Context, list []instructor.Message) (*Request, error) {
+		req := *base
+		req.History = slices.Clone(base.History)
+		req.Parts = nil
+		for idx, v := range list {
+			if v.Role == instructor.SystemRole {
+				if req.System == nil {
+					req.System = &gemini.Content{Role: gemini.RoleUser}
+				} else {
+					system := *req.System
+					system.Parts = slices.Clone(system.Parts)
+					req.System = &system
+				}
+				req.System.Parts = append(req.System.Parts, gemini.NewPartFromText(v.Text))
+				continue
+			}
+			content := new(gemini.Content)
+			if err := i.convertMessage(ctx, v, content); err != nil {
+				return nil, err
+			}
+			if idx == len(list)-1 {
+				req.Parts = content.Parts
+				break
+			}
+			req.History = append(req.History, content)
+		}
+		return &req, nil
+	})
+}
@@ -21,6 +21,9 @@ func (i *Instructor) Stream(
 	}
 
 	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
 	if responseType != nil {
 		if i.Encoder() == nil {
 			if enc, err := encoding.PredefinedEncoder(i.Mode(), responseType, i.SchemaNamer()); err != nil {
@@ -38,5 +41,5 @@ func (i *Instructor) Stream(
 			cfg.ResponseMIMEType = "text/plain"
 		}
 	}
-	return i.stream(ctx, cfg, req, response, false)
+	return i.stream(ctx, cfg, req, response, "")
 }
@@ -0,0 +1,249 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/internal/chat"
+)
+
+var _ instructor.BatchJobInstructor[openai.ChatCompletionNewParams] = (*Instructor)(nil)
+
+// batchLine is a line of the input file of a batch
+type batchLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchOutputLine is a line of the output or the error file of a batch
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitBatchJob uploads the requests as the JSONL input file of a batch of the chat completions endpoint
+func (i *Instructor) SubmitBatchJob(ctx context.Context, requests []*openai.ChatCompletionNewParams, responseType any) (*instructor.BatchJob, error) {
+	if _, err := chat.Encoder(i, responseType); err != nil {
+		return nil, err
+	}
+	var (
+		buf bytes.Buffer
+		enc = json.NewEncoder(&buf)
+	)
+	for idx, v := range requests {
+		req, err := i.batchRequest(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", idx, err)
+		}
+		body, err := req.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", idx, err)
+		}
+		if err := enc.Encode(batchLine{
+			CustomID: instructor.BatchCustomID(idx),
+			Method:   "POST",
+			URL:      string(openai.BatchNewParamsEndpointV1ChatCompletions),
+			Body:     body,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	file, err := i.Client.Files.New(ctx, openai.FileNewParams{
+		File:    openai.File(&buf, "batch.jsonl", "application/jsonl"),
+		Purpose: openai.FilePurposeBatch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	batch, err := i.Client.Batches.New(ctx, openai.BatchNewParams{
+		InputFileID:      file.ID,
+		Endpoint:         openai.BatchNewParamsEndpointV1ChatCompletions,
+		CompletionWindow: openai.BatchNewParamsCompletionWindow24h,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return i.convertBatch(batch), nil
+}
+
+func (i *Instructor) RetrieveBatchJob(ctx context.Context, id string) (*instructor.BatchJob, error) {
+	batch, err := i.Client.Batches.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return i.convertBatch(batch), nil
+}
+
+func (i *Instructor) CancelBatchJob(ctx context.Context, id string) error {
+	_, err := i.Client.Batches.Cancel(ctx, id)
+	return err
+}
+
+// BatchJobResults reads the output file and the error file of the batch
+func (i *Instructor) BatchJobResults(ctx context.Context, id string) ([]instructor.BatchJobResult, error) {
+	batch, err := i.Client.Batches.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var ret []instructor.BatchJobResult
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		results, err := i.readBatchFile(ctx, fileID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, results...)
+	}
+	return ret, nil
+}
+
+func (i *Instructor) DecodeBatchJobResult(text string, responseType any) error {
+	enc, err := chat.Encoder(i, responseType)
+	if err != nil {
+		return err
+	}
+	return chat.Decode(i, enc, text, responseType)
+}
+
+// batchRequest applies the setup of the mode to the request as the Handler does,
+// the MCP tools are not sent as a batch can not run the tool loop
+func (i *Instructor) batchRequest(ctx context.Context, request *openai.ChatCompletionNewParams) (*openai.ChatCompletionNewParams, error) {
+	req := *request
+	i.setExtraFields(&req)
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
+	switch i.Mode() {
+	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+		extraction, err := i.setToolCallFormat(&req)
+		if err != nil {
+			return nil, err
+		}
+		i.applyToolChoice(&req, 1, extraction)
+	case instructor.ModeJSON, instructor.ModeJSONSchema, instructor.ModeJSONStrict:
+		if _, err := i.setJSONFormat(&req); err != nil {
+			return nil, err
+		}
+	default:
+		i.setSchemaContext(&req)
+	}
+	if err := i.Preflight(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (i *Instructor) readBatchFile(ctx context.Context, fileID string) ([]instructor.BatchJobResult, error) {
+	resp, err := i.Client.Files.Content(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var (
+		ret     []instructor.BatchJobResult
+		scanner = bufio.NewScanner(resp.Body)
+	)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var output batchOutputLine
+		if err := json.Unmarshal(line, &output); err != nil {
+			return nil, err
+		}
+		idx, err := instructor.ParseBatchCustomID(output.CustomID)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, i.batchResult(idx, &output))
+	}
+	return ret, scanner.Err()
+}
+
+func (i *Instructor) batchResult(idx int, output *batchOutputLine) instructor.BatchJobResult {
+	ret := instructor.BatchJobResult{Index: idx}
+	if output.Error != nil {
+		ret.Err = fmt.Errorf("%s: %s", output.Error.Code, output.Error.Message)
+		return ret
+	}
+	if output.Response == nil {
+		ret.Err = errors.New("empty batch response")
+		return ret
+	}
+	if output.Response.StatusCode != 200 {
+		ret.Err = fmt.Errorf("batch response status %d: %s", output.Response.StatusCode, output.Response.Body)
+		return ret
+	}
+	var resp openai.ChatCompletion
+	if ret.Err = json.Unmarshal(output.Response.Body, &resp); ret.Err != nil {
+		return ret
+	}
+	i.CountUsageFromResponse(&resp, &ret.Usage)
+	if len(resp.Choices) == 0 {
+		ret.Err = errors.New("received no choices from model")
+		return ret
+	}
+	msg := resp.Choices[0].Message
+	switch i.Mode() {
+	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
+		if len(msg.ToolCalls) == 0 {
+			ret.Err = errors.New("received no tool calls from model, expected at least 1")
+			return ret
+		}
+		ret.Text, ret.Err = toolCallsText(msg.ToolCalls)
+	default:
+		ret.Text = msg.Content
+	}
+	return ret
+}
+
+func (i *Instructor) convertBatch(batch *openai.Batch) *instructor.BatchJob {
+	job := &instructor.BatchJob{
+		ID:        batch.ID,
+		Provider:  i.Provider(),
+		Total:     int(batch.RequestCounts.Total),
+		Succeeded: int(batch.RequestCounts.Completed),
+		Failed:    int(batch.RequestCounts.Failed),
+	}
+	switch batch.Status {
+	case openai.BatchStatusValidating:
+		job.Status = instructor.BatchJobPending
+	case openai.BatchStatusCompleted:
+		job.Status = instructor.BatchJobCompleted
+	case openai.BatchStatusFailed:
+		job.Status = instructor.BatchJobFailed
+	case openai.BatchStatusExpired:
+		job.Status = instructor.BatchJobExpired
+	case openai.BatchStatusCancelled:
+		job.Status = instructor.BatchJobCanceled
+	default:
+		job.Status = instructor.BatchJobRunning
+	}
+	msgs := make([]string, 0, len(batch.Errors.Data))
+	for _, v := range batch.Errors.Data {
+		msgs = append(msgs, v.Message)
+	}
+	job.Error = strings.Join(msgs, "; ")
+	return job
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"maps"
+	"slices"
 
 	// "github.com/bububa/ljson"
 	"github.com/invopop/jsonschema"
@@ -32,6 +33,12 @@ func (i *Instructor) Chat(
 	response *openai.ChatCompletion,
 ) error {
 	req := *request
+	i.setExtraFields(&req)
+	return chat.Handler(i, ctx, &req, responseType, response)
+}
+
+// setExtraFields sets the extra body and the thinking config to the request
+func (i *Instructor) setExtraFields(req *openai.ChatCompletionNewParams) {
 	extraFields := req.ExtraFields()
 	if extraBody := i.ExtraBody(); extraBody != nil {
 		if extraFields == nil {
@@ -71,11 +78,13 @@ func (i *Instructor) Chat(
 		}
 	}
 	req.SetExtraFields(extraFields)
-	return chat.Handler(i, ctx, &req, responseType, response)
 }
 
 func (i *Instructor) Handler(ctx context.Context, request *openai.ChatCompletionNewParams, response *openai.ChatCompletion) (string, error) {
 	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return "", err
+	}
 	switch i.Mode() {
 	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
 		return i.chatToolCall(ctx, req, response)
@@ -87,13 +96,17 @@ func (i *Instructor) Handler(ctx context.Context, request *openai.ChatCompletion
 }
 
 func (i *Instructor) chatToolCall(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion) (string, error) {
-	var schema *instructor.Schema
-	if enc, ok := i.Encoder().(*jsonenc.Encoder); ok {
-		schema = enc.Schema()
-	} else {
-		return "", errors.New("encoder must be JSON Encoder")
+	extraction, err := i.setToolCallFormat(&request)
+	if err != nil {
+		return "", err
+	}
+	if err := i.InjectMCPContext(ctx, &request); err != nil {
+		return "", err
+	}
+	i.applyToolChoice(&request, 1, extraction)
+	if err := i.Preflight(&request); err != nil {
+		return "", err
 	}
-	request.Tools = createOpenAITools(schema, i.Mode() == instructor.ModeToolCallStrict)
 	if i.Verbose() {
 		bs, _ := request.MarshalJSON()
 		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
@@ -134,51 +147,95 @@ func (i *Instructor) chatToolCall(ctx context.Context, request openai.ChatComple
 		}
 	}
 
-	numTools := len(toolCalls)
-
-	if numTools < 1 {
+	if len(toolCalls) < 1 {
 		i.EmptyResponseWithResponseUsage(response, resp)
 		return "", errors.New("received no tool calls from model, expected at least 1")
 	}
+	text, err := toolCallsText(toolCalls)
+	if err != nil {
+		i.EmptyResponseWithResponseUsage(response, resp)
+		return "", err
+	}
+	if response != nil {
+		*response = *resp
+	}
+	return text, nil
+}
 
-	if numTools == 1 {
-		if response != nil {
-			*response = *resp
-		}
-		return toolCalls[0].Function.Arguments, nil
+// setToolCallFormat sets the schema of the encoder as the tools of the request and returns the name of the extraction tool
+func (i *Instructor) setToolCallFormat(request *openai.ChatCompletionNewParams) (string, error) {
+	enc, ok := i.Encoder().(*jsonenc.Encoder)
+	if !ok {
+		return "", errors.New("encoder must be JSON Encoder")
 	}
+	request.Tools = createOpenAITools(enc.Schema(), i.Mode() == instructor.ModeToolCallStrict)
+	return extractionTool(request.Tools), nil
+}
 
-	// numTools >= 1
+// extractionTool returns the name of the extraction tool of the tools created by createOpenAITools
+func extractionTool(tools []openai.ChatCompletionToolParam) string {
+	if len(tools) == 0 {
+		return ""
+	}
+	return tools[0].Function.Name
+}
 
+// toolCallsText returns the arguments of a single tool call, or the JSON array of the arguments of the tool calls
+func toolCallsText(toolCalls []openai.ChatCompletionMessageToolCall) (string, error) {
+	if len(toolCalls) == 1 {
+		return toolCalls[0].Function.Arguments, nil
+	}
 	jsonArray := make([]map[string]any, len(toolCalls))
-
 	for idx, toolCall := range toolCalls {
 		var jsonObj map[string]any
 		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &jsonObj); err != nil {
-			i.EmptyResponseWithResponseUsage(response, resp)
 			return "", err
 		}
 		jsonArray[idx] = jsonObj
 	}
-
 	resultJSON, err := json.Marshal(jsonArray)
 	if err != nil {
-		i.EmptyResponseWithResponseUsage(response, resp)
 		return "", err
 	}
-
-	if response != nil {
-		*response = *resp
-	}
 	return string(resultJSON), nil
 }
 
 func (i *Instructor) chatJSON(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion) (string, error) {
+	lastIdx, err := i.setJSONFormat(&request)
+	if err != nil {
+		return "", err
+	}
+	memory := i.Memory()
+	if memory != nil && lastIdx >= 0 {
+		var msg instructor.Message
+		if err := ConvertMessageTo(&request.Messages[lastIdx], &msg); err == nil {
+			memory.Add(msg)
+		}
+	}
+
+	text, err := i.chatCompletionWrapper(ctx, request, response)
+	if err != nil {
+		return "", err
+	}
+
+	// if i.Mode() == instructor.ModeJSONStrict || i.Mode() == instructor.ModeJSONSchema {
+	// 	resMap := make(map[string]any)
+	// 	_ = ljson.Unmarshal([]byte(text), &resMap)
+	//
+	// 	cleanedText, _ := json.Marshal(resMap[structName])
+	// 	text = string(cleanedText)
+	// }
+	return text, nil
+}
+
+// setJSONFormat sets the response format of the mode and adds the output schema to the system message,
+// or to the last message without a system message, it returns the index of the last message
+func (i *Instructor) setJSONFormat(request *openai.ChatCompletionNewParams) (int, error) {
 	var schema *instructor.Schema
 	if enc, ok := i.Encoder().(*jsonenc.Encoder); ok {
 		schema = enc.Schema()
 	} else {
-		return "", errors.New("encoder must be JSON Encoder")
+		return -1, errors.New("encoder must be JSON Encoder")
 	}
 	structName := schema.NameFromRef()
 
@@ -186,11 +243,15 @@ func (i *Instructor) chatJSON(ctx context.Context, request openai.ChatCompletion
 		hasSystem bool
 		lastIdx   = -1
 	)
+	request.Messages = slices.Clone(request.Messages)
 	for idx, msg := range request.Messages {
 		if system := msg.OfSystem; system != nil {
 			bs := i.Encoder().Context()
 			if bs != nil {
+				// copy the system message shared with the original request
+				system := *system
 				system.Content.OfString = openai.String(fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", system.Content.OfString.Value, string(bs)))
+				msg.OfSystem = &system
 				request.Messages[idx] = msg
 				hasSystem = true
 			}
@@ -212,14 +273,17 @@ func (i *Instructor) chatJSON(ctx context.Context, request openai.ChatCompletion
 	} else {
 		if !hasSystem && lastIdx >= 0 {
 			bs := i.Encoder().Context()
-			if msg := request.Messages[lastIdx].OfUser; msg != nil {
-				request.Messages[lastIdx].OfUser.Content.OfString = openai.String(fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", msg.Content.OfString.Value, string(bs)))
-			}
+			appendUserText(&request.Messages[lastIdx], fmt.Sprintf("\n\n#OUTPUT SCHEMA\n%s", string(bs)))
 		}
 		request.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
 			OfJSONObject: new(openai.ResponseFormatJSONObjectParam),
 		}
 	}
+	return lastIdx, nil
+}
+
+func (i *Instructor) chatCompletion(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion) (string, error) {
+	lastIdx := i.setSchemaContext(&request)
 	memory := i.Memory()
 	if memory != nil && lastIdx >= 0 {
 		var msg instructor.Message
@@ -227,101 +291,89 @@ func (i *Instructor) chatJSON(ctx context.Context, request openai.ChatCompletion
 			memory.Add(msg)
 		}
 	}
-
-	text, err := i.chatCompletionWrapper(ctx, request, response)
-	if err != nil {
-		return "", err
-	}
-
-	// if i.Mode() == instructor.ModeJSONStrict || i.Mode() == instructor.ModeJSONSchema {
-	// 	resMap := make(map[string]any)
-	// 	_ = ljson.Unmarshal([]byte(text), &resMap)
-	//
-	// 	cleanedText, _ := json.Marshal(resMap[structName])
-	// 	text = string(cleanedText)
-	// }
-	return text, nil
+	// request.Messages = internal.Prepend(request.Messages, *createJSONMessage(schema))
+	return i.chatCompletionWrapper(ctx, request, response)
 }
 
-func (i *Instructor) chatCompletion(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion) (string, error) {
+// setSchemaContext adds the output schema to the system messages, it returns the index of the last message
+func (i *Instructor) setSchemaContext(request *openai.ChatCompletionNewParams) int {
 	lastIdx := -1
+	request.Messages = slices.Clone(request.Messages)
 	for idx, msg := range request.Messages {
 		if system := msg.OfSystem; system != nil {
 			bs := i.Encoder().Context()
 			if bs != nil {
+				// copy the system message shared with the original request
+				system := *system
 				system.Content.OfString = openai.String(fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", system.Content.OfString.Value, string(bs)))
+				msg.OfSystem = &system
 				request.Messages[idx] = msg
 			}
 		}
 		lastIdx = idx
 	}
-	memory := i.Memory()
-	if memory != nil && lastIdx >= 0 {
-		var msg instructor.Message
-		if err := ConvertMessageTo(&request.Messages[lastIdx], &msg); err == nil {
-			memory.Add(msg)
-		}
-	}
-	// request.Messages = internal.Prepend(request.Messages, *createJSONMessage(schema))
-	return i.chatCompletionWrapper(ctx, request, response)
+	return lastIdx
 }
 
+// chatCompletionWrapper runs the tool loop until the model stops calling tools or hits the max tool iterations
 func (i *Instructor) chatCompletionWrapper(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion) (string, error) {
 	i.InjectMCP(ctx, &request)
-	if i.Verbose() {
-		bs, _ := request.MarshalJSON()
-		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
-	}
-	memory := i.Memory()
-	resp, err := i.Client.Chat.Completions.New(ctx, request)
-	if err != nil {
+	if err := i.InjectMCPContext(ctx, &request); err != nil {
 		return "", err
 	}
-	if i.Verbose() {
-		log.Printf("%s Response: %s\n", i.Provider(), resp.RawJSON())
-	}
-	if response != nil {
-		*response = *resp
-	}
-	toolCalls := resp.Choices[0].Message.ToolCalls
-	if len(toolCalls) > 0 {
-		oldMessagesCount := len(request.Messages)
-		request.Messages = append(request.Messages, resp.Choices[0].Message.ToParam())
-		for _, toolCall := range toolCalls {
-			if call := i.CallMCP(ctx, &toolCall, &request); call != nil && i.Verbose() {
-				bs, _ := json.MarshalIndent(call, "", "  ")
-				log.Printf("%s ToolCall Result: %s\n", i.Provider(), string(bs))
+	var (
+		memory = i.Memory()
+		usage  openai.CompletionUsage
+	)
+	for iteration := 1; ; iteration++ {
+		i.applyToolChoice(&request, iteration, "")
+		if i.Verbose() {
+			bs, _ := request.MarshalJSON()
+			log.Printf("%s Request: %s\n", i.Provider(), string(bs))
+		}
+		if err := i.Preflight(&request); err != nil {
+			return "", err
+		}
+		resp, err := i.Client.Chat.Completions.New(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		if i.Verbose() {
+			log.Printf("%s Response: %s\n", i.Provider(), resp.RawJSON())
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+		if response != nil {
+			*response = *resp
+			response.Usage = usage
+		}
+		toolCalls := resp.Choices[0].Message.ToolCalls
+		if len(toolCalls) == 0 {
+			text := resp.Choices[0].Message.Content
+			if memory != nil {
+				memory.Add(instructor.Message{
+					Role: instructor.AssistantRole,
+					Text: text,
+				})
 			}
+			return text, nil
 		}
-		if newMessagesCount := len(request.Messages); newMessagesCount > oldMessagesCount && memory != nil {
-			for _, v := range request.Messages[oldMessagesCount:newMessagesCount] {
+		if iteration > i.MaxToolIterations() {
+			return "", instructor.ErrMaxToolIterations
+		}
+		oldMessagesCount := len(request.Messages)
+		request.Messages = append(request.Messages, resp.Choices[0].Message.ToParam())
+		i.CallMCP(ctx, iteration, toolCalls, &request)
+		if memory != nil {
+			for _, v := range request.Messages[oldMessagesCount:] {
 				var msg instructor.Message
 				if err := ConvertMessageTo(&v, &msg); err == nil {
 					memory.Add(msg)
 				}
 			}
 		}
-		var usage openai.CompletionUsage
-		if response != nil {
-			*response = *resp
-			usage = response.Usage
-		}
-		text, err := i.chatCompletionWrapper(ctx, request, response)
-		if response != nil {
-			response.Usage.PromptTokens += usage.PromptTokens
-			response.Usage.CompletionTokens += usage.CompletionTokens
-			response.Usage.TotalTokens += usage.TotalTokens
-		}
-		return text, err
 	}
-	text := resp.Choices[0].Message.Content
-	if memory != nil {
-		memory.Add(instructor.Message{
-			Role: instructor.AssistantRole,
-			Text: text,
-		})
-	}
-	return text, nil
 }
 
 func (i *Instructor) EmptyResponseWithUsageSum(ret *openai.ChatCompletion, usage *instructor.UsageSum) {
@@ -0,0 +1,20 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+)
+
+var _ instructor.TransientErrorChecker = (*Instructor)(nil)
+
+// IsTransientError reports if the request failed with a rate limit, a server error or a timeout
+func (i *Instructor) IsTransientError(err error) bool {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return instructor.IsTransientStatus(apiErr.StatusCode)
+	}
+	return instructor.IsTransientError(err)
+}
@@ -2,31 +2,31 @@ package openai
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 
 	"github.com/bububa/instructor-go"
-	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/openai/openai-go"
 )
 
+// InjectMCP appends the MCP and local tools, the tools are hidden with ToolChoiceNone
 func (i *Instructor) InjectMCP(ctx context.Context, req *openai.ChatCompletionNewParams) {
-	l := len(i.MCPTools())
-	if l == 0 {
+	tools := i.Tools()
+	l := len(tools)
+	if choice, _ := i.ToolChoiceOf(1, ""); l == 0 || choice == instructor.ToolChoiceNone {
 		return
 	}
 	if req.Tools == nil {
 		req.Tools = make([]openai.ChatCompletionToolParam, 0, l)
 	}
-	for _, v := range i.MCPTools() {
+	for _, v := range tools {
+		def := v.Definition()
 		tool := openai.ChatCompletionToolParam{
 			Function: openai.FunctionDefinitionParam{
-				Name:        fmt.Sprintf("%s_%s", v.ServerName, v.Tool.GetName()),
-				Description: openai.String(v.Tool.Description),
+				Name:        v.Name(),
+				Description: openai.String(def.Description),
 				Parameters: openai.FunctionParameters{
-					"type":       v.Tool.InputSchema.Type,
-					"required":   v.Tool.InputSchema.Required,
-					"properties": v.Tool.InputSchema.Properties,
+					"type":       def.InputSchema.Type,
+					"required":   def.InputSchema.Required,
+					"properties": def.InputSchema.Properties,
 				},
 			},
 		}
@@ -34,37 +34,42 @@ func (i *Instructor) InjectMCP(ctx context.Context, req *openai.ChatCompletionNe
 	}
 }
 
-func (i *Instructor) CallMCP(ctx context.Context, toolUse *openai.ChatCompletionMessageToolCall, req *openai.ChatCompletionNewParams) *instructor.ToolCall {
-	var toolContent string
-	for _, v := range i.MCPTools() {
-		if name := fmt.Sprintf("%s_%s", v.ServerName, v.Tool.GetName()); name == toolUse.Function.Name {
-			var toolArgs map[string]any
-			ret := new(instructor.ToolCall)
-			if err := json.Unmarshal([]byte(toolUse.Function.Arguments), &toolArgs); err != nil {
-				ret.Result = mcp.NewToolResultError(fmt.Sprintf("error parsing tool arguments: %v", err))
-				if bs, err := json.Marshal(ret.Result); err == nil {
-					toolContent = string(bs)
-				}
-			} else {
-				ret.Request = new(mcp.CallToolRequest)
-				ret.Request.Params.Name = v.Tool.GetName()
-				ret.Request.Params.Arguments = toolArgs
-				ret.Result, err = v.Client.CallTool(ctx, *ret.Request)
-				if err != nil {
-					ret.Result = mcp.NewToolResultError(fmt.Sprintf("tool call error: %v", err))
-				}
-				if bs, err := json.Marshal(ret.Result); err == nil {
-					toolContent = string(bs)
-				}
-			}
-			req.Messages = append(req.Messages, openai.ToolMessage(toolContent, toolUse.ID))
-			return ret
-		}
+// CallMCP executes the tool calls of the step and appends the tool messages to the request in the same order
+func (i *Instructor) CallMCP(ctx context.Context, iteration int, toolUses []openai.ChatCompletionMessageToolCall, req *openai.ChatCompletionNewParams) []instructor.ToolCall {
+	calls := make([]instructor.ToolCall, 0, len(toolUses))
+	for _, v := range toolUses {
+		calls = append(calls, instructor.NewToolCall(v.Function.Name, v.Function.Arguments))
+	}
+	i.CallTools(ctx, iteration, calls)
+	for idx, v := range toolUses {
+		req.Messages = append(req.Messages, openai.ToolMessage(calls[idx].ToolResultContent(), v.ID))
+	}
+	return calls
+}
+
+// InjectMCPContext inserts the messages of the MCP prompts and resources after the system messages of the request
+func (i *Instructor) InjectMCPContext(ctx context.Context, req *openai.ChatCompletionNewParams) error {
+	msgs, err := i.MCPMessages(ctx)
+	if err != nil {
+		return err
 	}
-	toolRet := mcp.NewToolResultError("invalid tool name")
-	if bs, err := json.Marshal(toolRet); err == nil {
-		toolContent = string(bs)
+	return i.insertMessages(ctx, req, msgs)
+}
+
+// applyToolChoice sets the tool choice of the step of the tool loop,
+// extraction is the name of the extraction tool in the tool call modes, empty otherwise
+func (i *Instructor) applyToolChoice(req *openai.ChatCompletionNewParams, iteration int, extraction string) {
+	if len(req.Tools) == 0 {
+		return
+	}
+	switch choice, name := i.ToolChoiceOf(iteration, extraction); {
+	case name != "":
+		req.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+			OfChatCompletionNamedToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: name},
+			},
+		}
+	case choice != "":
+		req.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String(string(choice))}
 	}
-	req.Messages = append(req.Messages, openai.ToolMessage(toolContent, toolUse.ID))
-	return nil
 }
@@ -1,7 +1,11 @@
 package openai
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/shared/constant"
@@ -46,12 +50,22 @@ func ConvertMessageFrom(src *instructor.Message) []openai.ChatCompletionMessageP
 	list := make([]openai.ChatCompletionContentPartUnionParam, 0, len(src.Files)+len(src.Audios)+len(src.Images)+1)
 	if len(src.Files) > 0 {
 		for _, v := range src.Files {
-			fp := openai.FileContentPart(openai.ChatCompletionContentPartFileFileParam{
-				FileData: openai.String(v.Data),
-				FileID:   openai.String(v.ID),
-				Filename: openai.String(v.Name),
-			})
-			list = append(list, fp)
+			var file openai.ChatCompletionContentPartFileFileParam
+			if v.ID != "" {
+				file.FileID = openai.String(v.ID)
+			}
+			if v.Name != "" {
+				file.Filename = openai.String(v.Name)
+			}
+			if v.Data != "" {
+				data := v.Data
+				// the inline file data is sent as a data URL
+				if v.MimeType != "" && !strings.HasPrefix(data, "data:") {
+					data = fmt.Sprintf("data:%s;base64,%s", v.MimeType, data)
+				}
+				file.FileData = openai.String(data)
+			}
+			list = append(list, openai.FileContentPart(file))
 		}
 	}
 	if len(src.Audios) > 0 {
@@ -123,6 +137,88 @@ func ConvertMessageFrom(src *instructor.Message) []openai.ChatCompletionMessageP
 	return []openai.ChatCompletionMessageParamUnion{openai.UserMessage(list)}
 }
 
+// appendUserText appends the text to the user message without modifying the content shared with the original request,
+// the text is added as a text part if the content has parts
+func appendUserText(msg *openai.ChatCompletionMessageParamUnion, text string) {
+	if msg.OfUser == nil {
+		return
+	}
+	user := *msg.OfUser
+	if parts := user.Content.OfArrayOfContentParts; len(parts) > 0 {
+		user.Content.OfArrayOfContentParts = append(slices.Clip(parts), openai.TextContentPart(strings.TrimSpace(text)))
+	} else {
+		user.Content.OfString = openai.String(user.Content.OfString.Value + text)
+	}
+	msg.OfUser = &user
+}
+
+// SupportsDocument reports if the documents of the MIME type are sent as file parts, the other documents are prepared by PrepareDocuments
+func SupportsDocument(mimeType string) bool {
+	return mimeType == "application/pdf"
+}
+
+// SupportsAudio reports if the audios of the format are sent as input audio, the other audios are transcribed by PrepareAudios
+func SupportsAudio(format string) bool {
+	return format == "wav" || format == "mp3"
+}
+
+// supportsMessageAudio reports if the audio of the message is sent as is,
+// the audios replied by the assistant are replayed by their ID
+func supportsMessageAudio(msg *instructor.Message) func(audio *instructor.Audio) bool {
+	return func(audio *instructor.Audio) bool {
+		if msg.Role == instructor.AssistantRole {
+			return audio.ID != ""
+		}
+		return SupportsAudio(audio.Format)
+	}
+}
+
+// convertMessage converts the message with the media loader and the documents and audios prepared for OpenAI
+func (i *Instructor) convertMessage(ctx context.Context, msg instructor.Message) ([]openai.ChatCompletionMessageParamUnion, error) {
+	if err := i.PrepareDocuments(ctx, &msg, SupportsDocument); err != nil {
+		return nil, err
+	}
+	if err := i.PrepareAudios(ctx, &msg, supportsMessageAudio(&msg)); err != nil {
+		return nil, err
+	}
+	return ConvertMessageFromContext(ctx, i.MediaLoader(), &msg)
+}
+
+// ConvertMessageFromContext converts the message with the images and videos which OpenAI could not fetch itself,
+// e.g. file:// links routed to a FileMediaLoader, inlined as data URLs by the loader. The media which fails to load is reported as error
+func ConvertMessageFromContext(ctx context.Context, loader instructor.MediaLoader, src *instructor.Message) ([]openai.ChatCompletionMessageParamUnion, error) {
+	msg := *src
+	if len(msg.Images) > 0 {
+		msg.Images = slices.Clone(msg.Images)
+		for idx := range msg.Images {
+			v := &msg.Images[idx]
+			if v.URL == "" || instructor.IsMediaURL(v.URL) || strings.HasPrefix(v.URL, "data:") {
+				continue
+			}
+			media, err := loader.Load(ctx, v.URL)
+			if err != nil {
+				return nil, fmt.Errorf("load image: %w", err)
+			}
+			v.URL = media.DataURL()
+		}
+	}
+	if len(msg.Videos) > 0 {
+		msg.Videos = slices.Clone(msg.Videos)
+		for idx := range msg.Videos {
+			v := &msg.Videos[idx]
+			if v.URL == "" || instructor.IsMediaURL(v.URL) || strings.HasPrefix(v.URL, "data:") {
+				continue
+			}
+			media, err := loader.Load(ctx, v.URL)
+			if err != nil {
+				return nil, fmt.Errorf("load video: %w", err)
+			}
+			v.URL = media.DataURL()
+		}
+	}
+	return ConvertMessageFrom(&msg), nil
+}
+
 func ConvertMessageTo(src *openai.ChatCompletionMessageParamUnion, dist *instructor.Message) error {
 	if msg := src.OfAssistant; msg != nil {
 		dist.Role = instructor.AssistantRole
@@ -151,11 +247,16 @@ func ConvertMessageTo(src *openai.ChatCompletionMessageParamUnion, dist *instruc
 		if len(msg.Content.OfArrayOfContentParts) > 0 {
 			for _, part := range msg.Content.OfArrayOfContentParts {
 				if v := part.OfFile; v != nil {
-					dist.Files = append(dist.Files, instructor.File{
+					file := instructor.File{
 						ID:   v.File.FileID.Value,
 						Name: v.File.Filename.Value,
 						Data: v.File.FileData.Value,
-					})
+					}
+					if header, data, ok := strings.Cut(strings.TrimPrefix(file.Data, "data:"), ";base64,"); ok && strings.HasPrefix(file.Data, "data:") {
+						file.MimeType = header
+						file.Data = data
+					}
+					dist.Files = append(dist.Files, file)
 				} else if v := part.OfInputAudio; v != nil && v.InputAudio.Data != "" {
 					dist.Audios = append(dist.Audios, instructor.Audio{
 						Data:   v.InputAudio.Data,
@@ -192,3 +293,34 @@ func ConvertMessageTo(src *openai.ChatCompletionMessageParamUnion, dist *instruc
 	}
 	return nil
 }
+
+// InjectMemory inserts the messages of the memory after the system messages of the request, if WithMemoryInjection is set
+func (i *Instructor) InjectMemory(ctx context.Context, req *openai.ChatCompletionNewParams) error {
+	msgs, err := i.MemoryMessages(ctx)
+	if err != nil {
+		return err
+	}
+	return i.insertMessages(ctx, req, msgs)
+}
+
+// insertMessages inserts the messages after the system messages of the request without modifying the original messages
+func (i *Instructor) insertMessages(ctx context.Context, req *openai.ChatCompletionNewParams, msgs []instructor.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	var idx int
+	for idx < len(req.Messages) && req.Messages[idx].OfSystem != nil {
+		idx++
+	}
+	list := make([]openai.ChatCompletionMessageParamUnion, 0, len(req.Messages)+len(msgs))
+	list = append(list, req.Messages[:idx]...)
+	for _, v := range msgs {
+		converted, err := i.convertMessage(ctx, v)
+		if err != nil {
+			return err
+		}
+		list = append(list, converted...)
+	}
+	req.Messages = append(list, req.Messages[idx:]...)
+	return nil
+}
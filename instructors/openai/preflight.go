@@ -0,0 +1,52 @@
+package openai
+
+import (
+	"encoding/json"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+)
+
+// Preflight returns an instructor.ContextTooLargeError if the messages, the tools, the response schema and the max output tokens
+// of the request do not fit in the context window of the model, it is skipped unless WithContextPreflight is set.
+// It checks the final request of every round trip of the tool loop
+func (i *Instructor) Preflight(req *openai.ChatCompletionNewParams) error {
+	if !i.ContextPreflight() {
+		return nil
+	}
+	list := make([]instructor.Message, 0, len(req.Messages))
+	for _, v := range req.Messages {
+		var msg instructor.Message
+		if s := v.OfSystem; s != nil {
+			msg.Role = instructor.SystemRole
+			msg.Text = s.Content.OfString.Value
+			for _, part := range s.Content.OfArrayOfContentParts {
+				msg.Text += part.Text
+			}
+		} else if d := v.OfDeveloper; d != nil {
+			msg.Role = instructor.SystemRole
+			msg.Text = d.Content.OfString.Value
+			for _, part := range d.Content.OfArrayOfContentParts {
+				msg.Text += part.Text
+			}
+		} else if err := ConvertMessageTo(&v, &msg); err != nil {
+			continue
+		}
+		list = append(list, msg)
+	}
+	// the definitions sent besides the messages are counted as their JSON
+	if len(req.Tools) > 0 {
+		bs, _ := json.Marshal(req.Tools)
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: string(bs)})
+	}
+	if v := req.ResponseFormat.OfJSONSchema; v != nil {
+		bs, _ := json.Marshal(v)
+		list = append(list, instructor.Message{Role: instructor.SystemRole, Text: string(bs)})
+	}
+	reserved := req.MaxCompletionTokens.Value
+	if reserved == 0 {
+		reserved = req.MaxTokens.Value
+	}
+	return instructor.CheckContext(i.Tokenizer(req.Model), req.Model, list, int(reserved))
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/bububa/instructor-go"
 	jsonenc "github.com/bububa/instructor-go/encoding/json"
+	"github.com/bububa/instructor-go/internal"
 	"github.com/bububa/instructor-go/internal/chat"
 )
 
@@ -29,11 +30,15 @@ func (i *Instructor) SchemaStream(
 }
 
 func (i *Instructor) SchemaStreamHandler(ctx context.Context, request *openai.ChatCompletionNewParams, response *openai.ChatCompletion) (<-chan instructor.StreamData, error) {
+	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
 	switch i.Mode() {
 	case instructor.ModeToolCall, instructor.ModeToolCallStrict:
-		return i.chatToolCallStream(ctx, *request, response)
+		return i.chatToolCallStream(ctx, req, response)
 	default:
-		return i.chatSchemaStream(ctx, *request, response)
+		return i.chatSchemaStream(ctx, req, response)
 	}
 }
 
@@ -45,7 +50,7 @@ func (i *Instructor) chatToolCallStream(ctx context.Context, request openai.Chat
 		return nil, errors.New("encoder must be JSON Encoder")
 	}
 	request.Tools = createOpenAITools(schema, i.Mode() == instructor.ModeToolCallStrict)
-	return i.createStream(ctx, request, response, false)
+	return i.createStream(ctx, request, response, nil, 1, extractionTool(request.Tools))
 }
 
 func (i *Instructor) chatSchemaStream(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion) (<-chan instructor.StreamData, error) {
@@ -94,9 +99,7 @@ func (i *Instructor) chatSchemaStream(ctx context.Context, request openai.ChatCo
 		} else {
 			if !hasSystem && lastIdx >= 0 {
 				bs := i.StreamEncoder().Context()
-				if msg := request.Messages[lastIdx].OfUser; msg != nil {
-					request.Messages[lastIdx].OfUser.Content.OfString = openai.String(fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", msg.Content.OfString.Value, string(bs)))
-				}
+				appendUserText(&request.Messages[lastIdx], fmt.Sprintf("\n\n#OUTPUT SCHEMA\n%s", string(bs)))
 			}
 			request.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
 				OfJSONObject: new(openai.ResponseFormatJSONObjectParam),
@@ -107,12 +110,16 @@ func (i *Instructor) chatSchemaStream(ctx context.Context, request openai.ChatCo
 			OfText: new(openai.ResponseFormatTextParam),
 		}
 	}
-	return i.createStream(ctx, request, response, false)
+	return i.createStream(ctx, request, response, nil, 1, "")
 }
 
-func (i *Instructor) createStream(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion, toolRequest bool) (<-chan instructor.StreamData, error) {
+// createStream streams the request, the follow up requests of the tool calls share the meta of the outermost stream
+// which sends it with DoneStream once every round trip finished, extraction is the name of the extraction tool in the tool call modes
+func (i *Instructor) createStream(ctx context.Context, request openai.ChatCompletionNewParams, response *openai.ChatCompletion, meta *instructor.ResponseMeta, iteration int, extraction string) (<-chan instructor.StreamData, error) {
 	memory := i.Memory()
+	toolRequest := meta != nil
 	if !toolRequest {
+		meta = new(instructor.ResponseMeta)
 		i.InjectMCP(ctx, &request)
 		if memory != nil {
 			var msg instructor.Message
@@ -120,6 +127,9 @@ func (i *Instructor) createStream(ctx context.Context, request openai.ChatComple
 				memory.Add(msg)
 			}
 		}
+		if err := i.InjectMCPContext(ctx, &request); err != nil {
+			return nil, err
+		}
 	}
 	request.StreamOptions.IncludeUsage = openai.Bool(true)
 	extraFields := request.ExtraFields()
@@ -157,11 +167,15 @@ func (i *Instructor) createStream(ctx context.Context, request openai.ChatComple
 		}
 	}
 	request.SetExtraFields(extraFields)
+	i.applyToolChoice(&request, iteration, extraction)
 
 	if i.Verbose() {
 		bs, _ := request.MarshalJSON()
 		log.Printf("%s Request: %s\n", i.Provider(), string(bs))
 	}
+	if err := i.Preflight(&request); err != nil {
+		return nil, err
+	}
 	stream := i.Client.Chat.Completions.NewStreaming(ctx, request)
 
 	ch := make(chan instructor.StreamData)
@@ -169,6 +183,16 @@ func (i *Instructor) createStream(ctx context.Context, request openai.ChatComple
 	go func() {
 		defer stream.Close()
 		defer close(ch)
+		if !toolRequest {
+			defer func() {
+				if response != nil {
+					response.Usage.PromptTokens = meta.Usage.InputTokens
+					response.Usage.CompletionTokens = meta.Usage.OutputTokens
+					response.Usage.TotalTokens = meta.Usage.TotalTokens
+				}
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.DoneStream, Meta: meta})
+			}()
+		}
 		bs := new(bytes.Buffer)
 		var toolCalls []openai.ChatCompletionMessageToolCall
 		defer func() {
@@ -201,30 +225,36 @@ func (i *Instructor) createStream(ctx context.Context, request openai.ChatComple
 					ToolCalls: toolCallParams,
 				},
 			}
-			oldMessagesCount := len(request.Messages)
-			request.Messages = append(request.Messages, assistantMessage)
+			// the extraction tool calls are the final answer, the items are parsed by the schema stream handler
+			var extracted bool
 			for _, toolCall := range toolCalls {
-				if call := i.CallMCP(ctx, &toolCall, &request); call != nil {
-					ch <- instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: call}
-				} else {
-					var shouldReturn bool
-					for _, tool := range request.Tools {
-						if tool.Function.Name == toolCall.Function.Name {
-							callReq := new(mcp.CallToolRequest)
-							callReq.Params.Name = toolCall.Function.Name
-							callReq.Params.Arguments = toolCall.Function.Arguments
-							call := instructor.ToolCall{
-								Request: callReq,
-							}
-							ch <- instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &call}
-							shouldReturn = true
-						}
-					}
-					if shouldReturn {
-						return
+				if _, ok := i.LookupTool(toolCall.Function.Name); ok {
+					continue
+				}
+				for _, tool := range request.Tools {
+					if tool.Function.Name == toolCall.Function.Name {
+						callReq := new(mcp.CallToolRequest)
+						callReq.Params.Name = toolCall.Function.Name
+						callReq.Params.Arguments = toolCall.Function.Arguments
+						internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &instructor.ToolCall{Request: callReq}})
+						extracted = true
+						break
 					}
 				}
 			}
+			if extracted {
+				return
+			}
+			if iteration > i.MaxToolIterations() {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: instructor.ErrMaxToolIterations})
+				return
+			}
+			oldMessagesCount := len(request.Messages)
+			request.Messages = append(request.Messages, assistantMessage)
+			calls := i.CallMCP(i.StreamApprovalContext(ctx, ch), iteration, toolCalls, &request)
+			for idx := range calls {
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &calls[idx]})
+			}
 			if newMessagesCount := len(request.Messages); newMessagesCount > oldMessagesCount && memory != nil {
 				for _, v := range request.Messages[oldMessagesCount:newMessagesCount] {
 					var msg instructor.Message
@@ -233,28 +263,22 @@ func (i *Instructor) createStream(ctx context.Context, request openai.ChatComple
 					}
 				}
 			}
-			var usage openai.CompletionUsage
-			if response != nil {
-				usage = response.Usage
-			}
-			tmpCh, err := i.createStream(ctx, request, response, true)
-			if response != nil {
-				response.Usage.PromptTokens += usage.PromptTokens
-				response.Usage.CompletionTokens += usage.CompletionTokens
-				response.Usage.TotalTokens += usage.TotalTokens
-			}
+			tmpCh, err := i.createStream(ctx, request, response, meta, iteration+1, extraction)
 			if err != nil {
-				ch <- instructor.StreamData{Type: instructor.ErrorStream, Err: err}
+				internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
 				return
 			}
 			for v := range tmpCh {
 				if i.Verbose() && v.Type == instructor.ContentStream {
 					bs.WriteString(v.Content)
 				}
-				ch <- v
+				internal.Send(ctx, ch, v)
 			}
 		}()
-		var acc openai.ChatCompletionAccumulator
+		var (
+			acc   openai.ChatCompletionAccumulator
+			usage instructor.UsageSum
+		)
 		for stream.Next() {
 			chunk := stream.Current()
 			acc.AddChunk(chunk)
@@ -265,28 +289,43 @@ func (i *Instructor) createStream(ctx context.Context, request openai.ChatComple
 				}
 				toolCalls = append(toolCalls, toolCall)
 			}
-			if chunk.JSON.Usage.Valid() && response != nil {
-				response.ID = chunk.ID
-				response.Model = chunk.Model
-				response.Created = chunk.Created
-				response.SystemFingerprint = chunk.SystemFingerprint
-				response.Usage = chunk.Usage
+			if chunk.ID != "" {
+				meta.ID = chunk.ID
+				meta.Model = chunk.Model
+			}
+			// some compatible servers send the cumulative usage in every chunk, only the last one is counted
+			if chunk.JSON.Usage.Valid() {
+				usage = instructor.UsageSum{
+					InputTokens:  chunk.Usage.PromptTokens,
+					OutputTokens: chunk.Usage.CompletionTokens,
+					TotalTokens:  chunk.Usage.TotalTokens,
+				}
+				if response != nil {
+					response.ID = chunk.ID
+					response.Model = chunk.Model
+					response.Created = chunk.Created
+					response.SystemFingerprint = chunk.SystemFingerprint
+				}
 			}
 			if len(chunk.Choices) > 0 {
+				if reason := chunk.Choices[0].FinishReason; reason != "" {
+					meta.FinishReason = reason
+				}
 				delta := chunk.Choices[0].Delta
 				if field, ok := delta.JSON.ExtraFields["reasoning_content"]; ok && field.Raw() != respjson.Omitted && field.Raw() != respjson.Null {
 					text := field.Raw()
-					ch <- instructor.StreamData{Type: instructor.ThinkingStream, Content: text[1 : len(text)-1]}
+					internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ThinkingStream, Content: text[1 : len(text)-1]})
 				} else if text := delta.Content; text != "" {
 					if i.Verbose() {
 						bs.WriteString(text)
 					}
-					ch <- instructor.StreamData{Type: instructor.ContentStream, Content: text}
+					internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ContentStream, Content: text})
 				}
 			}
 		}
-		if err := stream.Err(); err != nil && i.Verbose() {
-			ch <- instructor.StreamData{Type: instructor.ErrorStream, Err: err}
+		meta.Usage.Add(usage)
+		if err := stream.Err(); err != nil {
+			internal.Send(ctx, ch, instructor.StreamData{Type: instructor.ErrorStream, Err: err})
 		}
 	}()
 	return ch, nil
@@ -0,0 +1,26 @@
+package openai
+
+import (
+	"context"
+	"slices"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+)
+
+// NewSession creates a session which replays the memory after the messages of the base request, e.g. the system prompt
+func (i *Instructor) NewSession(base *openai.ChatCompletionNewParams, memory *instructor.Memory) *instructor.Session[openai.ChatCompletionNewParams, openai.ChatCompletion] {
+	return instructor.NewSession(i, memory, func(ctx context.Context, list []instructor.Message) (*openai.ChatCompletionNewParams, error) {
+		req := *base
+		req.Messages = slices.Clone(base.Messages)
+		for _, v := range list {
+			converted, err := i.convertMessage(ctx, v)
+			if err != nil {
+				return nil, err
+			}
+			req.Messages = append(req.Messages, converted...)
+		}
+		return &req, nil
+	})
+}
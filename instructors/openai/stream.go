@@ -20,6 +20,9 @@ func (i *Instructor) Stream(
 	response *openai.ChatCompletion,
 ) (<-chan instructor.StreamData, error) {
 	req := *request
+	if err := i.InjectMemory(ctx, &req); err != nil {
+		return nil, err
+	}
 	if responseType != nil {
 		if i.Encoder() == nil {
 			if enc, err := encoding.PredefinedEncoder(i.Mode(), responseType, i.SchemaNamer()); err != nil {
@@ -72,9 +75,7 @@ func (i *Instructor) Stream(
 			} else {
 				if !hasSystem && lastIdx >= 0 {
 					bs := i.StreamEncoder().Context()
-					if msg := req.Messages[lastIdx].OfUser; msg != nil {
-						req.Messages[lastIdx].OfUser.Content.OfString = openai.String(fmt.Sprintf("%s\n\n#OUTPUT SCHEMA\n%s", msg.Content.OfString.Value, string(bs)))
-					}
+					appendUserText(&req.Messages[lastIdx], fmt.Sprintf("\n\n#OUTPUT SCHEMA\n%s", string(bs)))
 				}
 				req.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
 					OfJSONObject: new(openai.ResponseFormatJSONObjectParam),
@@ -86,5 +87,5 @@ func (i *Instructor) Stream(
 			}
 		}
 	}
-	return i.createStream(ctx, req, response, false)
+	return i.createStream(ctx, req, response, nil, 1, "")
 }
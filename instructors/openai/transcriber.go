@@ -0,0 +1,52 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+)
+
+// Transcriber transcribes the audios with the OpenAI compatible transcription API, e.g. whisper-1
+type Transcriber struct {
+	client *openai.Client
+	model  openai.AudioModel
+	// Language is the ISO-639-1 language of the audios if known
+	Language string
+}
+
+var _ instructor.Transcriber = (*Transcriber)(nil)
+
+func NewTranscriber(client *openai.Client, model openai.AudioModel) *Transcriber {
+	return &Transcriber{
+		client: client,
+		model:  model,
+	}
+}
+
+func (t *Transcriber) Transcribe(ctx context.Context, audio instructor.Audio) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(audio.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode audio: %w", err)
+	}
+	format := audio.Format
+	if format == "" {
+		format = "wav"
+	}
+	req := openai.AudioTranscriptionNewParams{
+		File:  openai.File(bytes.NewReader(data), "audio."+format, "audio/"+format),
+		Model: t.model,
+	}
+	if t.Language != "" {
+		req.Language = openai.String(t.Language)
+	}
+	resp, err := t.client.Audio.Transcriptions.New(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text, nil
+}
@@ -0,0 +1,13 @@
+package internal
+
+import "context"
+
+// Send delivers v unless ctx is done, so an abandoned consumer never blocks the producer
+func Send[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- v:
+		return true
+	}
+}
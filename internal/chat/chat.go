@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"reflect"
 
 	"github.com/bububa/instructor-go"
 	"github.com/bububa/instructor-go/encoding"
@@ -14,15 +15,9 @@ type JSONMarshaler interface {
 }
 
 func Handler[T any, RESP any](i instructor.ChatInstructor[T, RESP], ctx context.Context, request *T, responseType any, response *RESP) error {
-	var (
-		enc = i.Encoder()
-		err error
-	)
-	if enc == nil {
-		if enc, err = encoding.PredefinedEncoder(i.Mode(), responseType, i.SchemaNamer()); err != nil {
-			return err
-		}
-		i.SetEncoder(enc)
+	enc, err := Encoder(i, responseType)
+	if err != nil {
+		return err
 	}
 
 	// keep a running total of usage
@@ -44,7 +39,7 @@ func Handler[T any, RESP any](i instructor.ChatInstructor[T, RESP], ctx context.
 		}
 		i.CountUsageFromResponse(resp, usage)
 
-		if err := enc.Unmarshal([]byte(text), responseType); err != nil {
+		if err := Decode(i, enc, text, responseType); err != nil {
 			if i.Verbose() {
 				log.Printf("Err(attempt:%d): %+v\n", attempt, err)
 			}
@@ -54,22 +49,66 @@ func Handler[T any, RESP any](i instructor.ChatInstructor[T, RESP], ctx context.
 			continue
 		}
 
-		if i.Validate() {
-			if validator, ok := enc.(instructor.Validator); ok {
-				// Validate the response structure against the defined model using the validator
-				if err := validator.Validate(responseType); err != nil {
-					if i.Verbose() {
-						log.Printf("Err(attempt:%d): %+v\n", attempt, err)
-					}
-					retErr = errors.Join(retErr, err)
-					continue
-				}
-			}
-		}
-
 		i.SetUsageSumToResponse(response, usage)
 		return nil
 	}
 	i.EmptyResponseWithUsageSum(response, usage)
 	return retErr
 }
+
+// Encoder returns the encoder of the instructor, the predefined encoder of the response type is set on the first call
+func Encoder(i instructor.Instructor, responseType any) (instructor.Encoder, error) {
+	if enc := i.Encoder(); enc != nil {
+		return enc, nil
+	}
+	target := responseType
+	if wrapperType := listWrapperType(i.Mode(), responseType); wrapperType != nil {
+		target = reflect.New(wrapperType).Interface()
+	}
+	enc, err := encoding.PredefinedEncoder(i.Mode(), target, i.SchemaNamer())
+	if err != nil {
+		return nil, err
+	}
+	i.SetEncoder(enc)
+	return enc, nil
+}
+
+// Decode decodes the text into the response type and validates it if validation is enabled,
+// slices are extracted through the `items` wrapper and unwrapped after decoding
+func Decode(i instructor.Instructor, enc instructor.Encoder, text string, responseType any) error {
+	var (
+		target      = responseType
+		wrapperType = listWrapperType(i.Mode(), responseType)
+	)
+	if wrapperType != nil {
+		target = reflect.New(wrapperType).Interface()
+	}
+	if err := enc.Unmarshal([]byte(text), target); err != nil {
+		return err
+	}
+	if i.Validate() {
+		if validator, ok := enc.(instructor.Validator); ok {
+			// Validate the response structure against the defined model using the validator
+			if err := validator.Validate(target); err != nil {
+				return err
+			}
+		}
+	}
+	if wrapperType != nil {
+		reflect.ValueOf(responseType).Elem().Set(reflect.ValueOf(target).Elem().Field(0))
+	}
+	return nil
+}
+
+// listWrapperType returns the `items` wrapper type when responseType is a pointer to a slice
+func listWrapperType(mode instructor.Mode, responseType any) reflect.Type {
+	switch mode {
+	case instructor.ModePlainText, instructor.ModeCustom:
+		return nil
+	}
+	t := reflect.TypeOf(responseType)
+	if t == nil || t.Kind() != reflect.Pointer || t.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+	return instructor.ListWrapperType(t.Elem().Elem())
+}
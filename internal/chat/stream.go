@@ -6,6 +6,7 @@ import (
 
 	"github.com/bububa/instructor-go"
 	"github.com/bububa/instructor-go/encoding"
+	"github.com/bububa/instructor-go/internal"
 )
 
 const WRAPPER_END = `"items": [`
@@ -40,28 +41,46 @@ func SchemaStreamHandler[T any, RESP any](i instructor.SchemaStreamInstructor[T,
 			}
 			i.SetEncoder(itemEnc)
 		}
-		list := struct {
-			Items []any `json:"items,omitempty"`
-		}{}
+		validator, _ := itemEnc.(instructor.Validator)
+		if !i.Validate() {
+			validator = nil
+		}
 		go func() {
 			defer close(contentCh)
 			defer close(outputCh)
 			defer close(parsedChan)
+			// keep draining ch after ctx is done so the provider goroutine can exit
 			for item := range ch {
-				outputCh <- item
-				if item.Type == instructor.ToolCallStream && item.ToolCall != nil && item.ToolCall.Request != nil {
-					if bs, err := json.Marshal(item.ToolCall.Request.Params.Arguments); err == nil {
-						if err := itemEnc.Unmarshal(bs, &list); err == nil {
-							instance := itemEnc.Instance()
-							for _, v := range list.Items {
-								if bs, err := json.Marshal(v); err != nil {
-									continue
-								} else if err := json.Unmarshal(bs, instance); err == nil {
-									parsedChan <- instance
-								}
-							}
+				internal.Send(ctx, outputCh, item)
+				// the executed MCP tool calls come with a result, only the extraction tool calls are parsed
+				if item.Type != instructor.ToolCallStream || item.ToolCall == nil || item.ToolCall.Request == nil || item.ToolCall.Result != nil {
+					continue
+				}
+				bs, err := toolCallArguments(item.ToolCall.Request.Params.Arguments)
+				if err != nil {
+					internal.Send(ctx, outputCh, instructor.StreamData{Type: instructor.ValidationErrorStream, Raw: bs, Err: err})
+					continue
+				}
+				var list struct {
+					Items []json.RawMessage `json:"items,omitempty"`
+				}
+				if err := itemEnc.Unmarshal(bs, &list); err != nil {
+					internal.Send(ctx, outputCh, instructor.StreamData{Type: instructor.ValidationErrorStream, Raw: bs, Err: err})
+					continue
+				}
+				for _, raw := range list.Items {
+					instance := itemEnc.Instance()
+					if err := json.Unmarshal(raw, instance); err != nil {
+						internal.Send(ctx, outputCh, instructor.StreamData{Type: instructor.ValidationErrorStream, Raw: raw, Err: err})
+						continue
+					}
+					if validator != nil {
+						if err := validator.Validate(instance); err != nil {
+							internal.Send(ctx, outputCh, instructor.StreamData{Type: instructor.ValidationErrorStream, Raw: raw, Err: err})
+							continue
 						}
 					}
+					internal.Send[any](ctx, parsedChan, instance)
 				}
 			}
 		}()
@@ -71,9 +90,9 @@ func SchemaStreamHandler[T any, RESP any](i instructor.SchemaStreamInstructor[T,
 		defer close(contentCh)
 		defer close(outputCh)
 		for item := range ch {
-			outputCh <- item
+			internal.Send(ctx, outputCh, item)
 			if item.Type == instructor.ContentStream {
-				contentCh <- item.Content
+				internal.Send(ctx, contentCh, item.Content)
 			}
 		}
 	}()
@@ -81,3 +100,17 @@ func SchemaStreamHandler[T any, RESP any](i instructor.SchemaStreamInstructor[T,
 
 	return parsedChan, outputCh, nil
 }
+
+// toolCallArguments returns the JSON arguments of a tool call, providers pass them either decoded or as raw JSON
+func toolCallArguments(args any) ([]byte, error) {
+	switch v := args.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case json.RawMessage:
+		return v, nil
+	default:
+		return json.Marshal(v)
+	}
+}
@@ -0,0 +1,131 @@
+package instructor_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+	cohereClient "github.com/cohere-ai/cohere-go/v2/client"
+	"github.com/cohere-ai/cohere-go/v2/option"
+	anthropicapi "github.com/liushuangls/go-anthropic/v2"
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+	openaiinst "github.com/bububa/instructor-go/instructors/openai"
+)
+
+func TestAudioTranscription(t *testing.T) {
+	ctx := context.Background()
+	stub, clt := newOpenAIStub(t)
+	msg := instructor.Message{
+		Role:   instructor.UserRole,
+		Text:   "Who is calling?",
+		Audios: []instructor.Audio{{Data: "AAAAGGZ0eXBNNEEg", Format: "m4a"}},
+	}
+
+	client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON))
+	session := client.NewSession(&openai.ChatCompletionNewParams{Model: "gpt-test"}, nil)
+	var result struct {
+		Caller string `json:"caller"`
+	}
+	if _, err := session.Send(ctx, msg, &result); !errors.Is(err, instructor.ErrAudioNotSupported) {
+		t.Fatalf("got error %v", err)
+	}
+
+	transcription, _ := json.Marshal(map[string]any{"text": "Hi, this is Alice from the bank."})
+	stub.reset(transcription, openAICompletion(`{"caller": "Alice"}`, "", ""))
+	client = instructors.FromOpenAI(clt,
+		instructor.WithMode(instructor.ModeJSON),
+		instructor.WithTranscriber(openaiinst.NewTranscriber(clt, openai.AudioModelWhisper1)),
+	)
+	session = client.NewSession(&openai.ChatCompletionNewParams{Model: "gpt-test"}, nil)
+	if _, err := session.Send(ctx, msg, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Caller != "Alice" {
+		t.Errorf("got %+v", result)
+	}
+	bs, _ := json.Marshal(stub.requests[1]["messages"])
+	if got := string(bs); !strings.Contains(got, `Transcript of the audio:\nHi, this is Alice from the bank.`) || strings.Contains(got, "input_audio") {
+		t.Errorf("got messages %s", got)
+	}
+}
+
+func TestAudioTranscriptionWithoutAudioInput(t *testing.T) {
+	ctx := context.Background()
+	msg := instructor.Message{
+		Role:   instructor.UserRole,
+		Text:   "Who is calling?",
+		Audios: []instructor.Audio{{Data: "AAAAGGZ0eXBNNEEg", Format: "m4a"}},
+	}
+	transcriber := instructor.WithTranscriber(instructor.TranscriberFunc(func(ctx context.Context, audio instructor.Audio) (string, error) {
+		return "Hi, this is Alice from the bank.", nil
+	}))
+	var result struct {
+		Caller string `json:"caller"`
+	}
+
+	t.Run("anthropic", func(t *testing.T) {
+		stub, url := newAPIStub(t, anthropicText(`{"caller": "Alice"}`))
+		base := &anthropicapi.MessagesRequest{Model: "claude-test", MaxTokens: 100}
+		client := instructors.FromAnthropic(anthropicapi.NewClient("test", anthropicapi.WithBaseURL(url)), instructor.WithMode(instructor.ModeJSON))
+		if _, err := client.NewSession(base, nil).Send(ctx, msg, &result); !errors.Is(err, instructor.ErrAudioNotSupported) {
+			t.Fatalf("got error %v", err)
+		}
+		client = instructors.FromAnthropic(anthropicapi.NewClient("test", anthropicapi.WithBaseURL(url)), instructor.WithMode(instructor.ModeJSON), transcriber)
+		if _, err := client.NewSession(base, nil).Send(ctx, msg, &result); err != nil || result.Caller != "Alice" {
+			t.Fatalf("got %+v, %v", result, err)
+		}
+		bs, _ := json.Marshal(stub.Requests()[0]["messages"])
+		if got := string(bs); !strings.Contains(got, `Transcript of the audio:\nHi, this is Alice from the bank.`) || strings.Contains(got, "AAAAGGZ0eXBNNEEg") {
+			t.Errorf("got messages %s", got)
+		}
+	})
+
+	t.Run("cohere", func(t *testing.T) {
+		stub, url := newAPIStub(t, cohereText(`{"caller": "Alice"}`))
+		clt := cohereClient.NewClient(option.WithBaseURL(url), option.WithToken("test"))
+		client := instructors.FromCohere(clt, instructor.WithMode(instructor.ModeJSON))
+		if _, err := client.NewSession(&cohere.ChatRequest{}, nil).Send(ctx, msg, &result); !errors.Is(err, instructor.ErrAudioNotSupported) {
+			t.Fatalf("got error %v", err)
+		}
+		client = instructors.FromCohere(clt, instructor.WithMode(instructor.ModeJSON), transcriber)
+		if _, err := client.NewSession(&cohere.ChatRequest{}, nil).Send(ctx, msg, &result); err != nil || result.Caller != "Alice" {
+			t.Fatalf("got %+v, %v", result, err)
+		}
+		if got, _ := stub.Requests()[0]["message"].(string); !strings.HasPrefix(got, "Transcript of the audio:\nHi, this is Alice from the bank.") || !strings.HasSuffix(got, "Who is calling?") {
+			t.Errorf("got message %q", got)
+		}
+	})
+}
+
+func TestOpenAIAudioReplay(t *testing.T) {
+	stub, clt := newOpenAIStub(t)
+	stub.reset(openAICompletion(`{"caller": "Alice"}`, "", ""))
+	memory := instructor.NewMemory(0)
+	memory.Add(instructor.Message{Role: instructor.UserRole, Text: "Answer with audio."})
+	memory.Add(instructor.Message{Role: instructor.AssistantRole, Audios: []instructor.Audio{{ID: "audio_abc"}}})
+	client := instructors.FromOpenAI(clt,
+		instructor.WithMode(instructor.ModeJSON),
+		instructor.WithMemory(memory),
+		instructor.WithMemoryInjection(),
+	)
+	var result struct {
+		Caller string `json:"caller"`
+	}
+	req := &openai.ChatCompletionNewParams{
+		Model:    "gpt-test",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Who was calling?")},
+	}
+	if err := client.Chat(context.Background(), req, &result, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the audio replied by the assistant is replayed by its ID
+	if bs, _ := json.Marshal(stub.requests[0]["messages"]); !strings.Contains(string(bs), `"audio":{"id":"audio_abc"}`) {
+		t.Errorf("got messages %s", bs)
+	}
+}
@@ -0,0 +1,276 @@
+package instructor_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	anthropic "github.com/liushuangls/go-anthropic/v2"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"google.golang.org/genai"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+	"github.com/bububa/instructor-go/instructors/gemini"
+)
+
+type batchRecord struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func TestOpenAIBatchJob(t *testing.T) {
+	var (
+		input []map[string]any
+		polls int
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /files", func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil || r.FormValue("purpose") != "batch" {
+			http.Error(w, "invalid upload", http.StatusBadRequest)
+			return
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var line map[string]any
+			json.Unmarshal(scanner.Bytes(), &line)
+			input = append(input, line)
+		}
+		fmt.Fprint(w, `{"id": "file-in", "object": "file", "purpose": "batch", "filename": "batch.jsonl", "bytes": 1, "created_at": 1, "status": "processed"}`)
+	})
+	batch := func(status string) string {
+		return fmt.Sprintf(`{"id": "batch_1", "object": "batch", "endpoint": "/v1/chat/completions", "input_file_id": "file-in", "completion_window": "24h", "created_at": 1, "status": %q, "output_file_id": "file-out", "error_file_id": "file-err", "request_counts": {"total": 3, "completed": 2, "failed": 1}}`, status)
+	}
+	mux.HandleFunc("POST /batches", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, batch("validating"))
+	})
+	mux.HandleFunc("GET /batches/batch_1", func(w http.ResponseWriter, r *http.Request) {
+		if polls++; polls < 2 {
+			fmt.Fprint(w, batch("in_progress"))
+			return
+		}
+		fmt.Fprint(w, batch("completed"))
+	})
+	mux.HandleFunc("GET /files/file-out/content", func(w http.ResponseWriter, r *http.Request) {
+		for idx, content := range []string{`{"name": "Alice"}`, `{"name": ""}`} {
+			body := openAICompletion(content, "", "")
+			fmt.Fprintf(w, "{\"custom_id\": %q, \"response\": {\"status_code\": 200, \"body\": %s}}\n", instructor.BatchCustomID(idx), body)
+		}
+	})
+	mux.HandleFunc("GET /files/file-err/content", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "{\"custom_id\": %q, \"response\": {\"status_code\": 400, \"body\": {\"error\": {\"message\": \"bad request\"}}}}\n", instructor.BatchCustomID(2))
+	})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+	defer api.Close()
+	clt := openai.NewClient(option.WithBaseURL(api.URL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+	client := instructors.FromOpenAI(&clt, instructor.WithMode(instructor.ModeJSONSchema), instructor.WithValidation())
+
+	ctx := context.Background()
+	system := openai.SystemMessage("Extract the person.")
+	requests := make([]*openai.ChatCompletionNewParams, 0, 3)
+	for _, text := range []string{"Alice", "nobody", "broken"} {
+		requests = append(requests, &openai.ChatCompletionNewParams{
+			Model:    "gpt-test",
+			Messages: []openai.ChatCompletionMessageParamUnion{system, openai.UserMessage(text)},
+		})
+	}
+	job, err := instructor.SubmitBatchJob[batchRecord](ctx, client, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "batch_1" || job.Status != instructor.BatchJobPending || len(input) != 3 {
+		t.Fatalf("got job %+v with %d lines", job, len(input))
+	}
+	bs, _ := json.Marshal(input[2])
+	if got := string(bs); input[2]["custom_id"] != "request-2" || input[2]["url"] != "/v1/chat/completions" || !strings.Contains(got, `"json_schema"`) || strings.Count(got, "#OUTPUT SCHEMA") != 1 {
+		t.Errorf("got input line %s", got)
+	}
+	if _, err := instructor.DecodeBatchJob[batchRecord](ctx, client, job); err != instructor.ErrBatchJobNotDone {
+		t.Errorf("got error %v", err)
+	}
+
+	if job, err = instructor.WaitBatchJob(ctx, client, job.ID, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	ret, err := instructor.DecodeBatchJob[batchRecord](ctx, client, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Succeeded != 1 || ret.Failed != 2 || ret.Items[0].Value.Name != "Alice" || ret.Usage.TotalTokens != 30 {
+		t.Fatalf("got result %+v", ret)
+	}
+	if ret.Items[1].Err == nil || !strings.Contains(ret.Items[2].Err.Error(), "status 400") {
+		t.Errorf("got errors %v, %v", ret.Items[1].Err, ret.Items[2].Err)
+	}
+}
+
+func TestAnthropicBatchJob(t *testing.T) {
+	var submitted anthropic.BatchRequest
+	batch := `{"id": "msgbatch_1", "type": "message_batch", "processing_status": "ended", "request_counts": {"succeeded": 1, "errored": 1}}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /messages/batches", func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+		json.Unmarshal(bs, &submitted)
+		fmt.Fprint(w, strings.Replace(batch, "ended", "in_progress", 1))
+	})
+	mux.HandleFunc("GET /messages/batches/msgbatch_1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, batch)
+	})
+	mux.HandleFunc("GET /messages/batches/msgbatch_1/results", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		fmt.Fprintln(&buf, `{"custom_id": "request-1", "result": {"type": "errored", "error": {"type": "error", "error": {"type": "invalid_request_error", "message": "max_tokens is required"}}}}`)
+		fmt.Fprintln(&buf, `{"custom_id": "request-0", "result": {"type": "succeeded", "message": {"id": "msg_1", "type": "message", "role": "assistant", "content": [{"type": "tool_use", "id": "toolu_1", "name": "batchRecord", "input": {"name": "Bob"}}], "usage": {"input_tokens": 12, "output_tokens": 4}}}}`)
+		// a custom id out of the submitted requests
+		fmt.Fprintln(&buf, `{"custom_id": "request-1000000", "result": {"type": "succeeded", "message": {"id": "msg_2", "type": "message", "role": "assistant", "content": [{"type": "tool_use", "id": "toolu_2", "name": "batchRecord", "input": {"name": "Eve"}}], "usage": {"input_tokens": 12, "output_tokens": 4}}}}`)
+		w.Write(buf.Bytes())
+	})
+	api := httptest.NewServer(mux)
+	defer api.Close()
+	client := instructors.FromAnthropic(anthropic.NewClient("test", anthropic.WithBaseURL(api.URL)), instructor.WithMode(instructor.ModeToolCall))
+
+	ctx := context.Background()
+	requests := []*anthropic.MessagesRequest{
+		{Model: "claude-test", MaxTokens: 100, Messages: []anthropic.Message{anthropic.NewUserTextMessage("Bob")}},
+		{Model: "claude-test", Messages: []anthropic.Message{anthropic.NewUserTextMessage("Carol")}},
+	}
+	job, err := instructor.SubmitBatchJob[batchRecord](ctx, client, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != instructor.BatchJobRunning || len(submitted.Requests) != 2 || len(submitted.Requests[1].Params.Tools) != 1 {
+		t.Fatalf("got job %+v, submitted %+v", job, submitted)
+	}
+	if job, err = instructor.WaitBatchJob(ctx, client, job.ID, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	ret, err := instructor.DecodeBatchJob[batchRecord](ctx, client, job)
+	if err == nil || !strings.Contains(err.Error(), "result 1000000 out of the 2 requests") {
+		t.Errorf("got error %v", err)
+	}
+	if job.Status != instructor.BatchJobCompleted || len(ret.Items) != 2 || ret.Succeeded != 1 || ret.Items[0].Value.Name != "Bob" || ret.Usage.InputTokens != 12 {
+		t.Fatalf("got result %+v", ret)
+	}
+	if err := ret.Items[1].Err; err == nil || !strings.Contains(err.Error(), "max_tokens is required") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestGeminiBatchJob(t *testing.T) {
+	var (
+		input   []batchGeminiLine
+		created map[string]any
+		failed  bool
+	)
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "POST /upload/v1beta/files":
+			w.Header().Set("X-Goog-Upload-URL", api.URL+"/upload/session")
+			fmt.Fprint(w, `{}`)
+		case "POST /upload/session":
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				var line batchGeminiLine
+				json.Unmarshal(scanner.Bytes(), &line)
+				input = append(input, line)
+			}
+			w.Header().Set("X-Goog-Upload-Status", "final")
+			fmt.Fprint(w, `{"file": {"name": "files/in"}}`)
+		case "POST /v1beta/models/gemini-test:batchGenerateContent":
+			json.NewDecoder(r.Body).Decode(&created)
+			fmt.Fprint(w, `{"name": "batches/1", "metadata": {"displayName": "instructor batch of 3 requests", "state": "BATCH_STATE_PENDING"}}`)
+		case "GET /v1beta/batches/1":
+			if failed {
+				fmt.Fprint(w, `{"name": "batches/1", "metadata": {"displayName": "instructor batch of 3 requests", "state": "BATCH_STATE_FAILED"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"name": "batches/1", "metadata": {"displayName": "instructor batch of 3 requests", "state": "BATCH_STATE_SUCCEEDED", "output": {"responsesFile": "files/out"}}}`)
+		case "GET /v1beta/files/out:download":
+			for _, line := range []string{
+				`{"key": "request-2", "error": {"code": 400, "message": "invalid content"}}`,
+				`{"key": "request-0", "response": {"candidates": [{"content": {"role": "model", "parts": [{"text": "{\"name\": \"Alice\"}"}]}}], "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "totalTokenCount": 15}}}`,
+				`{"key": "request-1", "response": {"candidates": [{"content": {"role": "model", "parts": [{"text": "{\"name\": \"\"}"}]}}]}}`,
+			} {
+				fmt.Fprintln(w, line)
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+	ctx := context.Background()
+	clt, err := genai.NewClient(ctx, &genai.ClientConfig{APIKey: "test", Backend: genai.BackendGeminiAPI, HTTPOptions: genai.HTTPOptions{BaseURL: api.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := instructors.FromGemini(clt, instructor.WithMode(instructor.ModeJSON), instructor.WithValidation())
+
+	requests := make([]*gemini.Request, 0, 3)
+	for _, text := range []string{"Alice", "nobody", "broken"} {
+		requests = append(requests, &gemini.Request{
+			Model:  "gemini-test",
+			System: genai.NewContentFromText("Extract the person.", genai.RoleUser),
+			Parts:  []*genai.Part{genai.NewPartFromText(text)},
+		})
+	}
+	job, err := instructor.SubmitBatchJob[batchRecord](ctx, client, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "batches/1" || job.Status != instructor.BatchJobPending || job.Total != 3 || len(input) != 3 {
+		t.Fatalf("got job %+v with %d lines", job, len(input))
+	}
+	if line := input[2]; line.Key != "request-2" || line.Request.SystemInstruction == nil || line.Request.GenerationConfig.ResponseMIMEType != "application/json" || len(line.Request.Contents) != 1 {
+		t.Errorf("got input line %+v", line)
+	}
+	if src, _ := created["batch"].(map[string]any)["inputConfig"].(map[string]any); src["fileName"] != "files/in" {
+		t.Errorf("got batch %v", created)
+	}
+
+	job, err = instructor.WaitBatchJob(ctx, client, job.ID, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := instructor.DecodeBatchJob[batchRecord](ctx, client, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Succeeded != 1 || ret.Failed != 2 || ret.Items[0].Value.Name != "Alice" || ret.Usage.TotalTokens != 15 {
+		t.Fatalf("got result %+v", ret)
+	}
+	if err := ret.Items[2].Err; err == nil || !strings.Contains(err.Error(), "invalid content") {
+		t.Errorf("got error %v", err)
+	}
+
+	// a re-fetched failed job without output fails every request
+	failed = true
+	if job, err = client.RetrieveBatchJob(ctx, job.ID); err != nil || job.Status != instructor.BatchJobFailed || job.Total != 3 {
+		t.Fatalf("got job %+v, %v", job, err)
+	}
+	if ret, err = instructor.DecodeBatchJob[batchRecord](ctx, client, job); err != nil || ret.Failed != 3 {
+		t.Fatalf("got failed result %+v, %v", ret, err)
+	}
+}
+
+type batchGeminiLine struct {
+	Key     string `json:"key"`
+	Request struct {
+		Contents          []*genai.Content        `json:"contents"`
+		SystemInstruction *genai.Content          `json:"systemInstruction"`
+		GenerationConfig  *genai.GenerationConfig `json:"generationConfig"`
+	} `json:"request"`
+}
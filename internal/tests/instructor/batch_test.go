@@ -0,0 +1,114 @@
+package instructor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	anthropicapi "github.com/liushuangls/go-anthropic/v2"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+)
+
+func TestBatch(t *testing.T) {
+	type Record struct {
+		Name string `json:"name"`
+	}
+	responses := []string{`{"name": "a"}`, `{"name": "b"}`, `not json`, `{"name": "c"}`}
+	clt := newMockInstructor(responses, instructor.WithMode(instructor.ModeJSON), instructor.WithMaxRetries(0))
+	requests := make([]*mockRequest, 0, len(responses))
+	for idx := range responses {
+		requests = append(requests, &mockRequest{Text: fmt.Sprintf("r%d", idx)})
+	}
+	var progress []instructor.BatchProgress
+	ret, err := instructor.Batch[Record](context.Background(), clt, requests,
+		instructor.WithBatchWorkers(2),
+		instructor.WithBatchRetries(1, time.Millisecond),
+		instructor.WithBatchRequestsPerMinute(6000),
+		instructor.WithBatchTokensPerMinute(100000, nil),
+		instructor.WithBatchProgress(func(p instructor.BatchProgress) {
+			progress = append(progress, p)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the item receiving the invalid response is not retried as the error is not transient
+	if ret.Succeeded != 3 || ret.Failed != 1 || ret.Err() == nil {
+		t.Fatalf("got %d succeeded, %d failed", ret.Succeeded, ret.Failed)
+	}
+	for _, v := range ret.Items {
+		if v.Err != nil && (v.Attempts != 1 || v.Value.Name != "") {
+			t.Errorf("got failed item %+v", v)
+		} else if v.Err == nil && (v.Attempts != 1 || v.Value.Name == "") {
+			t.Errorf("got item %+v", v)
+		}
+	}
+	var want int64
+	for _, v := range responses {
+		want += int64(len(v) + 2)
+	}
+	if ret.Usage.TotalTokens != want {
+		t.Errorf("got usage %d, want %d", ret.Usage.TotalTokens, want)
+	}
+	if last := progress[len(progress)-1]; len(progress) != 4 || last.Done != 4 || last.Failed != 1 || last.Usage != ret.Usage {
+		t.Errorf("got progress %+v", progress)
+	}
+
+	// the first calls of a fresh instructor run concurrently and share the encoder of T
+	clt = newMockInstructor(slices.Repeat([]string{`{"name": "a"}`}, 6), instructor.WithMode(instructor.ModeJSON))
+	concurrent := slices.Repeat([]*mockRequest{{Text: "r"}}, 6)
+	if ret, err = instructor.Batch[Record](context.Background(), clt, concurrent, instructor.WithBatchWorkers(6)); err != nil || ret.Succeeded != 6 {
+		t.Errorf("got %v, %+v", err, ret)
+	}
+
+	// a single request per minute blocks the second item until the deadline
+	clt = newMockInstructor([]string{`{"name": "a"}`, `{"name": "b"}`}, instructor.WithMode(instructor.ModeJSON))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ret, err = instructor.Batch[Record](ctx, clt, requests[:2], instructor.WithBatchRequestsPerMinute(1))
+	if !errors.Is(err, context.DeadlineExceeded) || ret.Succeeded != 1 || !errors.Is(ret.Items[1].Err, context.DeadlineExceeded) {
+		t.Errorf("got %v, %+v", err, ret.Items)
+	}
+}
+
+func TestBatchProviderErrors(t *testing.T) {
+	type Record struct {
+		Name string `json:"name"`
+	}
+	newClient := func(url string) instructor.ChatInstructor[anthropicapi.MessagesRequest, anthropicapi.MessagesResponse] {
+		return instructors.FromAnthropic(anthropicapi.NewClient("test", anthropicapi.WithBaseURL(url)), instructor.WithMode(instructor.ModeToolCall))
+	}
+	requests := []*anthropicapi.MessagesRequest{
+		{Model: "claude-test", MaxTokens: 100, Messages: []anthropicapi.Message{anthropicapi.NewUserTextMessage("a")}},
+		{Model: "claude-test", MaxTokens: 100, Messages: []anthropicapi.Message{anthropicapi.NewUserTextMessage("b")}},
+	}
+
+	// the rate limit is retried while the authentication error is not
+	stub, url := newAPIStub(t,
+		stubResponse{http.StatusTooManyRequests, `{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`},
+		anthropicToolUse("Record", `{"name": "a"}`, 10),
+		stubResponse{http.StatusUnauthorized, `{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`},
+	)
+	ret, err := instructor.Batch[Record](context.Background(), newClient(url), requests, instructor.WithBatchWorkers(1), instructor.WithBatchRetries(2, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := ret.Items[0], ret.Items[1]; a.Err != nil || a.Attempts != 2 || a.Value.Name != "a" || b.Err == nil || b.Attempts != 1 || len(stub.Requests()) != 3 {
+		t.Errorf("got items %+v", ret.Items)
+	}
+
+	// the usage without the total tokens is taken from the bucket, which blocks the second item
+	_, url = newAPIStub(t, anthropicToolUse("Record", `{"name": "a"}`, 10000), anthropicToolUse("Record", `{"name": "b"}`, 10))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ret, err = instructor.Batch[Record](ctx, newClient(url), requests, instructor.WithBatchWorkers(1), instructor.WithBatchTokensPerMinute(10000, nil))
+	if !errors.Is(err, context.DeadlineExceeded) || ret.Succeeded != 1 || ret.Items[0].Usage.InputTokens != 10000 {
+		t.Errorf("got %v, %+v", err, ret.Items)
+	}
+}
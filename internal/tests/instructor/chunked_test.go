@@ -0,0 +1,88 @@
+package instructor_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bububa/instructor-go"
+)
+
+func TestSplitText(t *testing.T) {
+	paragraphs := []string{strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 40), strings.Repeat("d ", 60)}
+	chunks := instructor.SplitText(strings.Join(paragraphs, "\n\n"), 25, 10, nil)
+	for _, v := range chunks {
+		if n := instructor.DefaultTokenizer.Count(v); n > 25 {
+			t.Errorf("chunk of %d tokens: %q", n, v)
+		}
+	}
+	// the last paragraph of the first chunk is repeated and the long paragraph is split by words
+	if len(chunks) != 5 || !strings.HasPrefix(chunks[1], paragraphs[1]) || !strings.HasPrefix(chunks[2], "d d") {
+		t.Errorf("got chunks %q", chunks)
+	}
+}
+
+func TestChunkedExtractor(t *testing.T) {
+	type Person struct {
+		Name string `json:"name"`
+	}
+	type People struct {
+		Title  string   `json:"title"`
+		People []Person `json:"people"`
+	}
+	// the chunks are extracted concurrently so the response is picked by the chunk
+	responses := map[byte]string{
+		'x': `{"title": "Minutes", "people": [{"name": "Alice"}, {"name": "Bob"}]}`,
+		'y': `{"people": [{"name": "Bob"}, {"name": "Carol"}]}`,
+		'z': `{"title": "Ignored", "people": [{"name": "Dave"}]}`,
+	}
+	clt := newMockInstructor(nil, instructor.WithMode(instructor.ModeJSON))
+	clt.respond = func(request *mockRequest) string {
+		return responses[request.Text[0]]
+	}
+	extractor := instructor.NewChunkedExtractor[People](clt, func(chunk string) *mockRequest {
+		return &mockRequest{Text: chunk}
+	}, nil, instructor.WithChunkTokens(20), instructor.WithChunkOverlap(0), instructor.WithChunkWorkers(2))
+	text := strings.Join([]string{strings.Repeat("x", 60), strings.Repeat("y", 60), strings.Repeat("z", 60)}, "\n\n")
+	ret, err := extractor.Extract(context.Background(), text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(ret.Value.People))
+	for _, v := range ret.Value.People {
+		names = append(names, v.Name)
+	}
+	slices.Sort(names)
+	if ret.Chunks != 3 || ret.Value.Title != "Minutes" || !slices.Equal(names, []string{"Alice", "Bob", "Carol", "Dave"}) {
+		t.Errorf("got %+v", ret)
+	}
+	var want int64
+	for _, v := range responses {
+		want += int64(len(v) + 60)
+	}
+	if ret.Usage.TotalTokens != want {
+		t.Errorf("got usage %+v, want %d", ret.Usage, want)
+	}
+}
+
+func TestDefaultMerge(t *testing.T) {
+	type Event struct {
+		Name string    `json:"name"`
+		At   time.Time `json:"at"`
+		Tags []string  `json:"tags"`
+	}
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	ret, err := instructor.DefaultMerge([]Event{
+		{At: now, Tags: []string{"a", "a", "b"}},
+		{Name: "x", At: now.Add(time.Hour), Tags: []string{"b", "c"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the repeated tags of the first result are kept, the tag of the earlier result is dropped
+	if ret.Name != "x" || !ret.At.Equal(now) || !slices.Equal(ret.Tags, []string{"a", "a", "b", "c"}) {
+		t.Errorf("got %+v", ret)
+	}
+}
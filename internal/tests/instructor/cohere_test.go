@@ -0,0 +1,235 @@
+package instructor_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+	cohereClient "github.com/cohere-ai/cohere-go/v2/client"
+	"github.com/cohere-ai/cohere-go/v2/option"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+)
+
+func TestCohereMCPToolLoop(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	forecast := mcp.NewTool("forecast", mcp.WithString("city", mcp.Required()))
+	srv.AddTool(forecast, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("sunny in " + req.GetString("city", "")), nil
+	})
+
+	var (
+		mu       sync.Mutex
+		requests []map[string]any
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		n := len(requests)
+		mu.Unlock()
+		resp := map[string]any{
+			"text": `{"forecast": "sunny"}`,
+			"meta": map[string]any{"tokens": map[string]any{"input_tokens": 10, "output_tokens": 5}},
+		}
+		if n == 1 {
+			resp["text"] = ""
+			resp["tool_calls"] = []map[string]any{{"name": "weather_forecast", "parameters": map[string]any{"city": "Shanghai"}}}
+			resp["chat_history"] = []map[string]any{{"role": "USER", "message": "weather in Shanghai?"}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer api.Close()
+
+	var steps []instructor.ToolStep
+	clt := instructors.FromCohere(
+		cohereClient.NewClient(option.WithBaseURL(api.URL), option.WithToken("test")),
+		instructor.WithMode(instructor.ModeJSON),
+		instructor.WithMCPTools(instructor.MCPTool{Client: newMCPTestClient(t, srv), ServerName: "weather", Tool: &forecast}),
+		instructor.WithToolStepHandler(func(ctx context.Context, step *instructor.ToolStep) {
+			steps = append(steps, *step)
+		}),
+	)
+	var (
+		result struct {
+			Forecast string `json:"forecast"`
+		}
+		resp cohere.NonStreamedChatResponse
+	)
+	if err := clt.Chat(context.Background(), &cohere.ChatRequest{Message: "weather in Shanghai?"}, &result, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if result.Forecast != "sunny" {
+		t.Errorf("got %+v", result)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests", len(requests))
+	}
+	if tools, _ := requests[0]["tools"].([]any); len(tools) != 1 {
+		t.Errorf("mcp tool not injected: %v", requests[0]["tools"])
+	}
+	results, _ := requests[1]["tool_results"].([]any)
+	if len(results) != 1 || requests[1]["chat_history"] == nil {
+		t.Fatalf("got follow up request %v", requests[1])
+	}
+	if bs, _ := json.Marshal(results[0]); !strings.Contains(string(bs), "sunny in Shanghai") {
+		t.Errorf("got tool result %s", bs)
+	}
+	if len(steps) != 1 || steps[0].Calls[0].Request.Params.Name != "forecast" {
+		t.Errorf("got steps %+v", steps)
+	}
+	if in := resp.Meta.Tokens.InputTokens; in == nil || *in != 20 {
+		t.Errorf("usage not aggregated: %v", in)
+	}
+}
+
+func TestCohereSchemaStreamToolLoop(t *testing.T) {
+	type Args struct {
+		Place string `json:"place"`
+	}
+	var places []string
+	lookup, err := instructor.NewLocalTool("lookup", "look up the city of a place", func(ctx context.Context, args Args) (string, error) {
+		places = append(places, args.Place)
+		return "Shanghai", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub, url := newAPIStub(t,
+		cohereStream(`{"event_type": "tool-calls-generation", "tool_calls": [{"name": "lookup", "parameters": {"place": "the Bund"}}]}`,
+			`{"event_type": "stream-end", "finish_reason": "COMPLETE", "response": {"text": "", "tool_calls": [{"name": "lookup", "parameters": {"place": "the Bund"}}], "chat_history": [{"role": "USER", "message": "Where is the Bund?"}], "meta": {"tokens": {"input_tokens": 10, "output_tokens": 5}}}}`),
+		cohereStream(`{"event_type": "text-generation", "text": "{\"city\": \"Shanghai\"}"}`,
+			`{"event_type": "stream-end", "finish_reason": "COMPLETE", "response": {"text": "{\"city\": \"Shanghai\"}", "meta": {"tokens": {"input_tokens": 10, "output_tokens": 5}}}}`),
+	)
+	client := instructors.FromCohere(cohereClient.NewClient(option.WithBaseURL(url), option.WithToken("test")), instructor.WithMode(instructor.ModeJSON), instructor.WithLocalTools(lookup))
+	type City struct {
+		City string `json:"city"`
+	}
+	itemCh, dataCh, err := client.SchemaStream(context.Background(), &cohere.ChatStreamRequest{Message: "Where is the Bund?"}, City{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		city  string
+		calls int
+		meta  *instructor.ResponseMeta
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for v := range itemCh {
+			city = v.(*City).City
+		}
+	}()
+	for v := range dataCh {
+		switch v.Type {
+		case instructor.ToolCallStream:
+			calls++
+		case instructor.ErrorStream:
+			t.Errorf("got stream error %v", v.Err)
+		case instructor.DoneStream:
+			meta = v.Meta
+		}
+	}
+	<-done
+	if city != "Shanghai" || calls != 1 || len(places) != 1 || places[0] != "the Bund" {
+		t.Errorf("got city %q, %d tool calls, places %v", city, calls, places)
+	}
+	requests := stub.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests", len(requests))
+	}
+	if results, _ := requests[1]["tool_results"].([]any); len(results) != 1 || requests[1]["message"] != "" {
+		t.Errorf("got follow up request %v", requests[1])
+	}
+	if meta == nil || meta.Usage.InputTokens != 20 || meta.Usage.OutputTokens != 10 {
+		t.Errorf("got meta %+v", meta)
+	}
+}
+
+// cohereStream renders the events as a stream of newline delimited JSON
+func cohereStream(events ...string) stubResponse {
+	return stubResponse{http.StatusOK, strings.Join(events, "\n") + "\n"}
+}
+
+func TestCohereToolCallError(t *testing.T) {
+	_, url := newAPIStub(t, stubResponse{http.StatusBadRequest, `{"message": "invalid request"}`})
+	client := instructors.FromCohere(cohereClient.NewClient(option.WithBaseURL(url), option.WithToken("test")), instructor.WithMode(instructor.ModeToolCall))
+	var (
+		result struct {
+			City string `json:"city"`
+		}
+		resp cohere.NonStreamedChatResponse
+	)
+	if err := client.Chat(context.Background(), &cohere.ChatRequest{Message: "Where is the Bund?"}, &result, &resp); err == nil || !strings.Contains(err.Error(), "invalid request") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// TestCohereToolChoice checks the tool choices on the chat API of Cohere which has no tool choice
+func TestCohereToolChoice(t *testing.T) {
+	type Result struct {
+		City string `json:"city"`
+	}
+	lookup, err := instructor.NewLocalTool("lookup", "look up the city of a place", func(ctx context.Context, args struct{}) (string, error) {
+		return "Shanghai", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toolNames := func(req map[string]any) []string {
+		tools, _ := req["tools"].([]any)
+		ret := make([]string, 0, len(tools))
+		for _, v := range tools {
+			tool, _ := v.(map[string]any)
+			name, _ := tool["name"].(string)
+			ret = append(ret, name)
+		}
+		return ret
+	}
+	for _, tc := range []struct {
+		name   string
+		mode   instructor.Mode
+		choice instructor.ToolChoice
+		resp   stubResponse
+		tools  []string
+	}{
+		{"none hides the tools", instructor.ModeJSON, instructor.ToolChoiceNone, cohereText(`{"city": "Shanghai"}`), []string{}},
+		{"required is ignored", instructor.ModeJSON, instructor.ToolChoiceRequired, cohereText(`{"city": "Shanghai"}`), []string{"lookup"}},
+		{
+			"none keeps the extraction tool", instructor.ModeToolCall, instructor.ToolChoiceNone,
+			stubResponse{http.StatusOK, `{"text": "", "tool_calls": [{"name": "functions", "parameters": {"city": "Shanghai"}}]}`},
+			[]string{"functions"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stub, url := newAPIStub(t, tc.resp)
+			client := instructors.FromCohere(cohereClient.NewClient(option.WithBaseURL(url), option.WithToken("test")),
+				instructor.WithMode(tc.mode),
+				instructor.WithLocalTools(lookup),
+				instructor.WithToolChoice(tc.choice),
+			)
+			var result Result
+			if err := client.Chat(context.Background(), &cohere.ChatRequest{Message: "Where is the Bund?"}, &result, nil); err != nil {
+				t.Fatal(err)
+			}
+			req := stub.Requests()[0]
+			if got := toolNames(req); result.City != "Shanghai" || !slices.Equal(got, tc.tools) {
+				t.Errorf("got %+v with tools %v", result, got)
+			}
+			if choice, ok := req["tool_choice"]; ok {
+				t.Errorf("got tool_choice %v", choice)
+			}
+		})
+	}
+}
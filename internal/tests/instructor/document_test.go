@@ -0,0 +1,106 @@
+package instructor_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+)
+
+func TestDocuments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"invoice.pdf": textPDF("Invoice total: 42"),
+		"items.csv":   "name,price\ncoffee,3\n",
+		"logo.png":    "\x89PNG\r\n\x1a\n0000",
+	}
+	paths := make([]string, 0, len(files))
+	for _, name := range []string{"invoice.pdf", "items.csv", "logo.png"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	msg, err := instructor.MessageFromPaths(instructor.UserRole, "total of the invoice?", paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Files) != 2 || msg.Files[0].MimeType != "application/pdf" || msg.Files[1].MimeType != "text/csv" {
+		t.Fatalf("got files %+v", msg.Files)
+	}
+	if len(msg.Images) != 1 || !strings.HasPrefix(msg.Images[0].URL, "data:image/png;base64,") {
+		t.Fatalf("got images %+v", msg.Images)
+	}
+
+	// the text layer of the PDF is extracted by default
+	var opts instructor.Options
+	converted := msg
+	if err := opts.PrepareDocuments(ctx, &converted, func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if len(converted.Files) != 0 || !strings.Contains(converted.Text, "Invoice total: 42") || !strings.Contains(converted.Text, "coffee,3") {
+		t.Errorf("got converted message %+v", converted)
+	}
+	docx := instructor.Message{Files: []instructor.File{{Name: "invoice.docx", Data: "UEsDBA==", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"}}}
+	if err := opts.PrepareDocuments(ctx, &docx, func(string) bool { return false }); err == nil {
+		t.Error("expected unsupported document error")
+	}
+	instructor.WithDocumentConverter(func(ctx context.Context, file instructor.File) (instructor.Message, error) {
+		return instructor.Message{Text: "converted " + file.Name}, nil
+	})(&opts)
+	if err := opts.PrepareDocuments(ctx, &docx, func(string) bool { return false }); err != nil || docx.Text != "File invoice.docx:\nconverted invoice.docx" {
+		t.Errorf("got converted message %+v, %v", docx, err)
+	}
+
+	stub, clt := newOpenAIStub(t)
+	stub.reset(openAICompletion(`{"total": 42}`, "", ""))
+	session := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON)).NewSession(&openai.ChatCompletionNewParams{Model: "gpt-test"}, nil)
+	var result struct {
+		Total int `json:"total"`
+	}
+	if _, err := session.Send(ctx, msg, &result); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := json.Marshal(stub.requests[0]["messages"])
+	if got := string(bs); !strings.Contains(got, `"file_data":"data:application/pdf;base64,`) || !strings.Contains(got, `File items.csv:\nname,price`) {
+		t.Errorf("got messages %s", got)
+	}
+}
+
+// textPDF renders a single page PDF showing the text
+func textPDF(text string) string {
+	content := fmt.Sprintf("BT /F1 12 Tf 72 712 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var (
+		sb      strings.Builder
+		offsets = make([]int, 0, len(objects))
+	)
+	sb.WriteString("%PDF-1.4\n")
+	for idx, v := range objects {
+		offsets = append(offsets, sb.Len())
+		fmt.Fprintf(&sb, "%d 0 obj\n%s\nendobj\n", idx+1, v)
+	}
+	xref := sb.Len()
+	fmt.Fprintf(&sb, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, v := range offsets {
+		fmt.Fprintf(&sb, "%010d 00000 n \n", v)
+	}
+	fmt.Fprintf(&sb, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return sb.String()
+}
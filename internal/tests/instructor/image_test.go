@@ -0,0 +1,105 @@
+package instructor_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/bububa/instructor-go"
+)
+
+func TestImagePipeline(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 1000, 400))
+	for y := range 400 {
+		for x := range 1000 {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	// insert an EXIF segment rotating the image 90 degrees clockwise
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	seg := append([]byte{0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(app1)+2))...)
+	data := append(append([]byte{0xFF, 0xD8}, append(seg, app1...)...), buf.Bytes()[2:]...)
+
+	img, err := instructor.DecodeImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 400 || b.Dy() != 1000 {
+		t.Fatalf("got oriented size %v", b)
+	}
+
+	media, err := instructor.ProcessImage(data, instructor.ImageOptions{MaxWidth: 200, MaxHeight: 200, Format: instructor.ImagePNG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.MimeType != "image/png" || bytes.Contains(media.Data, []byte("Exif")) {
+		t.Errorf("got media %s", media.MimeType)
+	}
+	processed, err := instructor.DecodeImage(media.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := processed.Bounds(); b.Dx() != 80 || b.Dy() != 200 {
+		t.Errorf("got resized size %v", b)
+	}
+	if _, err := instructor.EncodeImage(processed, instructor.ImageFormat("bmp"), 0); err == nil {
+		t.Error("expected error without bmp encoder")
+	}
+	// a 1x1 lossless WebP is decoded and re-encoded to JPEG
+	webp, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if media, err := instructor.ProcessImage(webp, instructor.ImageOptions{}); err != nil || media.MimeType != "image/jpeg" {
+		t.Errorf("got webp error %v", err)
+	}
+	media, err = instructor.ProcessImage(data, instructor.ImageOptions{MaxWidth: 200, MaxHeight: 200, Format: instructor.ImageWebP})
+	if err != nil || media.MimeType != "image/webp" {
+		t.Fatalf("got webp media %v", err)
+	}
+	if processed, err := instructor.DecodeImage(media.Data); err != nil || processed.Bounds().Dx() != 80 || processed.Bounds().Dy() != 200 {
+		t.Errorf("got webp error %v", err)
+	}
+
+	// the header of a 100000x100000 PNG is rejected before decoding the pixels
+	var huge bytes.Buffer
+	if err := png.Encode(&huge, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	header := huge.Bytes()
+	binary.BigEndian.PutUint32(header[16:], 100000)
+	binary.BigEndian.PutUint32(header[20:], 100000)
+	binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+	if _, err := instructor.DecodeImage(header); !errors.Is(err, instructor.ErrImageTooLarge) {
+		t.Errorf("got huge image error %v", err)
+	}
+
+	tiles := instructor.TileImage(img, 512, 64)
+	if len(tiles) != 3 || tiles[2].Bounds().Dy() != 1000-896 {
+		t.Errorf("got %d tiles", len(tiles))
+	}
+
+	for _, c := range []struct {
+		provider instructor.Provider
+		w, h     int
+		want     int
+	}{
+		{instructor.ProviderOpenAI, 1024, 1024, 765},
+		{instructor.ProviderAnthropic, 1000, 1000, 1334},
+		{instructor.ProviderGemini, 384, 384, 258},
+		{instructor.ProviderGemini, 1000, 1000, 1032},
+	} {
+		if got := instructor.EstimateImageTokens(c.provider, c.w, c.h, ""); got != c.want {
+			t.Errorf("%s %dx%d: got %d tokens, want %d", c.provider, c.w, c.h, got, c.want)
+		}
+	}
+}
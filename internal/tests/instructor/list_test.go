@@ -0,0 +1,75 @@
+package instructor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bububa/instructor-go"
+)
+
+type Item struct {
+	Name  string `json:"name" yaml:"name" toml:"name" validate:"required"`
+	Price int    `json:"price" yaml:"price" toml:"price"`
+}
+
+func TestChatList(t *testing.T) {
+	tests := []struct {
+		mode instructor.Mode
+		text string
+	}{
+		{
+			mode: instructor.ModeToolCall,
+			text: `{"items": [{"name": "apple", "price": 3}, {"name": "pear", "price": 5}]}`,
+		},
+		{
+			mode: instructor.ModeJSONSchema,
+			text: "Sure:\n```json\n{\"items\": [{\"name\": \"apple\", \"price\": 3}, {\"name\": \"pear\", \"price\": 5}]}\n```",
+		},
+		{
+			mode: instructor.ModeYAML,
+			text: "```yaml\nitems:\n  - name: apple\n    price: 3\n  - name: pear\n    price: 5\n```",
+		},
+		{
+			mode: instructor.ModeTOML,
+			text: "```toml\n[[items]]\nname = \"apple\"\nprice = 3\n\n[[items]]\nname = \"pear\"\nprice = 5\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			clt := newMockInstructor([]string{tt.text}, instructor.WithMode(tt.mode))
+			var (
+				items []Item
+				resp  mockResponse
+			)
+			if err := clt.Chat(context.Background(), &mockRequest{Text: "extract"}, &items, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 2 || items[0].Name != "apple" || items[1].Price != 5 {
+				t.Errorf("got %+v", items)
+			}
+		})
+	}
+}
+
+func TestChatListValidation(t *testing.T) {
+	clt := newMockInstructor([]string{
+		`{"items": [{"name": "apple", "price": 3}, {"price": 5}]}`,
+		`{"items": [{"name": "apple", "price": 3}, {"name": "pear", "price": 5}]}`,
+	}, instructor.WithMode(instructor.ModeJSON), instructor.WithValidation(), instructor.WithMaxRetries(1))
+	var (
+		items []Item
+		resp  mockResponse
+	)
+	if err := clt.Chat(context.Background(), &mockRequest{Text: "extract"}, &items, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(clt.requests) != 2 {
+		t.Errorf("expected a retry on the invalid item, got %d requests", len(clt.requests))
+	}
+	if len(items) != 2 || items[1].Name != "pear" {
+		t.Errorf("got %+v", items)
+	}
+	if schema := clt.Encoder().Context(); len(schema) == 0 {
+		t.Error("empty schema context")
+	}
+}
@@ -0,0 +1,80 @@
+package instructor_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bububa/instructor-go"
+	jsonenc "github.com/bububa/instructor-go/encoding/json"
+	tomlenc "github.com/bububa/instructor-go/encoding/toml"
+	yamlenc "github.com/bububa/instructor-go/encoding/yaml"
+)
+
+type Address struct {
+	City string `json:"city" yaml:"city" toml:"city" fake:"Shanghai"`
+}
+
+func TestMaybeJSONSchema(t *testing.T) {
+	enc, err := jsonenc.NewEncoder(&instructor.Maybe[Person]{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := enc.Schema()
+	if name := schema.NameFromRef(); name != "MaybePerson" {
+		t.Errorf("schema name got %q, want MaybePerson", name)
+	}
+	if _, ok := schema.Properties.Get("result"); !ok {
+		t.Error("schema missing result property")
+	}
+
+	var ret instructor.Maybe[Person]
+	if err := enc.Unmarshal([]byte(`{"error": true, "message": "no person mentioned"}`), &ret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ret.Unwrap(); !errors.Is(err, instructor.ErrNoResult) {
+		t.Errorf("Unwrap err got %v, want ErrNoResult", err)
+	}
+	if err := enc.Unmarshal([]byte(`{"result": {"name": "joe", "age": 25}, "error": false}`), &ret); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := ret.Unwrap(); err != nil || p.Name != "joe" {
+		t.Errorf("Unwrap got %+v, %v", p, err)
+	}
+}
+
+func TestMaybeYAMLAndTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  instructor.Encoder
+		want []byte
+		text string
+	}{
+		{
+			name: "yaml",
+			enc:  yamlenc.NewEncoder(instructor.Maybe[Address]{}),
+			want: []byte("city: Shanghai"),
+			text: "```yaml\nresult:\n  city: Beijing\nerror: false\n```",
+		},
+		{
+			name: "toml",
+			enc:  tomlenc.NewEncoder(instructor.Maybe[Address]{}),
+			want: []byte("city = \"Shanghai\""),
+			text: "```toml\nerror = false\n\n[result]\ncity = \"Beijing\"\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ctx := tt.enc.Context(); !bytes.Contains(ctx, tt.want) {
+				t.Errorf("context does not render the example result:\n%s", ctx)
+			}
+			var ret instructor.Maybe[Address]
+			if err := tt.enc.Unmarshal([]byte(tt.text), &ret); err != nil {
+				t.Fatal(err)
+			}
+			if !ret.Valid() || ret.Result.City != "Beijing" {
+				t.Errorf("got %+v", ret)
+			}
+		})
+	}
+}
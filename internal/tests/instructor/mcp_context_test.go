@@ -0,0 +1,64 @@
+package instructor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/bububa/instructor-go"
+)
+
+func TestMCPMessages(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0", server.WithResourceCapabilities(false, false), server.WithPromptCapabilities(false))
+	srv.AddResource(mcp.NewResource("file:///readme.md", "readme", mcp.WithMIMEType("text/markdown")), func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{mcp.TextResourceContents{URI: req.Params.URI, MIMEType: "text/markdown", Text: "# Readme"}}, nil
+	})
+	srv.AddResource(mcp.NewResource("file:///logo.png", "logo", mcp.WithMIMEType("image/png")), func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		return []mcp.ResourceContents{mcp.BlobResourceContents{URI: req.Params.URI, MIMEType: "image/png", Blob: "iVBORw0KGgo="}}, nil
+	})
+	srv.AddPrompt(mcp.NewPrompt("review", mcp.WithArgument("lang")), func(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return mcp.NewGetPromptResult("review", []mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Review the "+req.Params.Arguments["lang"]+" code")),
+			mcp.NewPromptMessage(mcp.RoleAssistant, mcp.NewTextContent("Sure")),
+		}), nil
+	})
+	clt := newMCPTestClient(t, srv)
+
+	var o instructor.Options
+	for _, opt := range []instructor.Option{
+		instructor.WithMCPPrompts(instructor.MCPPrompt{Client: clt, ServerName: "test", Name: "review", Arguments: map[string]string{"lang": "Go"}}),
+		instructor.WithMCPResources(
+			instructor.MCPResource{Client: clt, ServerName: "test", URI: "file:///readme.md"},
+			instructor.MCPResource{Client: clt, ServerName: "test", URI: "file:///logo.png"},
+		),
+	} {
+		opt(&o)
+	}
+	msgs, err := o.MCPMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(msgs))
+	}
+	if msgs[0].Role != instructor.UserRole || msgs[0].Text != "Review the Go code" {
+		t.Errorf("unexpected prompt message: %+v", msgs[0])
+	}
+	if msgs[1].Role != instructor.AssistantRole || msgs[1].Text != "Sure" {
+		t.Errorf("unexpected prompt message: %+v", msgs[1])
+	}
+	if msgs[2].Role != instructor.UserRole || msgs[2].Text != "Resource file:///readme.md:\n# Readme" {
+		t.Errorf("unexpected text resource message: %+v", msgs[2])
+	}
+	if len(msgs[3].Images) != 1 || msgs[3].Images[0].URL != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Errorf("unexpected blob resource message: %+v", msgs[3])
+	}
+
+	o = instructor.Options{}
+	instructor.WithMCPResources(instructor.MCPResource{Client: clt, ServerName: "test", URI: "file:///missing"})(&o)
+	if _, err := o.MCPMessages(context.Background()); err == nil {
+		t.Error("expected error reading missing resource")
+	}
+}
@@ -0,0 +1,118 @@
+package instructor_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/mcpserver"
+)
+
+func TestMCPServer(t *testing.T) {
+	type Input struct {
+		Text string `json:"text" jsonschema:"description=text to extract the person from"`
+	}
+	type Person struct {
+		Name string `json:"name" validate:"required"`
+		Age  int    `json:"age"`
+	}
+	clt := newMockInstructor([]string{`{"name": "Robby", "age": 22}`, `{"age": 30}`}, instructor.WithMode(instructor.ModeJSON), instructor.WithValidation())
+	extractor, err := mcpserver.NewExtractor[Input, Person]("extract_person", "extract the person", "Extract the person from: {{.Text}}", clt, func(prompt string) *mockRequest {
+		return &mockRequest{Text: prompt}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool := extractor.Tool(); !strings.Contains(string(tool.RawInputSchema), `"text"`) || tool.OutputSchema.Type != "object" {
+		t.Errorf("got tool %+v", tool)
+	}
+	srv := mcpserver.NewServer("extractors", "1.0.0", []*mcpserver.Extractor{extractor})
+	httpSrv := httptest.NewServer(srv.StreamableHTTP())
+	defer httpSrv.Close()
+
+	mcpClt, err := client.NewStreamableHttpClient(httpSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mcpClt.Close()
+	ctx := context.Background()
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	if _, err := mcpClt.Initialize(ctx, initReq); err != nil {
+		t.Fatal(err)
+	}
+	tools, err := mcpClt.ListTools(ctx, mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools.Tools) != 1 || tools.Tools[0].Name != "extract_person" {
+		t.Fatalf("got tools %+v", tools.Tools)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "extract_person"
+	req.Params.Arguments = map[string]any{"text": "Robby is 22 years old."}
+	result, err := mcpClt.CallTool(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("got error result %+v", result)
+	}
+	if got := result.StructuredContent.(map[string]any); got["name"] != "Robby" || got["age"] != float64(22) {
+		t.Errorf("got structured content %+v", result.StructuredContent)
+	}
+	if got := clt.requests[0].Text; got != "Extract the person from: Robby is 22 years old." {
+		t.Errorf("got prompt %q", got)
+	}
+
+	result, err = mcpClt.CallTool(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsError {
+		t.Errorf("expected validation error, got %+v", result)
+	}
+
+	// the calls of the extractor are not serialized, every call waits for the others to start
+	const calls = 3
+	var (
+		wg      sync.WaitGroup
+		started sync.WaitGroup
+	)
+	started.Add(calls)
+	clt.respond = func(request *mockRequest) string {
+		started.Done()
+		done := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return `{"name": "Robby", "age": 22}`
+		case <-time.After(5 * time.Second):
+			return `{}`
+		}
+	}
+	for range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := mcpClt.CallTool(ctx, req)
+			if err != nil {
+				t.Error(err)
+			} else if result.IsError {
+				t.Errorf("got error result %+v", result)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,83 @@
+package instructor_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	anthropicapi "github.com/liushuangls/go-anthropic/v2"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors/anthropic"
+)
+
+func TestMediaLoader(t *testing.T) {
+	ctx := context.Background()
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/large" {
+			w.Write(make([]byte, 64))
+			return
+		}
+		w.Write(png)
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "receipt.png"), png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	memory := instructor.NewInMemoryMediaLoader()
+	memory.Add("mem://receipt", png, "")
+	loader := instructor.NewCachedMediaLoader(instructor.MediaRouter{
+		"data": instructor.DefaultMediaLoader,
+		"file": &instructor.FileMediaLoader{Root: dir},
+		"http": instructor.NewHTTPMediaLoader(srv.Client(), time.Second, 32),
+		"mem":  memory,
+	}, 10)
+
+	for _, link := range []string{
+		"data:image/png;base64,iVBORw0KGgowMDAw",
+		"file:///receipt.png",
+		srv.URL + "/receipt.png",
+		srv.URL + "/receipt.png",
+		"mem://receipt",
+	} {
+		media, err := loader.Load(ctx, link)
+		if err != nil {
+			t.Fatalf("%s: %v", link, err)
+		}
+		if media.MimeType != "image/png" || string(media.Data) != string(png) {
+			t.Errorf("%s: got %s %q", link, media.MimeType, media.Data)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("got %d http requests", hits)
+	}
+	if _, err := loader.Load(ctx, srv.URL+"/large"); !errors.Is(err, instructor.ErrMediaTooLarge) {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := loader.Load(ctx, "file:///../../etc/passwd"); err == nil {
+		t.Error("expected error reading outside the root")
+	}
+	if _, err := instructor.DefaultMediaLoader.Load(ctx, "file:///etc/passwd"); err == nil {
+		t.Error("expected the default loader to refuse file links")
+	}
+
+	var msg anthropicapi.Message
+	err := anthropic.ConvertMessageFromContext(ctx, loader, &instructor.Message{
+		Role:   instructor.UserRole,
+		Text:   "total of the receipt?",
+		Images: []instructor.Image{{URL: "mem://missing"}},
+	}, &msg)
+	if err == nil || !strings.Contains(err.Error(), "load image") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package instructor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bububa/instructor-go"
+)
+
+func TestMemoryStrategies(t *testing.T) {
+	ctx := context.Background()
+	conversation := []instructor.Message{
+		{Role: instructor.SystemRole, Text: "You are a weather bot."},
+		{Role: instructor.UserRole, Text: "weather in Shanghai?"},
+		{Role: instructor.AssistantRole, ToolUses: []instructor.ToolUse{{ID: "1", Name: "forecast", Arguments: `{"city":"Shanghai"}`}}},
+		{Role: instructor.ToolRole, ToolResults: []instructor.ToolResult{{ID: "1", Name: "forecast", Content: "sunny"}}},
+		{Role: instructor.AssistantRole, Text: "It is sunny."},
+		{Role: instructor.UserRole, Text: "and tomorrow?"},
+	}
+	texts := func(list []instructor.Message) []string {
+		ret := make([]string, 0, len(list))
+		for _, v := range list {
+			ret = append(ret, string(v.Role)+":"+v.Text)
+		}
+		return ret
+	}
+
+	m := instructor.NewMemory(0, instructor.KeepSystem(instructor.WindowByCount(3)))
+	m.Set(conversation)
+	list, err := m.Messages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the window starting with a tool result drops it
+	if got := strings.Join(texts(list), "|"); got != "system:You are a weather bot.|assistant:It is sunny.|user:and tomorrow?" {
+		t.Errorf("window by count got %s", got)
+	}
+
+	m = instructor.NewMemory(0, instructor.WindowByTokens(20, nil))
+	m.Set(conversation)
+	if list, _ = m.Messages(ctx); len(list) != 2 {
+		t.Errorf("window by tokens got %v", texts(list))
+	}
+
+	var summarized []instructor.Message
+	m = instructor.NewMemory(0, instructor.SummarizeOlder(func(ctx context.Context, list []instructor.Message) (string, error) {
+		summarized = list
+		return "the user asked about the weather in Shanghai", nil
+	}, 4, 2))
+	m.Set(conversation)
+	if list, _ = m.Messages(ctx); len(list) != 3 || !strings.Contains(list[0].Text, "weather in Shanghai") || len(summarized) != 4 {
+		t.Errorf("summarize got %v, summarized %d messages", texts(list), len(summarized))
+	}
+	// the memory is compacted in place
+	if len(m.List()) != 3 {
+		t.Errorf("memory not compacted: %d", len(m.List()))
+	}
+
+	// the negative sizes are treated as 0
+	if list, err := instructor.WindowByCount(-1).Compact(ctx, conversation); err != nil || len(list) != 0 {
+		t.Errorf("window by negative count got %v, %v", texts(list), err)
+	}
+	list, err = instructor.SummarizeOlder(func(ctx context.Context, list []instructor.Message) (string, error) {
+		return "summary", nil
+	}, 0, -1).Compact(ctx, conversation)
+	if err != nil || len(list) != 1 {
+		t.Errorf("summarize with negative keep got %v, %v", texts(list), err)
+	}
+
+	newRequest := func(prompt string) *mockRequest {
+		return &mockRequest{Text: prompt}
+	}
+	summarizer := instructor.NewChatSummarizer(newMockInstructor([]string{`{"summary": "weather talk"}`, `{"summary": "more weather talk"}`}, instructor.WithMode(instructor.ModeJSON)), newRequest)
+	for _, want := range []string{"weather talk", "more weather talk"} {
+		if summary, err := summarizer(ctx, conversation); err != nil || summary != want {
+			t.Errorf("chat summarizer got %q, %v", summary, err)
+		}
+	}
+
+	// the instructor extracting another response type keeps its encoder
+	shared := newMockInstructor([]string{`{"city": "Shanghai"}`}, instructor.WithMode(instructor.ModeJSON))
+	var city struct {
+		City string `json:"city"`
+	}
+	if err := shared.Chat(ctx, &mockRequest{Text: "Where is the Bund?"}, &city, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instructor.NewChatSummarizer(shared, newRequest)(ctx, conversation); !errors.Is(err, instructor.ErrSummarizerEncoder) {
+		t.Errorf("shared chat summarizer got error %v", err)
+	}
+}
+
+func TestMemoryConcurrentCompact(t *testing.T) {
+	ctx := context.Background()
+	slow := instructor.MemoryStrategyFunc(func(ctx context.Context, list []instructor.Message) ([]instructor.Message, error) {
+		time.Sleep(time.Millisecond)
+		return instructor.WindowByCount(2).Compact(ctx, list)
+	})
+	m := instructor.NewMemory(0, slow)
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch i % 4 {
+			case 0:
+				m.Set(make([]instructor.Message, 10))
+			case 1:
+				m.Add(instructor.Message{Role: instructor.UserRole, Text: fmt.Sprintf("message %d", i)})
+			default:
+				if _, err := m.Messages(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if list, err := m.Messages(ctx); err != nil || len(list) != 2 {
+		t.Errorf("got %d messages, %v", len(list), err)
+	}
+	var nilMemory *instructor.Memory
+	if err := nilMemory.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	jsonl, err := instructor.NewJSONLStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]instructor.MemoryStore{
+		"memory": instructor.NewInMemoryStore(),
+		"jsonl":  jsonl,
+	} {
+		t.Run(name, func(t *testing.T) {
+			memory, err := instructor.LoadMemory(ctx, store, "user/1", instructor.WindowByCount(4))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wg sync.WaitGroup
+			for i := range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					memory.Add(instructor.Message{Role: instructor.UserRole, Text: fmt.Sprintf("message %d", i)})
+				}()
+			}
+			wg.Wait()
+			if err := memory.Err(); err != nil {
+				t.Fatal(err)
+			}
+			restored, err := instructor.LoadMemory(ctx, store, "user/1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := restored.List(); len(got) != 10 {
+				t.Fatalf("got %d messages", len(got))
+			}
+			if err := memory.Compact(ctx); err != nil {
+				t.Fatal(err)
+			}
+			list, err := store.Load(ctx, "user/1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 4 || list[3].Text != memory.List()[3].Text {
+				t.Errorf("got compacted messages %+v", list)
+			}
+			if list, _ := store.Load(ctx, "user/2"); len(list) != 0 {
+				t.Errorf("got messages of another conversation %+v", list)
+			}
+		})
+	}
+}
+
+// blockingStore blocks the appends until released and fails them with err
+type blockingStore struct {
+	*instructor.InMemoryStore
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (s *blockingStore) Append(ctx context.Context, conversationID string, list ...instructor.Message) error {
+	close(s.started)
+	<-s.release
+	return s.err
+}
+
+func TestMemoryStoreWrite(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingStore{
+		InMemoryStore: instructor.NewInMemoryStore(),
+		started:       make(chan struct{}),
+		release:       make(chan struct{}),
+		err:           errors.New("disk full"),
+	}
+	memory, err := instructor.LoadMemory(ctx, store, "user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- memory.AddContext(ctx, instructor.Message{Role: instructor.UserRole, Text: "hello"})
+	}()
+	<-store.started
+	// the messages are readable while the store is written
+	if list := memory.List(); len(list) != 1 {
+		t.Errorf("got messages %+v", list)
+	}
+	close(store.release)
+	if err := <-done; !errors.Is(err, store.err) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	memory := instructor.NewMemory(0)
+	memory.Add(
+		instructor.Message{Role: instructor.UserRole, Text: "weather in Shanghai?", Audios: []instructor.Audio{{Data: "UklGRg==", Format: "wav"}}},
+		instructor.Message{Role: instructor.AssistantRole, Thinking: "need the forecast", ToolUses: []instructor.ToolUse{{ID: "call_abc", Name: "forecast", Arguments: `{"city":"Shanghai"}`}}},
+		instructor.Message{Role: instructor.ToolRole, ToolResults: []instructor.ToolResult{{ID: "call_abc", Content: "sunny"}}},
+	)
+	snapshot := memory.Snapshot(instructor.ProviderOpenAI)
+	for name, write := range map[string]func(w *strings.Builder) error{
+		"json":  func(w *strings.Builder) error { return snapshot.WriteJSON(w) },
+		"jsonl": func(w *strings.Builder) error { return snapshot.WriteJSONL(w) },
+	} {
+		var sb strings.Builder
+		if err := write(&sb); err != nil {
+			t.Fatal(err)
+		}
+		got, err := instructor.ReadMemorySnapshot(strings.NewReader(sb.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Provider != instructor.ProviderOpenAI || !reflect.DeepEqual(got.Messages, snapshot.Messages) {
+			t.Errorf("%s: got %+v", name, got)
+		}
+	}
+	if _, err := instructor.ReadMemorySnapshot(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("expected unsupported version error")
+	}
+
+	translated := snapshot.Translate(instructor.ProviderAnthropic).Messages
+	if translated[0].Text != "[audio omitted]\nweather in Shanghai?" || len(translated[0].Audios) != 0 {
+		t.Errorf("got user message %+v", translated[0])
+	}
+	use, result := translated[1].ToolUses[0], translated[2].ToolResults[0]
+	if translated[1].Thinking != "" || use.ID != "toolu_1" || result.ID != use.ID || result.Name != "forecast" {
+		t.Errorf("got tool turn %+v %+v", translated[1], translated[2])
+	}
+	if got := instructor.Translate(snapshot.Messages, instructor.ProviderOpenAI, instructor.ProviderGemini)[2].ToolResults[0].Content; got != `{"result":"sunny"}` {
+		t.Errorf("got gemini tool result %s", got)
+	}
+}
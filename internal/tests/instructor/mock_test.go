@@ -0,0 +1,154 @@
+package instructor_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/internal/chat"
+)
+
+type mockRequest struct {
+	Text string
+}
+
+type mockResponse struct {
+	Text  string
+	Usage instructor.UsageSum
+}
+
+// mockInstructor replays canned responses, used to test the provider independent code paths
+type mockInstructor struct {
+	instructor.Options
+	mu        sync.Mutex
+	responses []string
+	requests  []mockRequest
+	streams   [][]instructor.StreamData
+	// respond picks the response by the request instead of the call order, e.g. for concurrent calls
+	respond func(request *mockRequest) string
+}
+
+var (
+	_ instructor.ChatInstructor[mockRequest, mockResponse]         = (*mockInstructor)(nil)
+	_ instructor.SchemaStreamInstructor[mockRequest, mockResponse] = (*mockInstructor)(nil)
+)
+
+func newMockInstructor(responses []string, opts ...instructor.Option) *mockInstructor {
+	i := &mockInstructor{
+		responses: responses,
+	}
+	for _, opt := range opts {
+		opt(&i.Options)
+	}
+	instructor.WithProvider("mock")(&i.Options)
+	if i.Memory() == nil {
+		i.SetMemory(instructor.NewMemory(-1))
+	}
+	return i
+}
+
+func (i *mockInstructor) SetMemory(m *instructor.Memory) {
+	instructor.WithMemory(m)(&i.Options)
+}
+
+func (i *mockInstructor) Chat(ctx context.Context, request *mockRequest, responseType any, response *mockResponse) error {
+	return chat.Handler(i, ctx, request, responseType, response)
+}
+
+func (i *mockInstructor) Handler(ctx context.Context, request *mockRequest, response *mockResponse) (string, error) {
+	text, err := i.next(request)
+	if err != nil {
+		return "", err
+	}
+	if response != nil {
+		*response = mockResponse{
+			Text: text,
+			Usage: instructor.UsageSum{
+				InputTokens:  int64(len(request.Text)),
+				OutputTokens: int64(len(text)),
+				TotalTokens:  int64(len(request.Text) + len(text)),
+			},
+		}
+	}
+	return text, nil
+}
+
+// next records the request and picks the response, respond is called without holding the lock
+func (i *mockInstructor) next(request *mockRequest) (string, error) {
+	i.mu.Lock()
+	i.requests = append(i.requests, *request)
+	respond := i.respond
+	if respond == nil {
+		defer i.mu.Unlock()
+		if len(i.responses) == 0 {
+			return "", errors.New("no more responses")
+		}
+		text := i.responses[0]
+		i.responses = i.responses[1:]
+		return text, nil
+	}
+	i.mu.Unlock()
+	return respond(request), nil
+}
+
+func (i *mockInstructor) SchemaStream(ctx context.Context, request *mockRequest, responseType any, response *mockResponse) (<-chan any, <-chan instructor.StreamData, error) {
+	return chat.SchemaStreamHandler(i, ctx, request, responseType, response)
+}
+
+func (i *mockInstructor) SchemaStreamHandler(ctx context.Context, request *mockRequest, response *mockResponse) (<-chan instructor.StreamData, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.requests = append(i.requests, *request)
+	if len(i.streams) == 0 {
+		return nil, errors.New("no more streams")
+	}
+	list := i.streams[0]
+	i.streams = i.streams[1:]
+	ch := make(chan instructor.StreamData)
+	go func() {
+		defer close(ch)
+		for _, v := range list {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- v:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (i *mockInstructor) EmptyResponseWithUsageSum(ret *mockResponse, usage *instructor.UsageSum) {
+	if ret == nil || usage == nil {
+		return
+	}
+	*ret = mockResponse{Usage: *usage}
+}
+
+func (i *mockInstructor) EmptyResponseWithResponseUsage(ret *mockResponse, response *mockResponse) {
+	if ret == nil {
+		return
+	}
+	if response == nil {
+		*ret = mockResponse{}
+		return
+	}
+	*ret = mockResponse{Usage: response.Usage}
+}
+
+func (i *mockInstructor) SetUsageSumToResponse(response *mockResponse, usage *instructor.UsageSum) {
+	if response == nil || usage == nil {
+		return
+	}
+	response.Usage = *usage
+}
+
+func (i *mockInstructor) CountUsageFromResponse(response *mockResponse, usage *instructor.UsageSum) {
+	if response == nil || usage == nil {
+		return
+	}
+	usage.InputTokens += response.Usage.InputTokens
+	usage.OutputTokens += response.Usage.OutputTokens
+	usage.TotalTokens += response.Usage.TotalTokens
+}
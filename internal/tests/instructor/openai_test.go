@@ -0,0 +1,401 @@
+package instructor_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+)
+
+// openAIStub replays the queued chat completions and records the requests
+type openAIStub struct {
+	mu        sync.Mutex
+	requests  []map[string]any
+	responses [][]byte
+}
+
+func newOpenAIStub(t *testing.T) (*openAIStub, *openai.Client) {
+	stub := new(openAIStub)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		stub.requests = append(stub.requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(stub.responses[0])
+		stub.responses = stub.responses[1:]
+	}))
+	t.Cleanup(api.Close)
+	clt := openai.NewClient(option.WithBaseURL(api.URL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+	return stub, &clt
+}
+
+func (s *openAIStub) reset(responses ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.responses = responses
+}
+
+func openAICompletion(content string, toolName string, args string) []byte {
+	msg := map[string]any{"role": "assistant", "content": content}
+	if toolName != "" {
+		msg["tool_calls"] = []map[string]any{{"id": "call_1", "type": "function", "function": map[string]any{"name": toolName, "arguments": args}}}
+	}
+	bs, _ := json.Marshal(map[string]any{
+		"id":      "chatcmpl-1",
+		"object":  "chat.completion",
+		"model":   "gpt-test",
+		"choices": []map[string]any{{"index": 0, "finish_reason": "stop", "message": msg}},
+		"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+	})
+	return bs
+}
+
+func TestOpenAIToolChoice(t *testing.T) {
+	stub, clt := newOpenAIStub(t)
+	type Result struct {
+		City string `json:"city"`
+	}
+	newRequest := func() *openai.ChatCompletionNewParams {
+		return &openai.ChatCompletionNewParams{
+			Model:    "gpt-test",
+			Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Where is the Bund?")},
+		}
+	}
+
+	t.Run("forced extraction", func(t *testing.T) {
+		stub.reset(openAICompletion("", "instructor-go-func", `{"city": "Shanghai"}`))
+		client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeToolCall), instructor.WithForcedExtraction())
+		var result Result
+		if err := client.Chat(context.Background(), newRequest(), &result, nil); err != nil {
+			t.Fatal(err)
+		}
+		if result.City != "Shanghai" {
+			t.Errorf("got %+v", result)
+		}
+		choice, _ := stub.requests[0]["tool_choice"].(map[string]any)
+		if fn, _ := choice["function"].(map[string]any); fn["name"] != "instructor-go-func" {
+			t.Errorf("got tool_choice %v", stub.requests[0]["tool_choice"])
+		}
+	})
+
+	t.Run("required on first step", func(t *testing.T) {
+		stub.reset(
+			openAICompletion("", "lookup", `{"place": "the Bund"}`),
+			openAICompletion(`{"city": "Shanghai"}`, "", ""),
+		)
+		type Args struct {
+			Place string `json:"place"`
+		}
+		lookup, err := instructor.NewLocalTool("lookup", "look up the city of a place", func(ctx context.Context, args Args) (string, error) {
+			return "Shanghai", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := instructors.FromOpenAI(clt,
+			instructor.WithMode(instructor.ModeJSON),
+			instructor.WithLocalTools(lookup),
+			instructor.WithToolChoice(instructor.ToolChoiceRequired),
+		)
+		var result Result
+		if err := client.Chat(context.Background(), newRequest(), &result, nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(stub.requests) != 2 || stub.requests[0]["tool_choice"] != "required" || stub.requests[1]["tool_choice"] != "auto" {
+			t.Errorf("got requests %v", stub.requests)
+		}
+	})
+
+	t.Run("none keeps the extraction tool", func(t *testing.T) {
+		stub.reset(openAICompletion("", "instructor-go-func", `{"city": "Shanghai"}`))
+		client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeToolCall), instructor.WithToolChoice(instructor.ToolChoiceNone))
+		var result Result
+		if err := client.Chat(context.Background(), newRequest(), &result, nil); err != nil {
+			t.Fatal(err)
+		}
+		if result.City != "Shanghai" {
+			t.Errorf("got %+v", result)
+		}
+		if choice, ok := stub.requests[0]["tool_choice"]; ok {
+			t.Errorf("got tool_choice %v", choice)
+		}
+	})
+
+	lookup, err := instructor.NewLocalTool("lookup", "look up the city of a place", func(ctx context.Context, args struct{}) (string, error) {
+		return "Shanghai", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("none hides the tools", func(t *testing.T) {
+		stub.reset(openAICompletion(`{"city": "Shanghai"}`, "", ""))
+		client := instructors.FromOpenAI(clt,
+			instructor.WithMode(instructor.ModeJSON),
+			instructor.WithLocalTools(lookup),
+			instructor.WithToolChoice(instructor.ToolChoiceNone),
+		)
+		var result Result
+		if err := client.Chat(context.Background(), newRequest(), &result, nil); err != nil {
+			t.Fatal(err)
+		}
+		if tools, ok := stub.requests[0]["tools"]; ok {
+			t.Errorf("got tools %v", tools)
+		}
+	})
+
+	t.Run("none hides the tools of the tool call stream", func(t *testing.T) {
+		stub, url := newAPIStub(t, openAIToolCallStream("instructor-go-func", `{"items": [{"city": "Shanghai"}]}`))
+		clt := openai.NewClient(option.WithBaseURL(url), option.WithAPIKey("test"), option.WithMaxRetries(0))
+		client := instructors.FromOpenAI(&clt,
+			instructor.WithMode(instructor.ModeToolCall),
+			instructor.WithLocalTools(lookup),
+			instructor.WithToolChoice(instructor.ToolChoiceNone),
+		)
+		for _, err := range instructor.SchemaStreamEvents[Result](context.Background(), client, newRequest(), nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		req := stub.Requests()[0]
+		tools, _ := req["tools"].([]any)
+		if _, ok := req["tool_choice"]; ok || len(tools) != 1 || !strings.Contains(fmt.Sprint(tools[0]), "instructor-go-func") {
+			t.Errorf("got tools %v, tool_choice %v", tools, req["tool_choice"])
+		}
+	})
+
+	t.Run("forced extraction ignores the request tools", func(t *testing.T) {
+		stub.reset(openAICompletion(`{"city": "Shanghai"}`, "", ""))
+		client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON), instructor.WithForcedExtraction())
+		req := newRequest()
+		req.Tools = []openai.ChatCompletionToolParam{{Function: openai.FunctionDefinitionParam{Name: "weather"}}}
+		var result Result
+		if err := client.Chat(context.Background(), req, &result, nil); err != nil {
+			t.Fatal(err)
+		}
+		if choice, ok := stub.requests[0]["tool_choice"]; ok {
+			t.Errorf("got tool_choice %v", choice)
+		}
+	})
+}
+
+func TestOpenAIMemoryInjection(t *testing.T) {
+	stub, clt := newOpenAIStub(t)
+	stub.reset(openAICompletion(`{"city": "Shanghai"}`, "", ""), openAICompletion(`{"city": "Beijing"}`, "", ""))
+	client := instructors.FromOpenAI(clt,
+		instructor.WithMode(instructor.ModeJSON),
+		instructor.WithMemory(instructor.NewMemory(0, instructor.KeepSystem(instructor.WindowByCount(10)))),
+		instructor.WithMemoryInjection(),
+	)
+	var result struct {
+		City string `json:"city"`
+	}
+	for _, question := range []string{"Where is the Bund?", "Where is the Forbidden City?"} {
+		req := &openai.ChatCompletionNewParams{
+			Model: "gpt-test",
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage("You are a travel guide."),
+				openai.UserMessage(question),
+			},
+		}
+		if err := client.Chat(context.Background(), req, &result, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, _ := stub.requests[1]["messages"].([]any)
+	roles := make([]string, 0, len(messages))
+	for _, v := range messages {
+		roles = append(roles, v.(map[string]any)["role"].(string))
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Errorf("got roles %s", got)
+	}
+	if bs, _ := json.Marshal(messages[1]); !strings.Contains(string(bs), "Where is the Bund?") {
+		t.Errorf("got injected message %s", bs)
+	}
+	if len(client.Memory().List()) != 4 {
+		t.Errorf("got memory %+v", client.Memory().List())
+	}
+}
+
+func TestOpenAISession(t *testing.T) {
+	stub, clt := newOpenAIStub(t)
+	stub.reset(openAICompletion(`{"city": "Shanghai"}`, "", ""), openAICompletion(`{"city": "Beijing"}`, "", ""))
+	client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON))
+	session := client.NewSession(&openai.ChatCompletionNewParams{
+		Model:    "gpt-test",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.SystemMessage("You are a travel guide.")},
+	}, nil)
+	var result struct {
+		City string `json:"city"`
+	}
+	for _, question := range []string{"Where is the Bund?", "Where is the Forbidden City?"} {
+		if _, err := session.SendText(context.Background(), question, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.City != "Beijing" {
+		t.Errorf("got %+v", result)
+	}
+	messages, _ := stub.requests[1]["messages"].([]any)
+	if len(messages) != 4 {
+		t.Fatalf("got messages %v", messages)
+	}
+	if bs, _ := json.Marshal(messages[2]); !strings.Contains(string(bs), `\"city\":\"Shanghai\"`) {
+		t.Errorf("got replayed reply %s", bs)
+	}
+	if list := session.Memory().List(); len(list) != 4 || list[3].Role != instructor.AssistantRole {
+		t.Errorf("got memory %+v", list)
+	}
+}
+
+func TestOpenAIMaxToolIterations(t *testing.T) {
+	type Args struct {
+		Place string `json:"place"`
+	}
+	var calls int
+	lookup, err := instructor.NewLocalTool("lookup", "look up the city of a place", func(ctx context.Context, args Args) (string, error) {
+		calls++
+		return "unknown", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		City string `json:"city"`
+	}
+	request := &openai.ChatCompletionNewParams{
+		Model:    "gpt-test",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Where is the Bund?")},
+	}
+
+	t.Run("chat", func(t *testing.T) {
+		stub, clt := newOpenAIStub(t)
+		stub.reset(
+			openAICompletion("", "lookup", `{"place": "the Bund"}`),
+			openAICompletion("", "lookup", `{"place": "the Bund"}`),
+			openAICompletion("", "lookup", `{"place": "the Bund"}`),
+		)
+		calls = 0
+		client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON), instructor.WithLocalTools(lookup), instructor.WithMaxToolIterations(2))
+		if err := client.Chat(context.Background(), request, &result, nil); !errors.Is(err, instructor.ErrMaxToolIterations) {
+			t.Errorf("got error %v", err)
+		}
+		if len(stub.requests) != 3 || calls != 2 {
+			t.Errorf("got %d requests, %d tool calls", len(stub.requests), calls)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		stub, url := newAPIStub(t,
+			openAIToolCallStream("lookup", `{"place": "the Bund"}`),
+			openAIToolCallStream("lookup", `{"place": "the Bund"}`),
+			openAIToolCallStream("lookup", `{"place": "the Bund"}`),
+		)
+		calls = 0
+		clt := openai.NewClient(option.WithBaseURL(url), option.WithAPIKey("test"), option.WithMaxRetries(0))
+		client := instructors.FromOpenAI(&clt, instructor.WithMode(instructor.ModeJSON), instructor.WithLocalTools(lookup), instructor.WithMaxToolIterations(2))
+		itemCh, dataCh, err := client.SchemaStream(context.Background(), request, &result, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var streamErr error
+		go func() {
+			for range itemCh {
+			}
+		}()
+		for v := range dataCh {
+			if v.Type == instructor.ErrorStream {
+				streamErr = v.Err
+			}
+		}
+		if !errors.Is(streamErr, instructor.ErrMaxToolIterations) || len(stub.Requests()) != 3 || calls != 2 {
+			t.Errorf("got error %v after %d requests, %d tool calls", streamErr, len(stub.Requests()), calls)
+		}
+	})
+}
+
+func TestOpenAISchemaStreamUsage(t *testing.T) {
+	chunk := func(content string, usage string) string {
+		return fmt.Sprintf(`{"id": "chatcmpl-1", "object": "chat.completion.chunk", "model": "gpt-test", "choices": [{"index": 0, "delta": {"content": %q}}], "usage": %s}`, content, usage)
+	}
+	request := &openai.ChatCompletionNewParams{
+		Model:    "gpt-test",
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Where is the Bund?")},
+	}
+	type Result struct {
+		City string `json:"city"`
+	}
+
+	t.Run("cumulative usage", func(t *testing.T) {
+		// the compatible servers sending the cumulative usage in every chunk
+		_, url := newAPIStub(t, sseEvents(
+			chunk(`{"items": [{"city": `, `{"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12}`),
+			chunk(`"Shanghai"}]}`, `{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}`),
+			"[DONE]",
+		))
+		clt := openai.NewClient(option.WithBaseURL(url), option.WithAPIKey("test"), option.WithMaxRetries(0))
+		client := instructors.FromOpenAI(&clt, instructor.WithMode(instructor.ModeJSON))
+		var (
+			items []Result
+			usage instructor.UsageSum
+		)
+		for ev, err := range instructor.SchemaStreamEvents[Result](context.Background(), client, request, nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch v := ev.(type) {
+			case instructor.Item[Result]:
+				items = append(items, *v.Value)
+			case instructor.Usage:
+				usage = v.UsageSum
+			}
+		}
+		if len(items) != 1 || items[0].City != "Shanghai" || usage.InputTokens != 10 || usage.OutputTokens != 5 || usage.TotalTokens != 15 {
+			t.Errorf("got items %+v, usage %+v", items, usage)
+		}
+	})
+
+	t.Run("abandoned", func(t *testing.T) {
+		events := make([]string, 0, 101)
+		for range 100 {
+			events = append(events, chunk(" ", "null"))
+		}
+		_, url := newAPIStub(t, sseEvents(append(events, "[DONE]")...))
+		httpClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		clt := openai.NewClient(option.WithBaseURL(url), option.WithAPIKey("test"), option.WithMaxRetries(0), option.WithHTTPClient(httpClient))
+		client := instructors.FromOpenAI(&clt, instructor.WithMode(instructor.ModeJSON))
+		before := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := client.SchemaStreamHandler(ctx, request, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the consumer stops reading once the context is cancelled
+		<-ch
+		cancel()
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := runtime.NumGoroutine(); n > before {
+			t.Errorf("goroutines leaked: %d before, %d after", before, n)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package instructor_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	cohere "github.com/cohere-ai/cohere-go/v2"
+	cohereClient "github.com/cohere-ai/cohere-go/v2/client"
+	"github.com/cohere-ai/cohere-go/v2/option"
+	anthropicapi "github.com/liushuangls/go-anthropic/v2"
+	"google.golang.org/genai"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+	"github.com/bububa/instructor-go/instructors/gemini"
+)
+
+type sessionCity struct {
+	City string `json:"city"`
+}
+
+var sessionQuestions = []string{"Where is the Bund?", "Where is the Forbidden City?"}
+
+func TestAnthropicSession(t *testing.T) {
+	stub, url := newAPIStub(t, anthropicText(`{"city": "Shanghai"}`), anthropicText(`{"city": "Beijing"}`))
+	client := instructors.FromAnthropic(anthropicapi.NewClient("test", anthropicapi.WithBaseURL(url)), instructor.WithMode(instructor.ModeJSON))
+	session := client.NewSession(&anthropicapi.MessagesRequest{Model: "claude-test", MaxTokens: 100, System: "You are a travel guide."}, nil)
+	var result sessionCity
+	for _, question := range sessionQuestions {
+		if _, err := session.SendText(context.Background(), question, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.City != "Beijing" {
+		t.Errorf("got %+v", result)
+	}
+	req := stub.Requests()[1]
+	messages, _ := req["messages"].([]any)
+	if len(messages) != 3 {
+		t.Fatalf("got messages %v", messages)
+	}
+	if bs, _ := json.Marshal(messages[1]); !strings.Contains(string(bs), `\"city\":\"Shanghai\"`) || !strings.Contains(string(bs), `"assistant"`) {
+		t.Errorf("got replayed reply %s", bs)
+	}
+	if system, _ := req["system"].(string); !strings.HasPrefix(system, "You are a travel guide.") {
+		t.Errorf("got system %q", system)
+	}
+
+	// the memory of the instructor records the turns itself
+	memory := instructor.NewMemory(0)
+	client = instructors.FromAnthropic(anthropicapi.NewClient("test", anthropicapi.WithBaseURL(url)), instructor.WithMode(instructor.ModeJSON), instructor.WithMemory(memory))
+	if _, err := client.NewSession(&anthropicapi.MessagesRequest{Model: "claude-test", MaxTokens: 100}, memory).SendText(context.Background(), sessionQuestions[0], &result); !errors.Is(err, instructor.ErrSessionMemory) {
+		t.Errorf("got shared memory error %v", err)
+	}
+	if len(stub.Requests()) != 2 {
+		t.Errorf("got %d requests", len(stub.Requests()))
+	}
+}
+
+// geminiText is a response with the text content
+func geminiText(text string) stubResponse {
+	bs, _ := json.Marshal(text)
+	return stubResponse{http.StatusOK, fmt.Sprintf(`{"candidates": [{"content": {"role": "model", "parts": [{"text": %s}]}}], "usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "totalTokenCount": 15}}`, bs)}
+}
+
+func TestGeminiSession(t *testing.T) {
+	stub, url := newAPIStub(t, geminiText(`{"city": "Shanghai"}`), geminiText(`{"city": "Beijing"}`))
+	clt, err := genai.NewClient(context.Background(), &genai.ClientConfig{APIKey: "test", Backend: genai.BackendGeminiAPI, HTTPOptions: genai.HTTPOptions{BaseURL: url}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := instructors.FromGemini(clt, instructor.WithMode(instructor.ModeJSON))
+	session := client.NewSession(&gemini.Request{Model: "gemini-test"}, nil)
+	session.Memory().Add(instructor.Message{Role: instructor.SystemRole, Text: "You are a travel guide."})
+	var result sessionCity
+	for _, question := range sessionQuestions {
+		if _, err := session.SendText(context.Background(), question, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.City != "Beijing" {
+		t.Errorf("got %+v", result)
+	}
+	req := stub.Requests()[1]
+	contents, _ := req["contents"].([]any)
+	if len(contents) != 3 {
+		t.Fatalf("got contents %v", contents)
+	}
+	if bs, _ := json.Marshal(contents[1]); !strings.Contains(string(bs), `\"city\":\"Shanghai\"`) || !strings.Contains(string(bs), `"model"`) {
+		t.Errorf("got replayed reply %s", bs)
+	}
+	if bs, _ := json.Marshal(contents[2]); !strings.Contains(string(bs), sessionQuestions[1]) {
+		t.Errorf("got new turn %s", bs)
+	}
+	if bs, _ := json.Marshal(req["systemInstruction"]); !strings.Contains(string(bs), "You are a travel guide.") {
+		t.Errorf("got system instruction %s", bs)
+	}
+}
+
+// cohereText is a chat response with the text
+func cohereText(text string) stubResponse {
+	bs, _ := json.Marshal(text)
+	return stubResponse{http.StatusOK, fmt.Sprintf(`{"text": %s, "meta": {"tokens": {"input_tokens": 10, "output_tokens": 5}}}`, bs)}
+}
+
+func TestCohereSession(t *testing.T) {
+	stub, url := newAPIStub(t, cohereText(`{"city": "Shanghai"}`), cohereText(`{"city": "Beijing"}`))
+	client := instructors.FromCohere(cohereClient.NewClient(option.WithBaseURL(url), option.WithToken("test")), instructor.WithMode(instructor.ModeJSON))
+	preamble := "You are a travel guide."
+	session := client.NewSession(&cohere.ChatRequest{Preamble: &preamble}, nil)
+	var result sessionCity
+	for _, question := range sessionQuestions {
+		if _, err := session.SendText(context.Background(), question, &result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result.City != "Beijing" {
+		t.Errorf("got %+v", result)
+	}
+	req := stub.Requests()[1]
+	history, _ := req["chat_history"].([]any)
+	if len(history) != 2 || req["message"] != sessionQuestions[1] {
+		t.Fatalf("got history %v, message %v", history, req["message"])
+	}
+	if bs, _ := json.Marshal(history[1]); !strings.Contains(string(bs), `\"city\":\"Shanghai\"`) || !strings.Contains(string(bs), `"CHATBOT"`) {
+		t.Errorf("got replayed reply %s", bs)
+	}
+
+	// the new turn is sent as the message, which must be from the user
+	if _, err := session.Send(context.Background(), instructor.Message{Role: instructor.AssistantRole, Text: "Shanghai"}, &result); err == nil {
+		t.Error("expected error on an assistant turn")
+	}
+	if len(stub.Requests()) != 2 || len(session.Memory().List()) != 4 {
+		t.Errorf("got %d requests, memory %+v", len(stub.Requests()), session.Memory().List())
+	}
+}
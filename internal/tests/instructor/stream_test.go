@@ -0,0 +1,136 @@
+package instructor_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/bububa/instructor-go"
+)
+
+func toolCallStream(args any) instructor.StreamData {
+	req := new(mcp.CallToolRequest)
+	req.Params.Name = "instructor-go-func"
+	req.Params.Arguments = args
+	return instructor.StreamData{Type: instructor.ToolCallStream, ToolCall: &instructor.ToolCall{Request: req}}
+}
+
+func TestSchemaStreamToolCallValidation(t *testing.T) {
+	clt := newMockInstructor(nil, instructor.WithMode(instructor.ModeToolCall), instructor.WithValidation())
+	clt.streams = [][]instructor.StreamData{
+		{
+			toolCallStream(`{"items": [{"name": "apple", "price": 3}, {"price": 5}, {"name": "pear", "price": 7}]}`),
+		},
+	}
+	itemCh, dataCh, err := clt.SchemaStream(context.Background(), &mockRequest{Text: "extract"}, Item{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg      sync.WaitGroup
+		invalid []instructor.StreamData
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for v := range dataCh {
+			if v.Type == instructor.ValidationErrorStream {
+				invalid = append(invalid, v)
+			}
+		}
+	}()
+	var items []*Item
+	for v := range itemCh {
+		items = append(items, v.(*Item))
+	}
+	wg.Wait()
+	if len(items) != 2 || items[0].Name != "apple" || items[1].Name != "pear" {
+		t.Fatalf("got %+v", items)
+	}
+	if items[0] == items[1] {
+		t.Error("items share the same instance")
+	}
+	if len(invalid) != 1 || invalid[0].Err == nil || string(invalid[0].Raw) != `{"price": 5}` {
+		t.Errorf("got invalid items %+v", invalid)
+	}
+}
+
+func TestSchemaStreamEvents(t *testing.T) {
+	clt := newMockInstructor(nil, instructor.WithMode(instructor.ModeJSON))
+	clt.streams = [][]instructor.StreamData{
+		{
+			{Type: instructor.ThinkingStream, Content: "let me see"},
+			{Type: instructor.ContentStream, Content: `{"items": [{"name": "apple", "price": 3},`},
+			{Type: instructor.ContentStream, Content: ` {"name": "pear", "price": 5}]}`},
+			{Type: instructor.DoneStream, Meta: &instructor.ResponseMeta{
+				ID:           "resp-1",
+				FinishReason: "stop",
+				Usage:        instructor.UsageSum{InputTokens: 7, OutputTokens: 11, TotalTokens: 18},
+			}},
+		},
+	}
+	var (
+		items    []string
+		content  string
+		thinking string
+		usage    instructor.UsageSum
+		done     *instructor.Done
+	)
+	for ev, err := range instructor.SchemaStreamEvents[Item](context.Background(), clt, &mockRequest{Text: "extract"}, nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch v := ev.(type) {
+		case instructor.Item[Item]:
+			items = append(items, v.Value.Name)
+		case instructor.ContentDelta:
+			content += v.Text
+		case instructor.ThinkingDelta:
+			thinking += v.Text
+		case instructor.Usage:
+			usage = v.UsageSum
+		case instructor.Done:
+			done = &v
+		}
+	}
+	if len(items) != 2 || items[0] != "apple" || items[1] != "pear" {
+		t.Errorf("got items %v", items)
+	}
+	if thinking != "let me see" || content == "" || done == nil {
+		t.Fatalf("got thinking %q, content %q, done %v", thinking, content, done)
+	}
+	if done.ID != "resp-1" || done.FinishReason != "stop" || usage.TotalTokens != 18 {
+		t.Errorf("got done %+v, usage %+v", done, usage)
+	}
+}
+
+func TestSchemaStreamEventsBreak(t *testing.T) {
+	clt := newMockInstructor(nil, instructor.WithMode(instructor.ModeToolCall))
+	stream := make([]instructor.StreamData, 0, 100)
+	for range 100 {
+		stream = append(stream, toolCallStream(`{"items": [{"name": "apple", "price": 3}]}`))
+	}
+	clt.streams = [][]instructor.StreamData{stream}
+	before := runtime.NumGoroutine()
+	var count int
+	for ev := range instructor.SchemaStreamEvents[Item](context.Background(), clt, &mockRequest{Text: "extract"}, nil) {
+		if _, ok := ev.(instructor.Item[Item]); ok {
+			count++
+			break
+		}
+	}
+	if count != 1 {
+		t.Fatalf("got %d items", count)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, n)
+	}
+}
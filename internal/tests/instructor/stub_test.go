@@ -0,0 +1,86 @@
+package instructor_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// apiStub replays the queued responses of a provider API and records the request bodies,
+// the responses starting with data: are sent as server sent events
+type apiStub struct {
+	mu        sync.Mutex
+	requests  []map[string]any
+	responses []stubResponse
+}
+
+type stubResponse struct {
+	status int
+	body   string
+}
+
+// newAPIStub starts the stub server, it returns the URL of the server
+func newAPIStub(t *testing.T, responses ...stubResponse) (*apiStub, string) {
+	stub := &apiStub{responses: responses}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		stub.requests = append(stub.requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		if len(stub.responses) == 0 {
+			http.Error(w, `{"error": "no more responses"}`, http.StatusInternalServerError)
+			return
+		}
+		resp := stub.responses[0]
+		stub.responses = stub.responses[1:]
+		if strings.HasPrefix(resp.body, "data:") {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(api.Close)
+	return stub, api.URL
+}
+
+func (s *apiStub) Requests() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// anthropicToolUse is a message calling the tool with the input
+func anthropicToolUse(name string, input string, inputTokens int) stubResponse {
+	return stubResponse{http.StatusOK, fmt.Sprintf(`{"id": "msg_1", "type": "message", "role": "assistant", "stop_reason": "tool_use", "content": [{"type": "tool_use", "id": "toolu_1", "name": %q, "input": %s}], "usage": {"input_tokens": %d, "output_tokens": 5}}`, name, input, inputTokens)}
+}
+
+// anthropicText is a message with the text content
+func anthropicText(text string) stubResponse {
+	bs, _ := json.Marshal(text)
+	return stubResponse{http.StatusOK, fmt.Sprintf(`{"id": "msg_1", "type": "message", "role": "assistant", "stop_reason": "end_turn", "content": [{"type": "text", "text": %s}], "usage": {"input_tokens": 10, "output_tokens": 5}}`, bs)}
+}
+
+// sseEvents renders the events as a stream of server sent events
+func sseEvents(events ...string) stubResponse {
+	var sb strings.Builder
+	for _, v := range events {
+		fmt.Fprintf(&sb, "data: %s\n\n", v)
+	}
+	return stubResponse{http.StatusOK, sb.String()}
+}
+
+// openAIToolCallStream streams a completion calling the tool
+func openAIToolCallStream(name string, args string) stubResponse {
+	bs, _ := json.Marshal(args)
+	return sseEvents(
+		fmt.Sprintf(`{"id": "chatcmpl-1", "object": "chat.completion.chunk", "model": "gpt-test", "choices": [{"index": 0, "delta": {"role": "assistant", "tool_calls": [{"index": 0, "id": "call_1", "type": "function", "function": {"name": %q, "arguments": %s}}]}}]}`, name, bs),
+		`{"id": "chatcmpl-1", "object": "chat.completion.chunk", "model": "gpt-test", "choices": [{"index": 0, "delta": {}, "finish_reason": "tool_calls"}]}`,
+		"[DONE]",
+	)
+}
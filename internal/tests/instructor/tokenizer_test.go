@@ -0,0 +1,107 @@
+package instructor_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+
+	"github.com/bububa/instructor-go"
+	"github.com/bububa/instructor-go/instructors"
+)
+
+func TestTokenizer(t *testing.T) {
+	var encoding strings.Builder
+	for rank, token := range []string{"h", "e", "l", "o", " ", "w", "r", "d", "!", "ll", "he", "hell", "hello", " w", "or"} {
+		fmt.Fprintf(&encoding, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	tok, err := instructor.LoadBPETokenizer(strings.NewReader(encoding.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tok.Encode("hello world!"); !slices.Equal(got, []int{12, 13, 14, 2, 7, 8}) {
+		t.Errorf("got tokens %v", got)
+	}
+
+	pieces := instructor.NewBPETokenizer(map[string]int{"I": 1, "'m": 2, " ": 3, " fine": 4, "\n\n": 5, "123": 6, "456": 7})
+	if got := pieces.Encode("I'm  fine\n\n123456"); !slices.Equal(got, []int{1, 2, 3, 4, 5, 6, 7}) {
+		t.Errorf("got pieces %v", got)
+	}
+
+	if got := instructor.HeuristicTokens("hello world, 你好"); got != 7 {
+		t.Errorf("got %d heuristic tokens", got)
+	}
+	for model, want := range map[string]int{
+		"gpt-4o-2024-08-06":          128000,
+		"gpt-4-0613":                 8192,
+		"gpt-4-1106-preview":         128000,
+		"claude-3-5-sonnet-20241022": 200000,
+		"models/gemini-1.5-pro":      2097152,
+	} {
+		if got, ok := instructor.ContextWindow(model); !ok || got != want {
+			t.Errorf("%s: got context window %d", model, got)
+		}
+	}
+	if _, ok := instructor.ContextWindow("unknown"); ok {
+		t.Error("expected unknown context window")
+	}
+
+	ctx := context.Background()
+	stub, clt := newOpenAIStub(t)
+	instructor.RegisterContextWindow("gpt-preflight", 100)
+	client := instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON), instructor.WithContextPreflight())
+	var result struct {
+		Name string `json:"name"`
+	}
+	err = client.Chat(ctx, &openai.ChatCompletionNewParams{
+		Model:               "gpt-preflight",
+		MaxCompletionTokens: openai.Int(50),
+		Messages:            []openai.ChatCompletionMessageParamUnion{openai.UserMessage(strings.Repeat("word ", 60))},
+	}, &result, nil)
+	var tooLarge *instructor.ContextTooLargeError
+	// the prompt alone is 64 tokens, the injected output schema is counted on top of it
+	if !errors.Is(err, instructor.ErrContextTooLarge) || !errors.As(err, &tooLarge) || tooLarge.Tokens <= 64 || tooLarge.Reserved != 50 || tooLarge.Limit != 100 {
+		t.Fatalf("got error %v", err)
+	}
+	if len(stub.requests) != 0 {
+		t.Errorf("got %d requests sent", len(stub.requests))
+	}
+
+	// a tool result that overflows the window is caught before the follow-up request
+	lookup, err := instructor.NewLocalTool("lookup", "look up a place", func(ctx context.Context, args struct {
+		Place string `json:"place"`
+	}) (string, error) {
+		return strings.Repeat("word ", 2000), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instructor.RegisterContextWindow("gpt-preflight-tools", 1000)
+	stub.reset(openAICompletion("", "lookup", `{"place": "the Bund"}`))
+	client = instructors.FromOpenAI(clt, instructor.WithMode(instructor.ModeJSON), instructor.WithContextPreflight(), instructor.WithLocalTools(lookup))
+	err = client.Chat(ctx, &openai.ChatCompletionNewParams{
+		Model:               "gpt-preflight-tools",
+		MaxCompletionTokens: openai.Int(50),
+		Messages:            []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Where is the Bund?")},
+	}, &result, nil)
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 1000 {
+		t.Fatalf("got error %v", err)
+	}
+	if len(stub.requests) != 1 {
+		t.Errorf("got %d requests sent", len(stub.requests))
+	}
+
+	list := []instructor.Message{{Text: strings.Repeat("a", 400)}, {Text: "short"}, {Text: "last"}}
+	trimmed, err := instructor.WindowByTokens(20, instructor.MessageCounter(instructor.DefaultTokenizer)).Compact(ctx, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trimmed) != 2 {
+		t.Errorf("got %d messages", len(trimmed))
+	}
+}
@@ -0,0 +1,397 @@
+package instructor_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/bububa/instructor-go"
+)
+
+func newMCPTestClient(t *testing.T, srv *server.MCPServer) *client.Client {
+	t.Helper()
+	clt, err := client.NewInProcessClient(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clt.Close() })
+	ctx := context.Background()
+	if err := clt.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	req := mcp.InitializeRequest{}
+	req.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	req.Params.ClientInfo = mcp.Implementation{Name: "instructor-go-test", Version: "1.0.0"}
+	if _, err := clt.Initialize(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	return clt
+}
+
+func TestCallTools(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	echo := mcp.NewTool("echo", mcp.WithString("text"))
+	srv.AddTool(echo, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		text := req.GetString("text", "")
+		if text == "slow" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return mcp.NewToolResultText(text), nil
+	})
+	tool := instructor.MCPTool{Client: newMCPTestClient(t, srv), ServerName: "test", Tool: &echo}
+
+	var steps []instructor.ToolStep
+	var o instructor.Options
+	for _, opt := range []instructor.Option{
+		instructor.WithMCPTools(tool),
+		instructor.WithToolTimeout(50 * time.Millisecond),
+		instructor.WithToolStepHandler(func(ctx context.Context, step *instructor.ToolStep) {
+			steps = append(steps, *step)
+		}),
+	} {
+		opt(&o)
+	}
+	calls := []instructor.ToolCall{
+		instructor.NewToolCall("test_echo", `{"text": "a"}`),
+		instructor.NewToolCall("test_echo", `{"text": "slow"}`),
+		instructor.NewToolCall("test_echo", map[string]any{"text": "b"}),
+		instructor.NewToolCall("test_unknown", `{}`),
+		instructor.NewToolCall("test_echo", `{"text":`),
+	}
+	o.CallTools(context.Background(), 1, calls)
+
+	for idx, want := range map[int]string{0: "a", 2: "b"} {
+		if got := calls[idx].Result.Content[0].(mcp.TextContent).Text; got != want {
+			t.Errorf("call %d got %q, want %q", idx, got, want)
+		}
+	}
+	for idx, want := range map[int]string{1: "tool call error", 3: "invalid tool name", 4: "error parsing tool arguments"} {
+		if !calls[idx].Result.IsError || !strings.Contains(calls[idx].ToolResultContent(), want) {
+			t.Errorf("call %d got %s, want %q", idx, calls[idx].ToolResultContent(), want)
+		}
+	}
+	if calls[0].Request.Params.Name != "echo" {
+		t.Errorf("request name got %q, want echo", calls[0].Request.Params.Name)
+	}
+	if len(steps) != 1 || steps[0].Iteration != 1 || len(steps[0].Calls) != len(calls) {
+		t.Errorf("got steps %+v", steps)
+	}
+	if o.MaxToolIterations() != instructor.DefaultMaxToolIterations {
+		t.Errorf("max tool iterations got %d", o.MaxToolIterations())
+	}
+}
+
+// notifyClient captures the notification handler so the test can send tools/list_changed
+type notifyClient struct {
+	*client.Client
+	mu      sync.Mutex
+	handler func(mcp.JSONRPCNotification)
+	listErr error
+	lists   int
+}
+
+func (c *notifyClient) ListTools(ctx context.Context, req mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	c.mu.Lock()
+	c.lists++
+	err := c.listErr
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return c.Client.ListTools(ctx, req)
+}
+
+func (c *notifyClient) listCalls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lists
+}
+
+func (c *notifyClient) failList(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listErr = err
+}
+
+func (c *notifyClient) OnNotification(handler func(mcp.JSONRPCNotification)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handler = handler
+}
+
+func (c *notifyClient) notify(method string) {
+	c.mu.Lock()
+	handler := c.handler
+	c.mu.Unlock()
+	handler(mcp.JSONRPCNotification{Notification: mcp.Notification{Method: method}})
+}
+
+func TestMCPRegistry(t *testing.T) {
+	newServer := func(tools ...string) *server.MCPServer {
+		srv := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+		for _, name := range tools {
+			srv.AddTool(mcp.NewTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText(name), nil
+			})
+		}
+		return srv
+	}
+	names := func(tools []instructor.MCPTool) []string {
+		ret := make([]string, 0, len(tools))
+		for _, v := range tools {
+			ret = append(ret, v.Name())
+		}
+		slices.Sort(ret)
+		return ret
+	}
+	ctx := context.Background()
+
+	weatherSrv := newServer("daily_forecast", "delete_city")
+	weather := &notifyClient{Client: newMCPTestClient(t, weatherSrv)}
+	r := instructor.NewMCPRegistry(instructor.WithMCPDenyTools("*/delete_*"), instructor.WithMCPCollision(instructor.MCPCollisionRename))
+	if err := r.Register(ctx, "weather", weather); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(ctx, "weather_daily", newMCPTestClient(t, newServer("forecast", "summary"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(r.Tools()); !slices.Equal(got, []string{"weather_daily_forecast", "weather_daily_forecast_2", "weather_daily_summary"}) {
+		t.Errorf("got tools %v", got)
+	}
+
+	weatherSrv.AddTool(mcp.NewTool("alerts"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("none"), nil
+	})
+	weather.notify(mcp.MethodNotificationToolsListChanged)
+	deadline := time.Now().Add(time.Second)
+	for len(r.Tools()) != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := names(r.Tools()); !slices.Contains(got, "weather_alerts") {
+		t.Errorf("tools not refreshed, got %v", got)
+	}
+
+	var o instructor.Options
+	instructor.WithMCPRegistry(r)(&o)
+	calls := []instructor.ToolCall{instructor.NewToolCall("weather_daily_forecast_2", `{}`)}
+	o.CallTools(ctx, 1, calls)
+	if text := calls[0].Result.Content[0].(mcp.TextContent).Text; text != "forecast" {
+		t.Errorf("renamed tool called %q", text)
+	}
+	if calls[0].Request.Params.Name != "forecast" {
+		t.Errorf("renamed tool request name got %q", calls[0].Request.Params.Name)
+	}
+
+	// the alias skips the name of a later tool
+	renamed := instructor.NewMCPRegistry(instructor.WithMCPCollision(instructor.MCPCollisionRename))
+	for _, v := range []struct{ server, tool string }{{"w", "daily_forecast"}, {"w_daily", "forecast"}, {"w_daily_forecast", "2"}} {
+		if err := renamed.Register(ctx, v.server, newMCPTestClient(t, newServer(v.tool))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := names(renamed.Tools()); !slices.Equal(got, []string{"w_daily_forecast", "w_daily_forecast_2", "w_daily_forecast_3"}) {
+		t.Errorf("got tools %v", got)
+	}
+
+	strict := instructor.NewMCPRegistry()
+	if err := strict.Register(ctx, "weather", newMCPTestClient(t, newServer("daily_forecast"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := strict.Register(ctx, "weather_daily", newMCPTestClient(t, newServer("forecast"))); err == nil {
+		t.Error("expected a name collision error")
+	}
+	if got := names(strict.Tools()); !slices.Equal(got, []string{"weather_daily_forecast"}) {
+		t.Errorf("got tools %v", got)
+	}
+}
+
+func TestMCPRegistryPagination(t *testing.T) {
+	srv := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true), server.WithPaginationLimit(2))
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		srv.AddTool(mcp.NewTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(name), nil
+		})
+	}
+	r := instructor.NewMCPRegistry()
+	if err := r.Register(context.Background(), "test", newMCPTestClient(t, srv)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(r.Tools()); got != 5 {
+		t.Errorf("got %d tools, want 5", got)
+	}
+}
+
+func TestMCPRegistryRefreshError(t *testing.T) {
+	ctx := context.Background()
+	srv := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	srv.AddTool(mcp.NewTool("forecast"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("sunny"), nil
+	})
+	weather := &notifyClient{Client: newMCPTestClient(t, srv)}
+	errs := make(chan error, 1)
+	r := instructor.NewMCPRegistry(instructor.WithMCPRefreshErrorHandler(func(serverName string, err error) {
+		if serverName != "weather" {
+			t.Errorf("got refresh error of server %s", serverName)
+		}
+		errs <- err
+	}))
+	if err := r.Register(ctx, "weather", weather); err != nil {
+		t.Fatal(err)
+	}
+	listErr := errors.New("connection lost")
+	weather.failList(listErr)
+	weather.notify(mcp.MethodNotificationToolsListChanged)
+	select {
+	case err := <-errs:
+		if !errors.Is(err, listErr) {
+			t.Errorf("got refresh error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("refresh error not reported")
+	}
+	if len(r.Tools()) != 1 {
+		t.Errorf("cached tools not kept, got %d tools", len(r.Tools()))
+	}
+
+	// the handler of an unregistered server doesn't refresh anymore
+	weather.failList(nil)
+	r.Unregister("weather")
+	lists := weather.listCalls()
+	weather.notify(mcp.MethodNotificationToolsListChanged)
+	time.Sleep(50 * time.Millisecond)
+	if weather.listCalls() != lists || len(r.Tools()) != 0 {
+		t.Errorf("unregistered server refreshed, got %d tools", len(r.Tools()))
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("got refresh error %v", err)
+	default:
+	}
+}
+
+func TestLocalTool(t *testing.T) {
+	type Args struct {
+		City string `json:"city" jsonschema:"description=name of the city"`
+		Days int    `json:"days,omitempty"`
+	}
+	type Forecast struct {
+		City string `json:"city"`
+		Days int    `json:"days"`
+	}
+	tool, err := instructor.NewLocalTool("forecast", "weather forecast", func(ctx context.Context, args Args) (Forecast, error) {
+		if args.City == "" {
+			return Forecast{}, errors.New("city is required")
+		}
+		return Forecast{City: args.City, Days: args.Days}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := tool.Definition()
+	if def.InputSchema.Type != "object" || !slices.Equal(def.InputSchema.Required, []string{"city"}) {
+		t.Errorf("got input schema %+v", def.InputSchema)
+	}
+	if _, ok := def.InputSchema.Properties["city"]; !ok {
+		t.Errorf("missing property city: %+v", def.InputSchema.Properties)
+	}
+
+	var o instructor.Options
+	instructor.WithLocalTools(tool)(&o)
+	calls := []instructor.ToolCall{
+		instructor.NewToolCall("forecast", `{"city": "Paris", "days": 3}`),
+		instructor.NewToolCall("forecast", `{}`),
+	}
+	o.CallTools(context.Background(), 1, calls)
+	if got := calls[0].Result.Content[0].(mcp.TextContent).Text; got != `{"city":"Paris","days":3}` {
+		t.Errorf("got %s", got)
+	}
+	if !calls[1].Result.IsError || !strings.Contains(calls[1].ToolResultContent(), "city is required") {
+		t.Errorf("got %s", calls[1].ToolResultContent())
+	}
+
+	if _, err := instructor.NewLocalTool("bad", "", func(ctx context.Context, args string) (string, error) { return args, nil }); err == nil {
+		t.Error("expected error for non struct arguments")
+	}
+}
+
+func TestToolApprover(t *testing.T) {
+	type Args struct {
+		Path string `json:"path"`
+	}
+	remove, err := instructor.NewLocalTool("remove", "remove the file", func(ctx context.Context, args Args) (string, error) {
+		return "removed " + args.Path, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o instructor.Options
+	for _, opt := range []instructor.Option{
+		instructor.WithLocalTools(remove),
+		instructor.WithToolApprover(func(ctx context.Context, call *instructor.ToolCall) (instructor.ToolApproval, error) {
+			switch call.Request.GetString("path", "") {
+			case "/":
+				return instructor.DenyTool("removing / is not allowed"), nil
+			case "~":
+				return instructor.ModifyTool(`{"path": "/tmp"}`), nil
+			case "?":
+				return instructor.ToolApproval{}, errors.New("no answer")
+			}
+			return instructor.ApproveTool(), nil
+		}),
+	} {
+		opt(&o)
+	}
+	calls := []instructor.ToolCall{
+		instructor.NewToolCall("remove", `{"path": "/home"}`),
+		instructor.NewToolCall("remove", `{"path": "/"}`),
+		instructor.NewToolCall("remove", `{"path": "~"}`),
+		instructor.NewToolCall("remove", `{"path": "?"}`),
+	}
+	o.CallTools(context.Background(), 1, calls)
+	for idx, want := range []string{"removed /home", "removing / is not allowed", "removed /tmp", "tool approval error"} {
+		if got := calls[idx].ToolResultContent(); !strings.Contains(got, want) {
+			t.Errorf("call %d got %s, want %q", idx, got, want)
+		}
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		var o instructor.Options
+		instructor.WithLocalTools(remove)(&o)
+		instructor.WithStreamToolApproval()(&o)
+		ch := make(chan instructor.StreamData)
+		calls := []instructor.ToolCall{
+			instructor.NewToolCall("remove", `{"path": "/home"}`),
+			instructor.NewToolCall("remove", `{"path": "/"}`),
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			o.CallTools(o.StreamApprovalContext(context.Background(), ch), 1, calls)
+		}()
+		for range calls {
+			data := <-ch
+			pending, ok := data.Event().(*instructor.PendingApproval)
+			if !ok || data.Type != instructor.ToolApprovalStream {
+				t.Fatalf("got %+v", data)
+			}
+			if pending.ToolCall.Request.GetString("path", "") == "/" {
+				pending.Resolve(instructor.DenyTool(""))
+			} else {
+				pending.Resolve(instructor.ApproveTool())
+			}
+		}
+		<-done
+		if calls[0].Result.IsError || !calls[1].Result.IsError || !strings.Contains(calls[1].ToolResultContent(), "tool call denied") {
+			t.Errorf("got results %s, %s", calls[0].ToolResultContent(), calls[1].ToolResultContent())
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/bububa/instructor-go"
+)
+
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := instructor.NewSQLStore(ctx, openSQLite(t, filepath.Join(t.TempDir(), "memory.db")), "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory, err := instructor.LoadMemory(ctx, store, "user/1", instructor.WindowByCount(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			memory.Add(instructor.Message{Role: instructor.UserRole, Text: fmt.Sprintf("message %d", i)})
+		}()
+	}
+	wg.Wait()
+	if err := memory.Err(); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := instructor.LoadMemory(ctx, store, "user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.List(); len(got) != 10 {
+		t.Fatalf("got %d messages", len(got))
+	}
+	if err := memory.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	list, err := store.Load(ctx, "user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 4 || list[3].Text != memory.List()[3].Text {
+		t.Errorf("got compacted messages %+v", list)
+	}
+	if list, _ := store.Load(ctx, "user/2"); len(list) != 0 {
+		t.Errorf("got messages of another conversation %+v", list)
+	}
+}
+
+func TestSQLStoreConcurrentAppend(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "memory.db")
+	// the stores of two processes sharing the conversation
+	var stores []*instructor.SQLStore
+	for range 2 {
+		store, err := instructor.NewSQLStore(ctx, openSQLite(t, path), "messages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+	var wg sync.WaitGroup
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stores[i%2].Append(ctx, "user/1", instructor.Message{Role: instructor.UserRole, Text: fmt.Sprintf("message %d", i)}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	list, err := stores[0].Load(ctx, "user/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, v := range list {
+		seen[v.Text] = true
+	}
+	if len(list) != 40 || len(seen) != 40 {
+		t.Errorf("got messages %+v", list)
+	}
+
+	// the errors other than the primary key conflicts are not retried
+	db := openSQLite(t, path)
+	if _, err := db.ExecContext(ctx, "CREATE TRIGGER reject BEFORE INSERT ON messages BEGIN SELECT RAISE(ABORT, 'rejected'); END"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := stores[0].Append(ctx, "user/1", instructor.Message{Role: instructor.UserRole, Text: "rejected"}); err == nil {
+		t.Error("expected the error of the trigger")
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("the rejected append took %s", elapsed)
+	}
+}
+
+func openSQLite(t *testing.T, path string) *sql.DB {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,77 @@
+package instructor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// LocalTool is a Go function exposed to the model as a tool, it is called in the same tool loop as the MCP tools
+type LocalTool struct {
+	tool *mcp.Tool
+	fn   func(ctx context.Context, args json.RawMessage) (*mcp.CallToolResult, error)
+}
+
+// NewLocalTool creates a tool calling fn, the parameters of the tool are derived from the JSON schema of A.
+// A string result is sent back to the model as is, other results are JSON encoded,
+// the error returned by fn is sent back to the model as a tool error.
+func NewLocalTool[A any, R any](name string, description string, fn func(ctx context.Context, args A) (R, error)) (*LocalTool, error) {
+	schema := *JSONSchema(reflect.TypeFor[A](), true, nil)
+	schema.Ref = ""
+	bs, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	tool := &mcp.Tool{
+		Name:        name,
+		Description: description,
+	}
+	if err := json.Unmarshal(bs, &tool.InputSchema); err != nil {
+		return nil, err
+	}
+	if tool.InputSchema.Type != "object" {
+		return nil, fmt.Errorf("arguments of local tool %s must be a struct", name)
+	}
+	return &LocalTool{
+		tool: tool,
+		fn: func(ctx context.Context, raw json.RawMessage) (*mcp.CallToolResult, error) {
+			var args A
+			if len(raw) > 0 {
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("error parsing tool arguments: %v", err)), nil
+				}
+			}
+			ret, err := fn(ctx, args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if text, ok := any(ret).(string); ok {
+				return mcp.NewToolResultText(text), nil
+			}
+			bs, err := json.Marshal(ret)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewToolResultText(string(bs)), nil
+		},
+	}, nil
+}
+
+func (t *LocalTool) Name() string {
+	return t.tool.Name
+}
+
+func (t *LocalTool) Definition() *mcp.Tool {
+	return t.tool
+}
+
+func (t *LocalTool) Call(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	raw, err := json.Marshal(req.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	return t.fn(ctx, raw)
+}
@@ -0,0 +1,52 @@
+package instructor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// ErrNoResult is returned by Maybe.Unwrap when the model reported that nothing could be extracted
+var ErrNoResult = errors.New("no result found")
+
+// Maybe wraps a response type so the model can report that the requested entity is not present
+// in the content instead of inventing data.
+type Maybe[T any] struct {
+	Result  *T     `json:"result,omitempty" yaml:"result,omitempty" toml:"result,omitempty" jsonschema:"description=Correctly extracted result from the content. Leave it empty if nothing could be extracted"`
+	Error   bool   `json:"error" yaml:"error" toml:"error" jsonschema:"description=Set to true if the result could not be extracted from the content,default=false"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty" toml:"message,omitempty" jsonschema:"description=Short and concise reason why the result could not be extracted"`
+}
+
+// Valid reports whether a result was extracted
+func (m Maybe[T]) Valid() bool {
+	return !m.Error && m.Result != nil
+}
+
+// Unwrap returns the extracted result or ErrNoResult with the model's message
+func (m Maybe[T]) Unwrap() (*T, error) {
+	if m.Valid() {
+		return m.Result, nil
+	}
+	if m.Message == "" {
+		return nil, ErrNoResult
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoResult, m.Message)
+}
+
+// Fake implements Faker, used by the YAML and TOML encoders to render an example instance
+func (m Maybe[T]) Fake() any {
+	ret := Maybe[T]{
+		Result: new(T),
+	}
+	if f, ok := any(*ret.Result).(Faker); ok {
+		if v, ok := f.Fake().(T); ok {
+			*ret.Result = v
+		} else if v, ok := f.Fake().(*T); ok {
+			ret.Result = v
+		}
+	} else {
+		gofakeit.Struct(ret.Result)
+	}
+	return &ret
+}
@@ -0,0 +1,128 @@
+package instructor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mcpClient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MCPResource is a resource of a MCP server read and attached to the requests as context
+type MCPResource struct {
+	Client     mcpClient.MCPClient
+	ServerName string
+	URI        string
+}
+
+// MCPPrompt is a prompt template of a MCP server instantiated into the messages of the requests
+type MCPPrompt struct {
+	Client     mcpClient.MCPClient
+	ServerName string
+	Name       string
+	Arguments  map[string]string
+}
+
+// WithMCPResources attaches the resources to every request, text resources are inlined as user messages
+// and binary resources are attached as images, audios or files
+func WithMCPResources(resources ...MCPResource) Option {
+	return func(o *Options) {
+		o.mcpResources = resources
+	}
+}
+
+// WithMCPPrompts instantiates the prompts into the messages of every request, before the messages of the request
+func WithMCPPrompts(prompts ...MCPPrompt) Option {
+	return func(o *Options) {
+		o.mcpPrompts = prompts
+	}
+}
+
+func (i Options) MCPResources() []MCPResource {
+	return i.mcpResources
+}
+
+func (i Options) MCPPrompts() []MCPPrompt {
+	return i.mcpPrompts
+}
+
+// MCPMessages resolves the MCP prompts and resources into messages, the prompt messages come first
+func (i Options) MCPMessages(ctx context.Context) ([]Message, error) {
+	if len(i.mcpPrompts) == 0 && len(i.mcpResources) == 0 {
+		return nil, nil
+	}
+	var ret []Message
+	for _, v := range i.mcpPrompts {
+		req := mcp.GetPromptRequest{}
+		req.Params.Name = v.Name
+		req.Params.Arguments = v.Arguments
+		result, err := v.Client.GetPrompt(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("get prompt %s of mcp server %s: %w", v.Name, v.ServerName, err)
+		}
+		for _, msg := range result.Messages {
+			var m Message
+			if msg.Role == mcp.RoleAssistant {
+				m.Role = AssistantRole
+			} else {
+				m.Role = UserRole
+			}
+			appendMCPContent(&m, msg.Content)
+			ret = append(ret, m)
+		}
+	}
+	for _, v := range i.mcpResources {
+		req := mcp.ReadResourceRequest{}
+		req.Params.URI = v.URI
+		result, err := v.Client.ReadResource(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("read resource %s of mcp server %s: %w", v.URI, v.ServerName, err)
+		}
+		m := Message{Role: UserRole}
+		for _, content := range result.Contents {
+			appendMCPResource(&m, content)
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+func appendMCPContent(m *Message, content mcp.Content) {
+	switch v := content.(type) {
+	case mcp.TextContent:
+		appendText(m, v.Text)
+	case mcp.ImageContent:
+		m.Images = append(m.Images, Image{URL: fmt.Sprintf("data:%s;base64,%s", v.MIMEType, v.Data)})
+	case mcp.AudioContent:
+		m.Audios = append(m.Audios, Audio{Data: v.Data, Format: strings.TrimPrefix(v.MIMEType, "audio/")})
+	case mcp.EmbeddedResource:
+		appendMCPResource(m, v.Resource)
+	case mcp.ResourceLink:
+		appendText(m, fmt.Sprintf("Resource %s: %s", v.URI, v.Description))
+	}
+}
+
+func appendMCPResource(m *Message, content mcp.ResourceContents) {
+	switch v := content.(type) {
+	case mcp.TextResourceContents:
+		appendText(m, fmt.Sprintf("Resource %s:\n%s", v.URI, v.Text))
+	case mcp.BlobResourceContents:
+		switch {
+		case strings.HasPrefix(v.MIMEType, "image/"):
+			m.Images = append(m.Images, Image{URL: fmt.Sprintf("data:%s;base64,%s", v.MIMEType, v.Blob)})
+		case strings.HasPrefix(v.MIMEType, "audio/"):
+			m.Audios = append(m.Audios, Audio{Data: v.Blob, Format: strings.TrimPrefix(v.MIMEType, "audio/")})
+		default:
+			m.Files = append(m.Files, File{Name: v.URI, Data: v.Blob})
+		}
+	}
+}
+
+func appendText(m *Message, text string) {
+	if m.Text == "" {
+		m.Text = text
+		return
+	}
+	m.Text = fmt.Sprintf("%s\n\n%s", m.Text, text)
+}
@@ -0,0 +1,312 @@
+package instructor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	mcpClient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MCPCollision decides what to do when two MCP tools are exposed to the model with the same name
+type MCPCollision int
+
+const (
+	// MCPCollisionError fails the registration of the server with the colliding tool
+	MCPCollisionError MCPCollision = iota
+	// MCPCollisionSkip keeps the tool registered first
+	MCPCollisionSkip
+	// MCPCollisionRename exposes the later tool with the first numeric suffix not taken by another tool, e.g. server_tool_2
+	MCPCollisionRename
+)
+
+// MCPToolFilter reports whether the tool of the server should be exposed to the model
+type MCPToolFilter func(serverName string, tool *mcp.Tool) bool
+
+type MCPRegistryOption func(r *MCPRegistry)
+
+// WithMCPAllowTools only exposes the tools matching one of the patterns,
+// patterns are matched against `<server>/<tool>` with path.Match, e.g. `github/*`
+func WithMCPAllowTools(patterns ...string) MCPRegistryOption {
+	return func(r *MCPRegistry) {
+		r.allow = append(r.allow, patterns...)
+	}
+}
+
+// WithMCPDenyTools hides the tools matching one of the patterns, deny wins over allow
+func WithMCPDenyTools(patterns ...string) MCPRegistryOption {
+	return func(r *MCPRegistry) {
+		r.deny = append(r.deny, patterns...)
+	}
+}
+
+// WithMCPToolFilter sets a custom filter applied after the allow and deny patterns
+func WithMCPToolFilter(fn MCPToolFilter) MCPRegistryOption {
+	return func(r *MCPRegistry) {
+		r.filter = fn
+	}
+}
+
+// WithMCPCollision sets the name collision policy, MCPCollisionError by default
+func WithMCPCollision(v MCPCollision) MCPRegistryOption {
+	return func(r *MCPRegistry) {
+		r.collision = v
+	}
+}
+
+// WithMCPClientInfo sets the client info sent to the servers on initialization
+func WithMCPClientInfo(v mcp.Implementation) MCPRegistryOption {
+	return func(r *MCPRegistry) {
+		r.clientInfo = v
+	}
+}
+
+// WithMCPRefreshErrorHandler sets the handler of the errors of the refreshes triggered by the
+// `notifications/tools/list_changed` notifications, the errors are logged by default
+func WithMCPRefreshErrorHandler(fn func(serverName string, err error)) MCPRegistryOption {
+	return func(r *MCPRegistry) {
+		r.onRefreshError = fn
+	}
+}
+
+type mcpServer struct {
+	name   string
+	client mcpClient.MCPClient
+	tools  []mcp.Tool
+	// active is shared by the refreshed copies of the server and cleared once it is unregistered,
+	// the notification handler can't be removed from the client so it checks it instead
+	active *atomic.Bool
+}
+
+// MCPRegistry discovers the tools of MCP servers and keeps them up to date
+// with the `notifications/tools/list_changed` notifications of the servers
+type MCPRegistry struct {
+	mu         sync.RWMutex
+	servers    []*mcpServer
+	tools      []MCPTool
+	allow      []string
+	deny       []string
+	filter     MCPToolFilter
+	collision  MCPCollision
+	clientInfo mcp.Implementation
+
+	onRefreshError func(serverName string, err error)
+}
+
+func NewMCPRegistry(opts ...MCPRegistryOption) *MCPRegistry {
+	r := &MCPRegistry{
+		clientInfo: mcp.Implementation{
+			Name:    "instructor-go",
+			Version: "1.0.0",
+		},
+		onRefreshError: func(serverName string, err error) {
+			log.Printf("refresh mcp server %s: %v\n", serverName, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register initializes the client and lists the tools of the server.
+// Clients which need to be started, e.g. in-process or streamable HTTP clients, must be started before.
+func (r *MCPRegistry) Register(ctx context.Context, serverName string, clt mcpClient.MCPClient) error {
+	r.mu.RLock()
+	exists := slices.ContainsFunc(r.servers, func(v *mcpServer) bool { return v.name == serverName })
+	r.mu.RUnlock()
+	if exists {
+		return fmt.Errorf("mcp server %s already registered", serverName)
+	}
+	if v, ok := clt.(interface{ IsInitialized() bool }); !ok || !v.IsInitialized() {
+		req := mcp.InitializeRequest{}
+		req.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+		req.Params.ClientInfo = r.clientInfo
+		if _, err := clt.Initialize(ctx, req); err != nil {
+			return fmt.Errorf("initialize mcp server %s: %w", serverName, err)
+		}
+	}
+	tools, err := listMCPTools(ctx, clt)
+	if err != nil {
+		return fmt.Errorf("list tools of mcp server %s: %w", serverName, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if slices.ContainsFunc(r.servers, func(v *mcpServer) bool { return v.name == serverName }) {
+		return fmt.Errorf("mcp server %s already registered", serverName)
+	}
+	active := new(atomic.Bool)
+	active.Store(true)
+	servers := append(slices.Clone(r.servers), &mcpServer{name: serverName, client: clt, tools: tools, active: active})
+	if err := r.rebuild(servers); err != nil {
+		return err
+	}
+	clt.OnNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method != mcp.MethodNotificationToolsListChanged || !active.Load() {
+			return
+		}
+		go func() {
+			if err := r.Refresh(context.Background(), serverName); err != nil && active.Load() && r.onRefreshError != nil {
+				r.onRefreshError(serverName, err)
+			}
+		}()
+	})
+	return nil
+}
+
+// Unregister removes the tools of the server and stops following its notifications, the client is not closed
+func (r *MCPRegistry) Unregister(serverName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	servers := slices.DeleteFunc(slices.Clone(r.servers), func(v *mcpServer) bool {
+		if v.name != serverName {
+			return false
+		}
+		v.active.Store(false)
+		return true
+	})
+	// removing tools never introduces a collision
+	r.rebuild(servers)
+}
+
+// Refresh lists the tools of the server again, the cached tools are kept if it fails
+func (r *MCPRegistry) Refresh(ctx context.Context, serverName string) error {
+	r.mu.RLock()
+	idx := slices.IndexFunc(r.servers, func(v *mcpServer) bool { return v.name == serverName })
+	var server *mcpServer
+	if idx >= 0 {
+		server = r.servers[idx]
+	}
+	r.mu.RUnlock()
+	if server == nil {
+		return fmt.Errorf("mcp server %s not registered", serverName)
+	}
+	tools, err := listMCPTools(ctx, server.client)
+	if err != nil {
+		return fmt.Errorf("list tools of mcp server %s: %w", serverName, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	servers := slices.Clone(r.servers)
+	for idx, v := range servers {
+		// the server may have been unregistered, or registered again, while listing the tools
+		if v.active == server.active {
+			servers[idx] = &mcpServer{name: v.name, client: v.client, tools: tools, active: v.active}
+		}
+	}
+	return r.rebuild(servers)
+}
+
+// Tools returns the cached tools of all the servers in the order of registration
+func (r *MCPRegistry) Tools() []MCPTool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tools
+}
+
+// Close closes the clients of all the servers
+func (r *MCPRegistry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for _, v := range r.servers {
+		v.active.Store(false)
+		if e := v.client.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	r.servers = nil
+	r.tools = nil
+	return err
+}
+
+// rebuild replaces the servers and the tool cache, nothing is changed on a name collision error
+func (r *MCPRegistry) rebuild(servers []*mcpServer) error {
+	var (
+		tools = make([]MCPTool, 0, len(r.tools))
+		names = make(map[string]struct{}, len(r.tools))
+		// reserved are the names of all the tools, which the aliases must not take from the later tools
+		reserved = make(map[string]struct{}, len(r.tools))
+	)
+	for _, s := range servers {
+		for idx := range s.tools {
+			if tool := &s.tools[idx]; r.allowed(s.name, tool) {
+				reserved[MCPTool{ServerName: s.name, Tool: tool}.Name()] = struct{}{}
+			}
+		}
+	}
+	for _, s := range servers {
+		for idx := range s.tools {
+			tool := &s.tools[idx]
+			if !r.allowed(s.name, tool) {
+				continue
+			}
+			v := MCPTool{Client: s.client, ServerName: s.name, Tool: tool}
+			name := v.Name()
+			if _, ok := names[name]; ok {
+				switch r.collision {
+				case MCPCollisionSkip:
+					continue
+				case MCPCollisionRename:
+					for n := 2; ; n++ {
+						alias := fmt.Sprintf("%s_%d", name, n)
+						_, taken := names[alias]
+						if _, ok := reserved[alias]; !ok && !taken {
+							v.Alias = alias
+							break
+						}
+					}
+					name = v.Alias
+				default:
+					return fmt.Errorf("mcp tool name collision: %s of server %s", name, s.name)
+				}
+			}
+			names[name] = struct{}{}
+			tools = append(tools, v)
+		}
+	}
+	r.servers = servers
+	r.tools = tools
+	return nil
+}
+
+func (r *MCPRegistry) allowed(serverName string, tool *mcp.Tool) bool {
+	key := serverName + "/" + tool.GetName()
+	match := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			ok, _ := path.Match(pattern, key)
+			return ok
+		})
+	}
+	if match(r.deny) {
+		return false
+	}
+	if len(r.allow) > 0 && !match(r.allow) {
+		return false
+	}
+	return r.filter == nil || r.filter(serverName, tool)
+}
+
+// listMCPTools lists the tools of all the pages
+func listMCPTools(ctx context.Context, clt mcpClient.MCPClient) ([]mcp.Tool, error) {
+	var (
+		req   mcp.ListToolsRequest
+		tools []mcp.Tool
+	)
+	for {
+		ret, err := clt.ListTools(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, ret.Tools...)
+		if ret.NextCursor == "" {
+			return tools, nil
+		}
+		req.Params.Cursor = ret.NextCursor
+	}
+}
@@ -0,0 +1,109 @@
+// Package mcpserver serves typed extractors as MCP tools to other agents
+package mcpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/bububa/instructor-go"
+)
+
+// Extractor is a typed extraction exposed as a MCP tool
+type Extractor struct {
+	tool    mcp.Tool
+	handler server.ToolHandlerFunc
+}
+
+// NewExtractor creates an extractor named as the tool, the input schema of the tool is generated from I
+// and the arguments are rendered into the prompt with text/template.
+// newRequest builds the provider request from the rendered prompt, the result is the structured T
+// extracted by the instructor, validated if the instructor was created WithValidation.
+// The instructor caches the encoder of the response type, so it must not be shared between extractors,
+// the calls of the same extractor run concurrently.
+func NewExtractor[I any, T any, REQ any, RESP any](
+	name string,
+	description string,
+	prompt string,
+	inst instructor.ChatInstructor[REQ, RESP],
+	newRequest func(prompt string) *REQ,
+) (*Extractor, error) {
+	tpl, err := template.New(name).Parse(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt of extractor %s: %w", name, err)
+	}
+	opts := []mcp.ToolOption{
+		mcp.WithDescription(description),
+		mcp.WithInputSchema[I](),
+	}
+	// structured content must be an object
+	isObject := reflect.TypeFor[T]().Kind() == reflect.Struct
+	if isObject {
+		opts = append(opts, mcp.WithOutputSchema[T]())
+	}
+	handler := func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args I
+		if err := req.BindArguments(&args); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("error parsing tool arguments: %v", err)), nil
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, args); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("render prompt: %v", err)), nil
+		}
+		var ret T
+		if err := inst.Chat(ctx, newRequest(buf.String()), &ret, new(RESP)); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("extraction error: %v", err)), nil
+		}
+		bs, err := json.Marshal(ret)
+		if err != nil {
+			return nil, err
+		}
+		if isObject {
+			return mcp.NewToolResultStructured(ret, string(bs)), nil
+		}
+		return mcp.NewToolResultText(string(bs)), nil
+	}
+	return &Extractor{
+		tool:    mcp.NewTool(name, opts...),
+		handler: handler,
+	}, nil
+}
+
+func (e *Extractor) Tool() mcp.Tool {
+	return e.tool
+}
+
+// Server is a MCP server exposing the extractors as tools
+type Server struct {
+	*server.MCPServer
+}
+
+func NewServer(name string, version string, extractors []*Extractor, opts ...server.ServerOption) *Server {
+	opts = append([]server.ServerOption{server.WithToolCapabilities(false)}, opts...)
+	srv := server.NewMCPServer(name, version, opts...)
+	for _, v := range extractors {
+		srv.AddTool(v.tool, v.handler)
+	}
+	return &Server{MCPServer: srv}
+}
+
+// ServeStdio serves the extractors over stdin and stdout until the process is terminated
+func (s *Server) ServeStdio(opts ...server.StdioOption) error {
+	return server.ServeStdio(s.MCPServer, opts...)
+}
+
+// StreamableHTTP returns the streamable HTTP handler of the server, which could be mounted to an existing mux
+func (s *Server) StreamableHTTP(opts ...server.StreamableHTTPOption) *server.StreamableHTTPServer {
+	return server.NewStreamableHTTPServer(s.MCPServer, opts...)
+}
+
+// ListenAndServe serves the extractors over streamable HTTP on the address, e.g. `:8080`
+func (s *Server) ListenAndServe(addr string, opts ...server.StreamableHTTPOption) error {
+	return s.StreamableHTTP(opts...).Start(addr)
+}
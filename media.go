@@ -0,0 +1,272 @@
+package instructor
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const (
+	DefaultMediaTimeout  = 30 * time.Second
+	DefaultMediaMaxBytes = 20 << 20
+)
+
+// ErrMediaTooLarge is returned if the media exceeds the max bytes of the loader
+var ErrMediaTooLarge = errors.New("media too large")
+
+// Media is the content of an image, audio, video or file link
+type Media struct {
+	Data     []byte
+	MimeType string
+}
+
+// Base64 encodes the data as standard base64
+func (m *Media) Base64() string {
+	return base64.StdEncoding.EncodeToString(m.Data)
+}
+
+// DataURL encodes the media as a data URL
+func (m *Media) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", m.MimeType, m.Base64())
+}
+
+// MediaLoader loads the media of the links in the messages for the providers which require inline data
+type MediaLoader interface {
+	Load(ctx context.Context, link string) (*Media, error)
+}
+
+type MediaLoaderFunc func(ctx context.Context, link string) (*Media, error)
+
+func (fn MediaLoaderFunc) Load(ctx context.Context, link string) (*Media, error) {
+	return fn(ctx, link)
+}
+
+// DefaultMediaLoader loads the data: and http(s) links with the default timeout and size limit.
+// The file:// links are not loaded by default as the messages could come from untrusted input,
+// route them to a FileMediaLoader with a Root through WithMediaLoader to opt in
+var DefaultMediaLoader MediaLoader = MediaRouter{
+	"data":  MediaLoaderFunc(loadDataURL),
+	"http":  NewHTTPMediaLoader(nil, DefaultMediaTimeout, DefaultMediaMaxBytes),
+	"https": NewHTTPMediaLoader(nil, DefaultMediaTimeout, DefaultMediaMaxBytes),
+}
+
+// MediaRouter routes the links to the loaders by the URL scheme
+type MediaRouter map[string]MediaLoader
+
+func (r MediaRouter) Load(ctx context.Context, link string) (*Media, error) {
+	scheme, _, ok := strings.Cut(link, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid media link %q", link)
+	}
+	loader, ok := r[strings.ToLower(scheme)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported media scheme %q", scheme)
+	}
+	return loader.Load(ctx, link)
+}
+
+// IsMediaURL reports if the link could be fetched by the provider itself
+func IsMediaURL(link string) bool {
+	return strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")
+}
+
+// HTTPMediaLoader fetches the media over HTTP within the timeout, the media larger than MaxBytes is rejected
+type HTTPMediaLoader struct {
+	Client   *http.Client
+	Timeout  time.Duration
+	MaxBytes int64
+}
+
+// NewHTTPMediaLoader creates the loader, http.DefaultClient is used if clt is nil and the size is not limited if maxBytes <= 0
+func NewHTTPMediaLoader(clt *http.Client, timeout time.Duration, maxBytes int64) *HTTPMediaLoader {
+	return &HTTPMediaLoader{
+		Client:   clt,
+		Timeout:  timeout,
+		MaxBytes: maxBytes,
+	}
+}
+
+func (l *HTTPMediaLoader) Load(ctx context.Context, link string) (*Media, error) {
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	clt := l.Client
+	if clt == nil {
+		clt = http.DefaultClient
+	}
+	resp, err := clt.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch media %s: %s", link, resp.Status)
+	}
+	if l.MaxBytes > 0 && resp.ContentLength > l.MaxBytes {
+		return nil, fmt.Errorf("%w: %s has %d bytes", ErrMediaTooLarge, link, resp.ContentLength)
+	}
+	data, err := readLimited(resp.Body, l.MaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("fetch media %s: %w", link, err)
+	}
+	mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return newMedia(data, mimeType), nil
+}
+
+// FileMediaLoader reads the media of the file:// links, the paths are resolved against Root if set.
+// Without Root any file readable by the process could be sent to the provider
+type FileMediaLoader struct {
+	Root     string
+	MaxBytes int64
+}
+
+func (l *FileMediaLoader) Load(_ context.Context, link string) (*Media, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.FromSlash(u.Path)
+	if l.Root != "" {
+		path = filepath.Join(l.Root, filepath.Clean(string(filepath.Separator)+path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := readLimited(f, l.MaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("read media %s: %w", link, err)
+	}
+	return newMedia(data, mime.TypeByExtension(filepath.Ext(path))), nil
+}
+
+// InMemoryMediaLoader serves the media added by the links, e.g. for tests or generated content
+type InMemoryMediaLoader struct {
+	mu    sync.RWMutex
+	items map[string]*Media
+}
+
+func NewInMemoryMediaLoader() *InMemoryMediaLoader {
+	return &InMemoryMediaLoader{
+		items: make(map[string]*Media),
+	}
+}
+
+// Add adds the media of the link, the MIME type is detected if empty
+func (l *InMemoryMediaLoader) Add(link string, data []byte, mimeType string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items[link] = newMedia(data, mimeType)
+}
+
+func (l *InMemoryMediaLoader) Load(_ context.Context, link string) (*Media, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if v, ok := l.items[link]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("media %s not found", link)
+}
+
+// CachedMediaLoader caches the media loaded by the loader, the oldest media are evicted once the cache has more than size items
+type CachedMediaLoader struct {
+	loader MediaLoader
+	size   int
+	mu     sync.Mutex
+	items  map[string]*Media
+	keys   []string
+}
+
+func NewCachedMediaLoader(loader MediaLoader, size int) *CachedMediaLoader {
+	return &CachedMediaLoader{
+		loader: loader,
+		size:   size,
+		items:  make(map[string]*Media, size),
+	}
+}
+
+func (l *CachedMediaLoader) Load(ctx context.Context, link string) (*Media, error) {
+	l.mu.Lock()
+	v, ok := l.items[link]
+	l.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	v, err := l.loader.Load(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.items[link]; !ok {
+		l.items[link] = v
+		l.keys = append(l.keys, link)
+		if l.size > 0 && len(l.keys) > l.size {
+			delete(l.items, l.keys[0])
+			l.keys = l.keys[1:]
+		}
+	}
+	return v, nil
+}
+
+func loadDataURL(_ context.Context, link string) (*Media, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(link, "data:"), ",")
+	if !ok {
+		return nil, errors.New("invalid data url")
+	}
+	mimeType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, err
+		}
+		return newMedia([]byte(data), mimeType), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data url: %w", err)
+	}
+	return newMedia(data, mimeType), nil
+}
+
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrMediaTooLarge, maxBytes)
+	}
+	return data, nil
+}
+
+// newMedia detects the MIME type from the data if it is unknown
+func newMedia(data []byte, mimeType string) *Media {
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = mimetype.Detect(data).String()
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return &Media{Data: data, MimeType: mimeType}
+}
@@ -1,29 +1,167 @@
 package instructor
 
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Memory keeps the messages of a conversation, it is safe for concurrent use.
+// The messages are written through to the store if the memory was loaded with LoadMemory.
 type Memory struct {
-	list []Message
+	mu sync.RWMutex
+	// compactMu serializes the compactions, which run the strategies without holding mu
+	compactMu sync.Mutex
+	// storeMu serializes the writes to the store in the order of the changes, which are written without holding mu
+	storeMu sync.Mutex
+	list    []Message
+	// version changes whenever the messages are replaced
+	version        uint64
+	strategies     []MemoryStrategy
+	store          MemoryStore
+	conversationID string
+	err            error
 }
 
-func NewMemory(cap int) *Memory {
+// NewMemory creates the memory, the strategies are applied in order when the memory is compacted
+func NewMemory(cap int, strategies ...MemoryStrategy) *Memory {
+	m := &Memory{
+		strategies: strategies,
+	}
 	if cap > 0 {
-		return &Memory{
-			list: make([]Message, 0, cap),
-		}
+		m.list = make([]Message, 0, cap)
 	}
-	return new(Memory)
+	return m
 }
 
+// LoadMemory creates the memory of the conversation persisted by the store
+func LoadMemory(ctx context.Context, store MemoryStore, conversationID string, strategies ...MemoryStrategy) (*Memory, error) {
+	list, err := store.Load(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{
+		list:           list,
+		strategies:     strategies,
+		store:          store,
+		conversationID: conversationID,
+	}, nil
+}
+
+// Set replaces the messages, the error of writing them to the store is kept by Err
 func (m *Memory) Set(list []Message) {
-	m.list = make([]Message, len(list))
-	copy(m.list, list)
+	m.setErr(m.SetContext(context.Background(), list))
+}
+
+// SetContext replaces the messages and returns the error of writing them to the store
+func (m *Memory) SetContext(ctx context.Context, list []Message) error {
+	if m == nil {
+		return nil
+	}
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	m.mu.Lock()
+	m.list = slices.Clone(list)
+	m.version++
+	m.mu.Unlock()
+	if m.store == nil {
+		return nil
+	}
+	return m.store.Replace(ctx, m.conversationID, list)
 }
 
+// Add appends the messages, the error of writing them to the store is kept by Err
 func (m *Memory) Add(v ...Message) {
+	m.setErr(m.AddContext(context.Background(), v...))
+}
+
+// AddContext appends the messages and returns the error of writing them to the store
+func (m *Memory) AddContext(ctx context.Context, v ...Message) error {
+	if m == nil || len(v) == 0 {
+		return nil
+	}
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	m.mu.Lock()
 	m.list = append(m.list, v...)
+	m.mu.Unlock()
+	if m.store == nil {
+		return nil
+	}
+	return m.store.Append(ctx, m.conversationID, v...)
 }
 
+// List returns a copy of the messages
 func (m *Memory) List() []Message {
-	return m.list
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.list)
+}
+
+// Err returns the last error of writing the messages to the store
+func (m *Memory) Err() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+func (m *Memory) setErr(err error) {
+	if m == nil || err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Compact applies the strategies and keeps the compacted messages,
+// the messages added while compacting are kept after the compacted ones.
+// The compaction is dropped if the messages are replaced meanwhile.
+func (m *Memory) Compact(ctx context.Context) error {
+	if m == nil || len(m.strategies) == 0 {
+		return nil
+	}
+	m.compactMu.Lock()
+	defer m.compactMu.Unlock()
+	m.mu.RLock()
+	list, version := slices.Clone(m.list), m.version
+	m.mu.RUnlock()
+	n := len(list)
+	for _, s := range m.strategies {
+		var err error
+		if list, err = s.Compact(ctx, list); err != nil {
+			return err
+		}
+	}
+	m.storeMu.Lock()
+	defer m.storeMu.Unlock()
+	m.mu.Lock()
+	if m.version != version {
+		m.mu.Unlock()
+		return nil
+	}
+	m.list = append(list, m.list[n:]...)
+	m.version++
+	list = slices.Clone(m.list)
+	m.mu.Unlock()
+	if m.store == nil {
+		return nil
+	}
+	return m.store.Replace(ctx, m.conversationID, list)
+}
+
+// Messages compacts the memory and returns a copy of the messages
+func (m *Memory) Messages(ctx context.Context) ([]Message, error) {
+	if err := m.Compact(ctx); err != nil {
+		return nil, err
+	}
+	return m.List(), nil
 }
 
 type Role string
@@ -45,6 +183,9 @@ type Message struct {
 	ToolUses    []ToolUse    `json:"tool_uses,omitempty"`
 	ToolResults []ToolResult `json:"tool_result,omitempty"`
 	ResponseID  string       `json:"response_id,omitempty"`
+	// Thinking is the reasoning of the assistant, the signature is required to replay it to the same provider
+	Thinking          string `json:"thinking,omitempty"`
+	ThinkingSignature string `json:"thinking_signature,omitempty"`
 }
 
 type Image struct {
@@ -59,9 +200,10 @@ type Audio struct {
 }
 
 type File struct {
-	ID   string `json:"id,omitempty"`
-	Data string `json:"data,omitempty"`
-	Name string `json:"name,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 type Video struct {
@@ -0,0 +1,80 @@
+package instructor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MemorySchemaVersion is the version of the exported memory format
+const MemorySchemaVersion = 1
+
+// MemorySnapshot is the versioned export of a memory
+type MemorySnapshot struct {
+	Version int `json:"version"`
+	// Provider is the provider the conversation was held with, used to translate the messages to another provider
+	Provider Provider  `json:"provider,omitempty"`
+	Messages []Message `json:"messages,omitempty"`
+}
+
+// Snapshot exports the messages of the memory
+func (m *Memory) Snapshot(provider Provider) *MemorySnapshot {
+	return &MemorySnapshot{
+		Version:  MemorySchemaVersion,
+		Provider: provider,
+		Messages: m.List(),
+	}
+}
+
+// Restore replaces the messages of the memory with the snapshot
+func (m *Memory) Restore(s *MemorySnapshot) {
+	m.Set(s.Messages)
+}
+
+// WriteJSON writes the snapshot as a single JSON document
+func (s *MemorySnapshot) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// WriteJSONL writes the version header as the first line followed by one message per line
+func (s *MemorySnapshot) WriteJSONL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(MemorySnapshot{Version: s.Version, Provider: s.Provider}); err != nil {
+		return err
+	}
+	for _, v := range s.Messages {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadMemorySnapshot reads the snapshot written by either WriteJSON or WriteJSONL
+func ReadMemorySnapshot(r io.Reader) (*MemorySnapshot, error) {
+	dec := json.NewDecoder(r)
+	var s MemorySnapshot
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("decode memory snapshot: %w", err)
+	}
+	switch {
+	case s.Version == 0:
+		return nil, errors.New("memory snapshot without version")
+	case s.Version > MemorySchemaVersion:
+		return nil, fmt.Errorf("unsupported memory snapshot version %d", s.Version)
+	}
+	for {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decode memory message: %w", err)
+		}
+		s.Messages = append(s.Messages, msg)
+	}
+	return &s, nil
+}
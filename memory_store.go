@@ -0,0 +1,308 @@
+package instructor
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore persists the messages of the conversations keyed by the conversation ID
+type MemoryStore interface {
+	// Load returns the messages of the conversation, an unknown conversation has no messages
+	Load(ctx context.Context, conversationID string) ([]Message, error)
+	// Append adds the messages to the conversation
+	Append(ctx context.Context, conversationID string, list ...Message) error
+	// Replace replaces all the messages of the conversation
+	Replace(ctx context.Context, conversationID string, list []Message) error
+}
+
+// InMemoryStore keeps the conversations in process, it is safe for concurrent use
+type InMemoryStore struct {
+	mu            sync.RWMutex
+	conversations map[string][]Message
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		conversations: make(map[string][]Message),
+	}
+}
+
+func (s *InMemoryStore) Load(_ context.Context, conversationID string) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.conversations[conversationID]), nil
+}
+
+func (s *InMemoryStore) Append(_ context.Context, conversationID string, list ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversations[conversationID] = append(s.conversations[conversationID], list...)
+	return nil
+}
+
+func (s *InMemoryStore) Replace(_ context.Context, conversationID string, list []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversations[conversationID] = slices.Clone(list)
+	return nil
+}
+
+// JSONLStore keeps every conversation as a JSONL file in the directory, one message per line.
+// It is safe for concurrent use within the process.
+type JSONLStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewJSONLStore(dir string) (*JSONLStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &JSONLStore{dir: dir}, nil
+}
+
+func (s *JSONLStore) path(conversationID string) string {
+	return filepath.Join(s.dir, url.PathEscape(conversationID)+".jsonl")
+}
+
+func (s *JSONLStore) Load(_ context.Context, conversationID string) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path(conversationID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var list []Message
+	scanner := bufio.NewScanner(f)
+	// the messages could carry inline media
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, fmt.Errorf("decode message of conversation %s: %w", conversationID, err)
+		}
+		list = append(list, msg)
+	}
+	return list, scanner.Err()
+}
+
+func (s *JSONLStore) Append(_ context.Context, conversationID string, list ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(conversationID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONL(f, list); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Replace writes the messages to a temporary file which is renamed to the conversation file
+func (s *JSONLStore) Replace(_ context.Context, conversationID string, list []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.CreateTemp(s.dir, ".conversation-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := writeJSONL(f, list); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(conversationID))
+}
+
+func writeJSONL(f *os.File, list []Message) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, v := range list {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+const (
+	sqlAppendAttempts = 10
+	sqlAppendBackoff  = 10 * time.Millisecond
+)
+
+// SQLStore keeps the messages in a SQL table with the columns conversation_id, seq and message.
+// The SQLite databases should begin the transactions immediately, e.g. with _txlock=immediate,
+// as the busy deferred transactions are not retried
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder func(n int) string
+	conflict    func(err error) bool
+}
+
+// SQLStoreOption configures the SQLStore
+type SQLStoreOption func(s *SQLStore)
+
+// WithDollarPlaceholders uses the $1, $2 placeholders of PostgreSQL instead of ?
+func WithDollarPlaceholders() SQLStoreOption {
+	return func(s *SQLStore) {
+		s.placeholder = func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		}
+	}
+}
+
+// WithSQLConflict sets the check of the primary key violations of the driver, on which Append is retried.
+// By default the SQLSTATE 23505 and the messages of the unique constraint violations of SQLite, MySQL and PostgreSQL are checked
+func WithSQLConflict(fn func(err error) bool) SQLStoreOption {
+	return func(s *SQLStore) {
+		s.conflict = fn
+	}
+}
+
+// NewSQLStore creates the store on the table, which is created if not exists
+func NewSQLStore(ctx context.Context, db *sql.DB, table string, opts ...SQLStoreOption) (*SQLStore, error) {
+	s := &SQLStore{
+		db:    db,
+		table: table,
+		placeholder: func(int) string {
+			return "?"
+		},
+		conflict: isSQLConflict,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	conversation_id VARCHAR(255) NOT NULL,
+	seq INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	PRIMARY KEY (conversation_id, seq)
+)`, table)); err != nil {
+		return nil, fmt.Errorf("create memory table: %w", err)
+	}
+	return s, nil
+}
+
+func (s *SQLStore) Load(ctx context.Context, conversationID string) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT message FROM %s WHERE conversation_id = %s ORDER BY seq", s.table, s.placeholder(1)), conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Message
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			return nil, fmt.Errorf("decode message of conversation %s: %w", conversationID, err)
+		}
+		list = append(list, msg)
+	}
+	return list, rows.Err()
+}
+
+// Append allocates the sequence numbers after the last message of the conversation, the transaction is retried
+// if another writer of the conversation takes the same numbers meanwhile, the other errors are returned at once
+func (s *SQLStore) Append(ctx context.Context, conversationID string, list ...Message) error {
+	var err error
+	for attempt := range sqlAppendAttempts {
+		if attempt > 0 {
+			// the jitter keeps the conflicting writers from retrying in lockstep
+			if err := sleepContext(ctx, time.Duration(attempt)*sqlAppendBackoff+time.Duration(rand.Int64N(int64(sqlAppendBackoff)))); err != nil {
+				return err
+			}
+		}
+		if err = s.tx(ctx, func(tx *sql.Tx) error {
+			var seq int
+			if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(seq), 0) FROM %s WHERE conversation_id = %s", s.table, s.placeholder(1)), conversationID).Scan(&seq); err != nil {
+				return err
+			}
+			return s.insert(ctx, tx, conversationID, seq, list)
+		}); err == nil || ctx.Err() != nil || !s.conflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isSQLConflict reports whether the error is a violation of the primary key
+func isSQLConflict(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return state.SQLState() == "23505"
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unique constraint") || strings.Contains(msg, "duplicate key") || strings.Contains(msg, "duplicate entry")
+}
+
+func (s *SQLStore) Replace(ctx context.Context, conversationID string, list []Message) error {
+	return s.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE conversation_id = %s", s.table, s.placeholder(1)), conversationID); err != nil {
+			return err
+		}
+		return s.insert(ctx, tx, conversationID, 0, list)
+	})
+}
+
+func (s *SQLStore) insert(ctx context.Context, tx *sql.Tx, conversationID string, seq int, list []Message) error {
+	if len(list) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (conversation_id, seq, message) VALUES (%s)", s.table, strings.Join([]string{s.placeholder(1), s.placeholder(2), s.placeholder(3)}, ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, v := range list {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		seq++
+		if _, err := stmt.ExecContext(ctx, conversationID, seq, string(bs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
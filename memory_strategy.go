@@ -0,0 +1,165 @@
+package instructor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MemoryStrategy compacts the messages kept in the memory
+type MemoryStrategy interface {
+	Compact(ctx context.Context, list []Message) ([]Message, error)
+}
+
+type MemoryStrategyFunc func(ctx context.Context, list []Message) ([]Message, error)
+
+func (fn MemoryStrategyFunc) Compact(ctx context.Context, list []Message) ([]Message, error) {
+	return fn(ctx, list)
+}
+
+// TokenCounter counts the tokens of a message
+type TokenCounter func(msg *Message) int
+
+// EstimateTokens estimates the tokens of a message with DefaultTokenizer
+func EstimateTokens(msg *Message) int {
+	return CountMessageTokens(DefaultTokenizer, msg)
+}
+
+// WindowByCount keeps the last n messages, a negative n is treated as 0
+func WindowByCount(n int) MemoryStrategy {
+	n = max(n, 0)
+	return MemoryStrategyFunc(func(ctx context.Context, list []Message) ([]Message, error) {
+		if len(list) <= n {
+			return list, nil
+		}
+		return trimToolResults(list[len(list)-n:]), nil
+	})
+}
+
+// WindowByTokens keeps the last messages within the token budget, EstimateTokens is used if counter is nil
+func WindowByTokens(budget int, counter TokenCounter) MemoryStrategy {
+	if counter == nil {
+		counter = EstimateTokens
+	}
+	return MemoryStrategyFunc(func(ctx context.Context, list []Message) ([]Message, error) {
+		var total int
+		idx := len(list)
+		for idx > 0 {
+			total += counter(&list[idx-1])
+			if total > budget {
+				break
+			}
+			idx--
+		}
+		return trimToolResults(list[idx:]), nil
+	})
+}
+
+// KeepSystem pins the system messages, the strategy only compacts the other messages
+func KeepSystem(s MemoryStrategy) MemoryStrategy {
+	return MemoryStrategyFunc(func(ctx context.Context, list []Message) ([]Message, error) {
+		var system, others []Message
+		for _, v := range list {
+			if v.Role == SystemRole {
+				system = append(system, v)
+			} else {
+				others = append(others, v)
+			}
+		}
+		others, err := s.Compact(ctx, others)
+		if err != nil {
+			return nil, err
+		}
+		return append(system, others...), nil
+	})
+}
+
+// Summarizer summarizes the earlier messages of the conversation
+type Summarizer func(ctx context.Context, list []Message) (string, error)
+
+// SummarizeOlder replaces the older messages with their summary once the memory has more than trigger messages,
+// the last keep messages are kept as is, a negative keep is treated as 0
+func SummarizeOlder(fn Summarizer, trigger int, keep int) MemoryStrategy {
+	keep = max(keep, 0)
+	return MemoryStrategyFunc(func(ctx context.Context, list []Message) ([]Message, error) {
+		if len(list) <= trigger || len(list) <= keep {
+			return list, nil
+		}
+		recent := trimToolResults(list[len(list)-keep:])
+		older := list[:len(list)-len(recent)]
+		summary, err := fn(ctx, older)
+		if err != nil {
+			return nil, fmt.Errorf("summarize memory: %w", err)
+		}
+		ret := make([]Message, 0, len(recent)+1)
+		ret = append(ret, Message{
+			Role: UserRole,
+			Text: fmt.Sprintf("Summary of the earlier conversation:\n%s", summary),
+		})
+		return append(ret, recent...), nil
+	})
+}
+
+// ErrSummarizerEncoder is returned by the summarizer if its instructor already has an encoder of another response type
+var ErrSummarizerEncoder = errors.New("the summarizer instructor has the encoder of another response type, use a dedicated instructor")
+
+// NewChatSummarizer summarizes the messages with the instructor, newRequest builds the provider request from the prompt.
+// The instructor must be dedicated to the summarizer, as the instructors keep the encoder of their first response type,
+// and should not share the memory of the summarized conversation.
+func NewChatSummarizer[REQ any, RESP any](i ChatInstructor[REQ, RESP], newRequest func(prompt string) *REQ) Summarizer {
+	var (
+		mu  sync.Mutex
+		enc Encoder
+	)
+	return func(ctx context.Context, list []Message) (string, error) {
+		var ret struct {
+			Summary string `json:"summary" jsonschema:"description=concise summary of the conversation keeping the facts, decisions and open questions"`
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if cached := i.Encoder(); cached != nil && !sameEncoder(cached, enc) {
+			return "", ErrSummarizerEncoder
+		}
+		prompt := fmt.Sprintf("Summarize the following conversation:\n\n%s", Transcript(list))
+		if err := i.Chat(ctx, newRequest(prompt), &ret, new(RESP)); err != nil {
+			return "", err
+		}
+		if enc == nil {
+			enc = i.Encoder()
+		}
+		return ret.Summary, nil
+	}
+}
+
+func sameEncoder(a, b Encoder) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// Transcript renders the messages as plain text
+func Transcript(list []Message) string {
+	var sb strings.Builder
+	for _, v := range list {
+		if v.Text != "" {
+			fmt.Fprintf(&sb, "%s: %s\n", v.Role, v.Text)
+		}
+		for _, tool := range v.ToolUses {
+			fmt.Fprintf(&sb, "%s called %s(%s)\n", v.Role, tool.Name, tool.Arguments)
+		}
+		for _, tool := range v.ToolResults {
+			fmt.Fprintf(&sb, "tool %s returned: %s\n", tool.Name, tool.Content)
+		}
+	}
+	return sb.String()
+}
+
+// trimToolResults drops the leading tool results whose tool uses were dropped
+func trimToolResults(list []Message) []Message {
+	for len(list) > 0 && len(list[0].ToolResults) > 0 {
+		list = list[1:]
+	}
+	return list
+}
@@ -1,9 +1,17 @@
 package instructor
 
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
 const (
-	DefaultMaxRetries = 3
-	DefaultValidator  = false
-	DefaultVerbose    = false
+	DefaultMaxRetries        = 3
+	DefaultMaxToolIterations = 10
+	DefaultValidator         = false
+	DefaultVerbose           = false
 )
 
 type Option func(o *Options)
@@ -15,31 +23,49 @@ type ThinkingConfig struct {
 }
 
 type Options struct {
-	provider       Provider
-	mode           Mode
-	enc            Encoder
-	streamEnc      StreamEncoder
-	maxRetries     int
-	thinkingConfig *ThinkingConfig
-	mcpTools       []MCPTool
-	memory         *Memory
-	extraBody      map[string]any
-	schemaNamer    SchemaNamer
-	validate       bool
-	verbose        bool
+	provider        Provider
+	mode            Mode
+	encoders        *encoderCache
+	maxRetries      int
+	thinkingConfig  *ThinkingConfig
+	mcpTools        []MCPTool
+	mcpRegistry     *MCPRegistry
+	mcpResources    []MCPResource
+	mcpPrompts      []MCPPrompt
+	localTools      []*LocalTool
+	maxToolIters    int
+	toolTimeout     time.Duration
+	toolStepHandler ToolStepHandler
+	toolChoice      ToolChoice
+	forceExtraction bool
+	toolApprover    ToolApprover
+	streamApproval  bool
+	memory          *Memory
+	injectMemory    bool
+	mediaLoader     MediaLoader
+	documentConv    DocumentConverter
+	transcriber     Transcriber
+	tokenizer       Tokenizer
+	preflight       bool
+	extraBody       map[string]any
+	schemaNamer     SchemaNamer
+	validate        bool
+	verbose         bool
 	// Provider specific options:
 }
 
 var defaultOptions = Options{
-	mode:       ModeDefault,
-	maxRetries: DefaultMaxRetries,
-	validate:   DefaultValidator,
-	verbose:    DefaultVerbose,
+	mode:         ModeDefault,
+	maxRetries:   DefaultMaxRetries,
+	maxToolIters: DefaultMaxToolIterations,
+	validate:     DefaultValidator,
+	verbose:      DefaultVerbose,
 }
 
 func WithProvider(provider Provider) Option {
 	return func(o *Options) {
 		o.provider = provider
+		o.encoderCache()
 	}
 }
 
@@ -51,13 +77,13 @@ func WithMode(mode Mode) Option {
 
 func WithEncoder(enc Encoder) Option {
 	return func(o *Options) {
-		o.enc = enc
+		o.encoderCache().enc = enc
 	}
 }
 
 func WithStreamEncoder(enc StreamEncoder) Option {
 	return func(o *Options) {
-		o.streamEnc = enc
+		o.encoderCache().streamEnc = enc
 	}
 }
 
@@ -112,12 +138,123 @@ func WithMCPTools(tools ...MCPTool) Option {
 	}
 }
 
+// WithLocalTools exposes the Go functions to the model together with the MCP tools
+func WithLocalTools(tools ...*LocalTool) Option {
+	return func(o *Options) {
+		o.localTools = tools
+	}
+}
+
+// WithMaxToolIterations limits the round trips of the tool loop, ErrMaxToolIterations is returned if the model
+// keeps calling tools after that. The loop is always bounded, n <= 0 keeps DefaultMaxToolIterations
+func WithMaxToolIterations(n int) Option {
+	return func(o *Options) {
+		o.maxToolIters = n
+	}
+}
+
+// WithToolTimeout sets the timeout of every single tool call
+func WithToolTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.toolTimeout = d
+	}
+}
+
+// WithToolStepHandler sets the callback called after every step of the tool loop
+func WithToolStepHandler(fn ToolStepHandler) Option {
+	return func(o *Options) {
+		o.toolStepHandler = fn
+	}
+}
+
+// WithToolChoice sets whether the model could call the MCP and local tools, ToolChoiceNone hides them from the model.
+// ToolChoiceRequired only applies to the first step of the tool loop so the model could answer with the tool results.
+// ToolChoiceNone never prevents the model from calling the extraction tool of the tool call modes.
+// Cohere has no tool choice, the choices other than ToolChoiceNone are ignored.
+func WithToolChoice(v ToolChoice) Option {
+	return func(o *Options) {
+		o.toolChoice = v
+	}
+}
+
+// WithForcedExtraction forces the model to call the extraction tool in the tool call modes
+func WithForcedExtraction() Option {
+	return func(o *Options) {
+		o.forceExtraction = true
+	}
+}
+
+// WithToolApprover sets the approver consulted before every MCP or local tool call
+func WithToolApprover(fn ToolApprover) Option {
+	return func(o *Options) {
+		o.toolApprover = fn
+	}
+}
+
+// WithStreamToolApproval pauses the streams with a ToolApprovalStream before every MCP or local tool call
+// until PendingApproval.Resolve is called
+func WithStreamToolApproval() Option {
+	return func(o *Options) {
+		o.streamApproval = true
+	}
+}
+
+// WithMCPRegistry exposes the tools discovered by the registry together with the tools set by WithMCPTools
+func WithMCPRegistry(r *MCPRegistry) Option {
+	return func(o *Options) {
+		o.mcpRegistry = r
+	}
+}
+
 func WithMemory(v *Memory) Option {
 	return func(o *Options) {
 		o.memory = v
 	}
 }
 
+// WithMemoryInjection sends the compacted messages of the memory before the messages of every request
+func WithMemoryInjection() Option {
+	return func(o *Options) {
+		o.injectMemory = true
+	}
+}
+
+// WithMediaLoader sets the loader of the media links which the provider could not fetch itself
+func WithMediaLoader(l MediaLoader) Option {
+	return func(o *Options) {
+		o.mediaLoader = l
+	}
+}
+
+// WithDocumentConverter sets the converter of the documents the provider does not support natively, e.g. a PDF text extractor
+func WithDocumentConverter(fn DocumentConverter) Option {
+	return func(o *Options) {
+		o.documentConv = fn
+	}
+}
+
+// WithTranscriber sets the transcriber of the audios the provider does not accept
+func WithTranscriber(t Transcriber) Option {
+	return func(o *Options) {
+		o.transcriber = t
+	}
+}
+
+// WithTokenizer sets the tokenizer counting the tokens of the requests, TokenizerFor the model is used by default
+func WithTokenizer(t Tokenizer) Option {
+	return func(o *Options) {
+		o.tokenizer = t
+	}
+}
+
+// WithContextPreflight counts the tokens of every request before sending it and returns a ContextTooLargeError
+// if the messages and the max output tokens do not fit in the context window of the model
+func WithContextPreflight() Option {
+	return func(o *Options) {
+		o.preflight = true
+	}
+}
+
 func WithValidation() Option {
 	return func(o *Options) {
 		o.validate = true
@@ -138,20 +275,53 @@ func (i Options) Mode() Mode {
 	return i.mode
 }
 
+// encoderCache keeps the encoders, which are set on the first call and may be read by the concurrent calls.
+// It is shared by the copies of the options made by the value receivers
+type encoderCache struct {
+	mu        sync.RWMutex
+	enc       Encoder
+	streamEnc StreamEncoder
+}
+
+// encoderCache returns the cache of the encoders, which is created by the options of the constructors,
+// e.g. WithProvider, before the options are shared
+func (i *Options) encoderCache() *encoderCache {
+	if i.encoders == nil {
+		i.encoders = new(encoderCache)
+	}
+	return i.encoders
+}
+
 func (i *Options) SetEncoder(enc Encoder) {
-	i.enc = enc
+	c := i.encoderCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enc = enc
 }
 
 func (i *Options) SetStreamEncoder(enc StreamEncoder) {
-	i.streamEnc = enc
+	c := i.encoderCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streamEnc = enc
 }
 
 func (i Options) Encoder() Encoder {
-	return i.enc
+	if i.encoders == nil {
+		return nil
+	}
+	i.encoders.mu.RLock()
+	defer i.encoders.mu.RUnlock()
+	return i.encoders.enc
 }
 
 func (i Options) StreamEncoder() StreamEncoder {
-	return i.streamEnc
+	if i.encoders == nil {
+		return nil
+	}
+	i.encoders.mu.RLock()
+	defer i.encoders.mu.RUnlock()
+	return i.encoders.streamEnc
 }
 
 func (i Options) ThinkingConfig() *ThinkingConfig {
@@ -163,13 +333,73 @@ func (i Options) ExtraBody() map[string]any {
 }
 
 func (i Options) MCPTools() []MCPTool {
-	return i.mcpTools
+	if i.mcpRegistry == nil {
+		return i.mcpTools
+	}
+	tools := i.mcpRegistry.Tools()
+	if len(i.mcpTools) == 0 {
+		return tools
+	}
+	return append(slices.Clone(i.mcpTools), tools...)
+}
+
+// Tools returns the MCP tools followed by the local tools
+func (i Options) Tools() []Tool {
+	mcpTools := i.MCPTools()
+	ret := make([]Tool, 0, len(mcpTools)+len(i.localTools))
+	for _, v := range mcpTools {
+		ret = append(ret, v)
+	}
+	for _, v := range i.localTools {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// MaxToolIterations returns the max round trips of the tool loop, DefaultMaxToolIterations if not set
+func (i Options) MaxToolIterations() int {
+	if i.maxToolIters <= 0 {
+		return DefaultMaxToolIterations
+	}
+	return i.maxToolIters
+}
+
+func (i Options) ToolTimeout() time.Duration {
+	return i.toolTimeout
 }
 
 func (i Options) Memory() *Memory {
 	return i.memory
 }
 
+// MemoryMessages returns the compacted messages of the memory to inject into the request,
+// nil if WithMemoryInjection is not set
+func (i Options) MemoryMessages(ctx context.Context) ([]Message, error) {
+	if !i.injectMemory || i.memory == nil {
+		return nil, nil
+	}
+	return i.memory.Messages(ctx)
+}
+
+func (i Options) MediaLoader() MediaLoader {
+	if i.mediaLoader == nil {
+		return DefaultMediaLoader
+	}
+	return i.mediaLoader
+}
+
+// Tokenizer returns the tokenizer set by WithTokenizer, or the tokenizer registered for the model
+func (i Options) Tokenizer(model string) Tokenizer {
+	if i.tokenizer != nil {
+		return i.tokenizer
+	}
+	return TokenizerFor(model)
+}
+
+func (i Options) ContextPreflight() bool {
+	return i.preflight
+}
+
 func (i Options) SchemaNamer() SchemaNamer {
 	return i.schemaNamer
 }
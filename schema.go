@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
   "fmt"
+	"regexp"
 	// "strconv"
 	"strings"
 	"sync"
@@ -12,6 +13,9 @@ import (
 	"github.com/invopop/jsonschema"
 )
 
+// genericQualifier matches the package path qualifiers reflect puts into the type arguments of generic types
+var genericQualifier = regexp.MustCompile(`[A-Za-z0-9_./~-]+\.`)
+
 var reflectorPool = sync.Pool{
 	New: func() any {
 		return &jsonschema.Reflector{
@@ -114,7 +118,7 @@ func JSONSchema(t reflect.Type, doNotReference bool, namer SchemaNamer) *jsonsch
       if t.Kind() == reflect.Pointer {
         t = t.Elem()
       }
-			name := t.Name()
+			name := TypeName(t)
 			// if t.Kind() == reflect.Struct {
 			// 	v := reflect.New(t)
 			// 	vt := v.Elem().Type()
@@ -129,3 +133,57 @@ func JSONSchema(t reflect.Type, doNotReference bool, namer SchemaNamer) *jsonsch
   ret.Ref = fmt.Sprintf("#/$defs/%s", r.Namer(t))
   return ret
 }
+
+// TypeName returns a schema friendly name of the type.
+// Generic instantiations like `Maybe[github.com/foo/bar.Person]` are flattened to `MaybePerson`
+// so they can be used as $defs keys and function names.
+func TypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if name == "" {
+		if itemType, ok := ListItemType(t); ok {
+			return TypeName(itemType) + "List"
+		}
+		return name
+	}
+	if !strings.ContainsRune(name, '[') {
+		return name
+	}
+	name = genericQualifier.ReplaceAllString(name, "")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '[', ']', ',', '*', ' ':
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// ListWrapperType returns the `{"items": [...]}` struct type used to extract a list of t,
+// since root level arrays are rejected by strict schemas and can not be represented in TOML
+func ListWrapperType(t reflect.Type) reflect.Type {
+	return reflect.StructOf([]reflect.StructField{
+		{
+			Name:      "Items",
+			Type:      reflect.SliceOf(t),
+			Tag:       `json:"items" yaml:"items" toml:"items" validate:"dive"`,
+			Anonymous: false,
+		},
+	})
+}
+
+// ListItemType returns the item type if t is a type created by ListWrapperType
+func ListItemType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.Name() != "" || t.NumField() != 1 {
+		return nil, false
+	}
+	if field := t.Field(0); field.Name == "Items" && field.Type.Kind() == reflect.Slice {
+		return field.Type.Elem(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,78 @@
+package instructor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrSessionMemory is returned by Session.Send if the session memory is the memory of the instructor,
+// which would record every turn twice
+var ErrSessionMemory = errors.New("the session memory must not be the memory of the instructor")
+
+// RequestBuilder builds the provider request from the messages of the conversation, the last message is the new turn
+type RequestBuilder[REQ any] func(ctx context.Context, list []Message) (*REQ, error)
+
+// Session is a multi-turn conversation whose memory is replayed into every request.
+// The turns are recorded in the session memory only if the chat succeeded, the instructor should not be
+// created WithMemoryInjection as the history is already part of the request.
+type Session[REQ any, RESP any] struct {
+	mu     sync.Mutex
+	inst   ChatInstructor[REQ, RESP]
+	memory *Memory
+	build  RequestBuilder[REQ]
+}
+
+// NewSession creates the session on the memory, a new memory is created if memory is nil.
+// The memory must not be the memory of the instructor, which records the turns of the chats itself
+func NewSession[REQ any, RESP any](i ChatInstructor[REQ, RESP], memory *Memory, build RequestBuilder[REQ]) *Session[REQ, RESP] {
+	if memory == nil {
+		memory = NewMemory(0)
+	}
+	return &Session[REQ, RESP]{
+		inst:   i,
+		memory: memory,
+		build:  build,
+	}
+}
+
+func (s *Session[REQ, RESP]) Memory() *Memory {
+	return s.memory
+}
+
+// Send sends the message after the replayed conversation and extracts the reply into responseType,
+// the structured reply is recorded as the assistant turn. The turns of a session are serialized.
+func (s *Session[REQ, RESP]) Send(ctx context.Context, msg Message, responseType any) (*RESP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.memory == s.inst.Memory() {
+		return nil, ErrSessionMemory
+	}
+	if msg.Role == "" {
+		msg.Role = UserRole
+	}
+	history, err := s.memory.Messages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s.build(ctx, append(history, msg))
+	if err != nil {
+		return nil, err
+	}
+	resp := new(RESP)
+	if err := s.inst.Chat(ctx, req, responseType, resp); err != nil {
+		return resp, err
+	}
+	bs, err := json.Marshal(responseType)
+	if err != nil {
+		return resp, err
+	}
+	s.memory.Add(msg, Message{Role: AssistantRole, Text: string(bs)})
+	return resp, nil
+}
+
+// SendText sends the text as the user message
+func (s *Session[REQ, RESP]) SendText(ctx context.Context, text string, responseType any) (*RESP, error) {
+	return s.Send(ctx, Message{Role: UserRole, Text: text}, responseType)
+}
@@ -0,0 +1,389 @@
+package instructor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrContextTooLarge is returned before sending a request which does not fit in the context window of the model
+var ErrContextTooLarge = errors.New("context too large")
+
+// ContextTooLargeError reports the token counts of a request exceeding the context window, it matches ErrContextTooLarge
+type ContextTooLargeError struct {
+	Model string
+	// Tokens is the estimated tokens of the messages
+	Tokens int
+	// Reserved is the tokens reserved for the output
+	Reserved int
+	// Limit is the context window of the model
+	Limit int
+}
+
+func (e *ContextTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d prompt tokens + %d output tokens exceed the %d tokens context window of %s", ErrContextTooLarge, e.Tokens, e.Reserved, e.Limit, e.Model)
+}
+
+func (e *ContextTooLargeError) Is(target error) bool {
+	return target == ErrContextTooLarge
+}
+
+// Tokenizer counts the tokens of a text
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// TokenizerFunc is a function implementing Tokenizer
+type TokenizerFunc func(text string) int
+
+func (fn TokenizerFunc) Count(text string) int {
+	return fn(text)
+}
+
+// DefaultTokenizer is used for the models without a registered tokenizer, which are all the models by default
+var DefaultTokenizer Tokenizer = TokenizerFunc(HeuristicTokens)
+
+// HeuristicTokens estimates the tokens of a text without a vocabulary, the runs of ASCII letters and digits
+// are counted as 4 characters per token, the punctuations and the other characters (e.g. CJK) as 1 token each
+func HeuristicTokens(text string) int {
+	var n, run int
+	flush := func() {
+		n += (run + 3) / 4
+		run = 0
+	}
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			run++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			n++
+		}
+	}
+	flush()
+	return n
+}
+
+// messageOverheadTokens is the tokens of the role and the separators of a message
+const messageOverheadTokens = 4
+
+// mediaTokens is the fixed cost of a media as the size of the media is unknown
+const mediaTokens = 256
+
+// CountMessageTokens counts the tokens of the message with the tokenizer, the media are counted as a fixed cost
+func CountMessageTokens(t Tokenizer, msg *Message) int {
+	n := t.Count(msg.Text) + t.Count(msg.Thinking)
+	for _, v := range msg.ToolUses {
+		n += t.Count(v.Name) + t.Count(v.Arguments)
+	}
+	for _, v := range msg.ToolResults {
+		n += t.Count(v.Content)
+	}
+	return n + messageOverheadTokens + mediaTokens*(len(msg.Images)+len(msg.Audios)+len(msg.Files)+len(msg.Videos))
+}
+
+// MessageCounter returns the TokenCounter of the tokenizer, to be used with WindowByTokens
+func MessageCounter(t Tokenizer) TokenCounter {
+	return func(msg *Message) int {
+		return CountMessageTokens(t, msg)
+	}
+}
+
+// CountMessagesTokens counts the tokens of the messages
+func CountMessagesTokens(t Tokenizer, list []Message) int {
+	var n int
+	for idx := range list {
+		n += CountMessageTokens(t, &list[idx])
+	}
+	return n
+}
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+// RegisterTokenizer registers the tokenizer of the models starting with the prefix,
+// e.g. a BPETokenizer loaded from o200k_base.tiktoken for "gpt-4o"
+func RegisterTokenizer(prefix string, t Tokenizer) {
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[prefix] = t
+}
+
+// TokenizerFor returns the tokenizer registered with the longest prefix of the model, DefaultTokenizer otherwise.
+// No vocabulary is bundled, so the OpenAI models are counted by HeuristicTokens too unless the tiktoken ranks
+// are loaded with LoadBPETokenizerFile and registered with RegisterTokenizer
+func TokenizerFor(model string) Tokenizer {
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	if t, ok := lookupPrefix(tokenizers, model); ok {
+		return t
+	}
+	return DefaultTokenizer
+}
+
+var (
+	contextWindowsMu sync.RWMutex
+	// contextWindows are the context windows of the known models by model prefix
+	contextWindows = map[string]int{
+		"gpt-3.5-turbo":        16385,
+		"gpt-4":                8192,
+		"gpt-4-32k":            32768,
+		"gpt-4-0125-preview":   128000,
+		"gpt-4-1106-preview":   128000,
+		"gpt-4-vision-preview": 128000,
+		"gpt-4-turbo":          128000,
+		"gpt-4o":               128000,
+		"gpt-4.1":              1047576,
+		"gpt-4.5":              128000,
+		"gpt-5":                400000,
+		"o1":                   200000,
+		"o1-mini":              128000,
+		"o3":                   200000,
+		"o3-mini":              200000,
+		"o4-mini":              200000,
+		"claude-2":             100000,
+		"claude-3":             200000,
+		"claude-sonnet-4":      200000,
+		"claude-opus-4":        200000,
+		"claude-haiku-4":       200000,
+		"gemini-1.5-flash":     1048576,
+		"gemini-1.5-pro":       2097152,
+		"gemini-2.0-flash":     1048576,
+		"gemini-2.5-flash":     1048576,
+		"gemini-2.5-pro":       1048576,
+		"command-r":            128000,
+		"command-r-plus":       128000,
+		"command-r7b":          128000,
+		"command-a":            256000,
+		"command-light":        4096,
+		"command":              4096,
+	}
+)
+
+// RegisterContextWindow sets the context window in tokens of the models starting with the prefix
+func RegisterContextWindow(prefix string, tokens int) {
+	contextWindowsMu.Lock()
+	defer contextWindowsMu.Unlock()
+	contextWindows[prefix] = tokens
+}
+
+// ContextWindow returns the context window in tokens of the model by the longest registered prefix
+func ContextWindow(model string) (int, bool) {
+	contextWindowsMu.RLock()
+	defer contextWindowsMu.RUnlock()
+	return lookupPrefix(contextWindows, model)
+}
+
+func lookupPrefix[T any](m map[string]T, model string) (T, bool) {
+	model = strings.TrimPrefix(model, "models/")
+	var (
+		ret     T
+		matched = -1
+	)
+	for prefix, v := range m {
+		if len(prefix) > matched && strings.HasPrefix(model, prefix) {
+			ret, matched = v, len(prefix)
+		}
+	}
+	return ret, matched >= 0
+}
+
+// CheckContext returns a ContextTooLargeError if the messages and the reserved output tokens
+// do not fit in the context window of the model, the models without a known context window are not checked
+func CheckContext(t Tokenizer, model string, list []Message, reserved int) error {
+	limit, ok := ContextWindow(model)
+	if !ok {
+		return nil
+	}
+	if t == nil {
+		t = TokenizerFor(model)
+	}
+	if tokens := CountMessagesTokens(t, list); tokens+reserved > limit {
+		return &ContextTooLargeError{
+			Model:    model,
+			Tokens:   tokens,
+			Reserved: reserved,
+			Limit:    limit,
+		}
+	}
+	return nil
+}
+
+// BPETokenizer is a byte pair encoding tokenizer compatible with the tiktoken encodings of OpenAI,
+// the text is split with the pre-tokenization of cl100k_base before merging the bytes by rank,
+// so the counts of o200k_base are close but not exact
+type BPETokenizer struct {
+	ranks map[string]int
+}
+
+// NewBPETokenizer creates the tokenizer from the ranks of the byte sequences
+func NewBPETokenizer(ranks map[string]int) *BPETokenizer {
+	return &BPETokenizer{ranks: ranks}
+}
+
+// LoadBPETokenizer loads a tiktoken encoding file, e.g. cl100k_base.tiktoken, which lists a base64 encoded token and its rank per line
+func LoadBPETokenizer(r io.Reader) (*BPETokenizer, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid tiktoken line %d", line)
+		}
+		bs, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken line %d: %w", line, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken line %d: %w", line, err)
+		}
+		ranks[string(bs)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewBPETokenizer(ranks), nil
+}
+
+// LoadBPETokenizerFile loads a tiktoken encoding file from the path
+func LoadBPETokenizerFile(path string) (*BPETokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadBPETokenizer(f)
+}
+
+// Encode returns the token ids of the text, the bytes missing in the ranks are skipped
+func (t *BPETokenizer) Encode(text string) []int {
+	var ret []int
+	for _, piece := range splitPieces(text) {
+		if rank, ok := t.ranks[piece]; ok {
+			ret = append(ret, rank)
+			continue
+		}
+		for _, part := range t.merge(piece) {
+			if rank, ok := t.ranks[part]; ok {
+				ret = append(ret, rank)
+			}
+		}
+	}
+	return ret
+}
+
+func (t *BPETokenizer) Count(text string) int {
+	var n int
+	for _, piece := range splitPieces(text) {
+		if _, ok := t.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += len(t.merge(piece))
+	}
+	return n
+}
+
+// merge merges the adjacent bytes of the piece with the lowest rank until no pair is in the ranks
+func (t *BPETokenizer) merge(piece string) []string {
+	parts := make([]string, len(piece))
+	for idx := range len(piece) {
+		parts[idx] = piece[idx : idx+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for idx := range len(parts) - 1 {
+			if rank, ok := t.ranks[parts[idx]+parts[idx+1]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = idx, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// splitPieces splits the text as the cl100k_base pattern of tiktoken:
+// 's|'t|'re|'ve|'m|'ll|'d, [^\r\n\p{L}\p{N}]?\p{L}+, \p{N}{1,3}, ' ?[^\s\p{L}\p{N}]+[\r\n]*', \s*[\r\n]+, \s+(?!\S) and \s+
+func splitPieces(text string) []string {
+	var (
+		runes = []rune(text)
+		n     = len(runes)
+		ret   []string
+	)
+	isNewline := func(r rune) bool { return r == '\r' || r == '\n' }
+	isPunct := func(r rune) bool { return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r) }
+	for i := 0; i < n; {
+		r := runes[i]
+		j := i + 1
+		switch {
+		case r == '\'' && contractionLen(runes[i+1:]) > 0:
+			j = i + 1 + contractionLen(runes[i+1:])
+		case unicode.IsLetter(r) || (!isNewline(r) && !unicode.IsNumber(r) && j < n && unicode.IsLetter(runes[j])):
+			for j < n && unicode.IsLetter(runes[j]) {
+				j++
+			}
+		case unicode.IsNumber(r):
+			for j < n && j-i < 3 && unicode.IsNumber(runes[j]) {
+				j++
+			}
+		case isPunct(r) || (r == ' ' && j < n && isPunct(runes[j])):
+			for j < n && isPunct(runes[j]) {
+				j++
+			}
+			for j < n && isNewline(runes[j]) {
+				j++
+			}
+		default:
+			for j < n && unicode.IsSpace(runes[j]) {
+				j++
+			}
+			lastNewline := -1
+			for k := i; k < j; k++ {
+				if isNewline(runes[k]) {
+					lastNewline = k
+				}
+			}
+			if lastNewline >= 0 {
+				j = lastNewline + 1
+			} else if j < n && j-i > 1 {
+				// leave the last space to the next word
+				j--
+			}
+		}
+		ret = append(ret, string(runes[i:j]))
+		i = j
+	}
+	return ret
+}
+
+func contractionLen(runes []rune) int {
+	for _, suffix := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+		if len(runes) < len(suffix) {
+			continue
+		}
+		if strings.EqualFold(string(runes[:len(suffix)]), suffix) {
+			return len(suffix)
+		}
+	}
+	return 0
+}
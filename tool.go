@@ -1,17 +1,201 @@
 package instructor
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
 	mcpClient "github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// ErrMaxToolIterations is returned when the model still calls tools after the max tool iterations
+var ErrMaxToolIterations = errors.New("hit max tool iterations")
+
 type ToolCall struct {
 	Request *mcp.CallToolRequest `json:"request,omitempty"`
 	Result  *mcp.CallToolResult  `json:"result,omitempty"`
 }
 
+// Tool is a tool called by the instructor in the tool loop, either a MCPTool or a LocalTool
+type Tool interface {
+	// Name returns the function name of the tool exposed to the model
+	Name() string
+	// Definition returns the description and the input schema of the tool sent to the model
+	Definition() *mcp.Tool
+	Call(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error)
+}
+
 type MCPTool struct {
 	Client     mcpClient.MCPClient
 	ServerName string
 	Tool       *mcp.Tool
+	// Alias overrides the function name exposed to the model
+	Alias string
+}
+
+// Name returns the function name of the tool exposed to the model
+func (t MCPTool) Name() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return fmt.Sprintf("%s_%s", t.ServerName, t.Tool.GetName())
+}
+
+func (t MCPTool) Definition() *mcp.Tool {
+	return t.Tool
+}
+
+// Call calls the tool of the MCP server with the original tool name
+func (t MCPTool) Call(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	req.Params.Name = t.Tool.GetName()
+	return t.Client.CallTool(ctx, req)
+}
+
+// ToolChoice controls whether the model calls tools, the provider default is used if empty
+type ToolChoice string
+
+const (
+	ToolChoiceAuto     ToolChoice = "auto"
+	ToolChoiceNone     ToolChoice = "none"
+	ToolChoiceRequired ToolChoice = "required"
+)
+
+// ToolStep is one iteration of the tool loop, Calls keeps the order of the tool calls returned by the model
+type ToolStep struct {
+	Iteration int
+	Calls     []ToolCall
+}
+
+// ToolStepHandler is called after the tool calls of a step were executed
+type ToolStepHandler func(ctx context.Context, step *ToolStep)
+
+// NewToolCall creates a tool call request for the function name and arguments returned by the model,
+// the arguments could be either decoded or raw JSON
+func NewToolCall(name string, args any) ToolCall {
+	req := new(mcp.CallToolRequest)
+	req.Params.Name = name
+	var ret ToolCall
+	switch v := args.(type) {
+	case string:
+		args = json.RawMessage(v)
+	case []byte:
+		args = json.RawMessage(v)
+	}
+	if raw, ok := args.(json.RawMessage); ok {
+		var kv map[string]any
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &kv); err != nil {
+				ret.Result = mcp.NewToolResultError(fmt.Sprintf("error parsing tool arguments: %v", err))
+			}
+		}
+		args = kv
+	}
+	req.Params.Arguments = args
+	ret.Request = req
+	return ret
+}
+
+// LookupMCPTool finds the MCP tool by the function name exposed to the model
+func (i Options) LookupMCPTool(name string) (MCPTool, bool) {
+	for _, v := range i.MCPTools() {
+		if v.Name() == name {
+			return v, true
+		}
+	}
+	return MCPTool{}, false
+}
+
+// LookupTool finds the MCP or local tool by the function name exposed to the model
+func (i Options) LookupTool(name string) (Tool, bool) {
+	for _, v := range i.Tools() {
+		if v.Name() == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// ToolChoiceOf returns the tool choice of the step of the tool loop and the name of the tool to force if any.
+// extractionTool is the name of the extraction tool in the tool call modes, empty otherwise.
+// ToolChoiceNone only applies to the MCP and local tools, the extraction tool is left to the provider default
+// since the model answers with it, the extraction tool is only forced by WithForcedExtraction.
+func (i Options) ToolChoiceOf(iteration int, extractionTool string) (ToolChoice, string) {
+	if extractionTool != "" {
+		if i.forceExtraction {
+			return ToolChoiceRequired, extractionTool
+		}
+		if i.toolChoice == ToolChoiceNone {
+			return "", ""
+		}
+	}
+	if i.toolChoice == ToolChoiceRequired && iteration > 1 {
+		return ToolChoiceAuto, ""
+	}
+	return i.toolChoice, ""
+}
+
+// CallTools executes the tool calls of a step in parallel, the results are set in place.
+// The calls are approved one by one before, if a ToolApprover is set.
+// Calls which already have a result, e.g. failed to parse the arguments or denied, are skipped.
+func (i Options) CallTools(ctx context.Context, iteration int, calls []ToolCall) {
+	for idx := range calls {
+		if calls[idx].Result == nil {
+			i.approve(ctx, &calls[idx])
+		}
+	}
+	var wg sync.WaitGroup
+	for idx := range calls {
+		call := &calls[idx]
+		if call.Result != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.callTool(ctx, call)
+		}()
+	}
+	wg.Wait()
+	if i.verbose {
+		bs, _ := json.MarshalIndent(calls, "", "  ")
+		log.Printf("%s ToolCall Result(iteration:%d): %s\n", i.provider, iteration, string(bs))
+	}
+	if i.toolStepHandler != nil {
+		i.toolStepHandler(ctx, &ToolStep{Iteration: iteration, Calls: calls})
+	}
+}
+
+func (i Options) callTool(ctx context.Context, call *ToolCall) {
+	tool, ok := i.LookupTool(call.Request.Params.Name)
+	if !ok {
+		call.Result = mcp.NewToolResultError("invalid tool name")
+		return
+	}
+	if i.toolTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.toolTimeout)
+		defer cancel()
+	}
+	req := *call.Request
+	req.Params.Name = tool.Definition().GetName()
+	call.Request = &req
+	result, err := tool.Call(ctx, req)
+	if err != nil {
+		call.Result = mcp.NewToolResultError(fmt.Sprintf("tool call error: %v", err))
+		return
+	}
+	call.Result = result
+}
+
+// ToolResultContent returns the JSON encoded result of the tool call sent back to the model
+func (c ToolCall) ToolResultContent() string {
+	if c.Result == nil {
+		return ""
+	}
+	bs, _ := json.Marshal(c.Result)
+	return string(bs)
 }
@@ -0,0 +1,171 @@
+package instructor
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// mediaSupport is the media a provider accepts in the messages
+type mediaSupport struct {
+	images bool
+	audios bool
+	files  bool
+	videos bool
+}
+
+var providerMedia = map[Provider]mediaSupport{
+	ProviderOpenAI:    {images: true, audios: true, files: true, videos: true},
+	ProviderAnthropic: {images: true, files: true},
+	ProviderCohere:    {},
+	ProviderGemini:    {images: true, audios: true, files: true, videos: true},
+}
+
+var toolIDPrefix = map[Provider]string{
+	ProviderOpenAI:    "call_",
+	ProviderAnthropic: "toolu_",
+}
+
+// Translate rewrites the messages of a conversation held with the from provider so it could be continued on the to provider.
+// The tool call IDs are regenerated and the tool results are paired with their tool uses, the thinking is only kept for the same provider
+// as it is signed by the provider, and the media the to provider does not support are replaced with text notes.
+func Translate(list []Message, from Provider, to Provider) []Message {
+	ret := make([]Message, 0, len(list))
+	if from == to {
+		return append(ret, list...)
+	}
+	media, ok := providerMedia[to]
+	if !ok {
+		media = mediaSupport{images: true, audios: true, files: true, videos: true}
+	}
+	prefix, ok := toolIDPrefix[to]
+	if !ok {
+		prefix = "call_"
+	}
+	var (
+		seq     int
+		ids     = make(map[string]string)
+		pending []ToolUse
+	)
+	for _, v := range list {
+		v.Thinking = ""
+		v.ThinkingSignature = ""
+		v.ResponseID = ""
+		if len(v.ToolUses) > 0 {
+			v.ToolUses = slices.Clone(v.ToolUses)
+			for idx := range v.ToolUses {
+				use := &v.ToolUses[idx]
+				seq++
+				id := fmt.Sprintf("%s%d", prefix, seq)
+				if use.ID != "" {
+					ids[use.ID] = id
+				}
+				use.ID = id
+				pending = append(pending, *use)
+			}
+		}
+		if len(v.ToolResults) > 0 {
+			v.ToolResults = slices.Clone(v.ToolResults)
+			for idx := range v.ToolResults {
+				result := &v.ToolResults[idx]
+				var use ToolUse
+				use, pending = pairToolUse(pending, ids[result.ID], result.Name)
+				if use.ID != "" {
+					result.ID = use.ID
+				}
+				if result.Name == "" {
+					result.Name = use.Name
+				}
+				if to == ProviderGemini || to == ProviderCohere {
+					result.Content = jsonObject(result.Content)
+				}
+			}
+		}
+		translateMedia(&v, media)
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// Translate returns the snapshot with the messages translated to the provider
+func (s *MemorySnapshot) Translate(to Provider) *MemorySnapshot {
+	return &MemorySnapshot{
+		Version:  s.Version,
+		Provider: to,
+		Messages: Translate(s.Messages, s.Provider, to),
+	}
+}
+
+// pairToolUse finds the pending tool use of the result by the translated ID, falling back to the first pending use of the same name
+func pairToolUse(pending []ToolUse, id string, name string) (ToolUse, []ToolUse) {
+	idx := slices.IndexFunc(pending, func(v ToolUse) bool {
+		return id != "" && v.ID == id
+	})
+	if idx < 0 {
+		idx = slices.IndexFunc(pending, func(v ToolUse) bool {
+			return name == "" || v.Name == name
+		})
+	}
+	if idx < 0 {
+		return ToolUse{}, pending
+	}
+	use := pending[idx]
+	return use, slices.Delete(pending, idx, idx+1)
+}
+
+// jsonObject wraps the tool result as a JSON object for the providers which only accept objects
+func jsonObject(content string) string {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(content), &obj); err == nil {
+		return content
+	}
+	bs, _ := json.Marshal(map[string]string{"result": content})
+	return string(bs)
+}
+
+func translateMedia(msg *Message, media mediaSupport) {
+	var notes []string
+	if !media.images {
+		for _, v := range msg.Images {
+			notes = append(notes, mediaNote("image", v.URL))
+		}
+		msg.Images = nil
+	}
+	if !media.videos {
+		for _, v := range msg.Videos {
+			notes = append(notes, mediaNote("video", v.URL))
+		}
+		msg.Videos = nil
+	}
+	if !media.files {
+		for _, v := range msg.Files {
+			notes = append(notes, mediaNote("file", v.Name))
+		}
+		msg.Files = nil
+	}
+	// the audio replied by the assistant is only referenced by ID
+	audios := msg.Audios[:0:0]
+	for _, v := range msg.Audios {
+		if media.audios && v.Data != "" {
+			audios = append(audios, v)
+			continue
+		}
+		notes = append(notes, mediaNote("audio", ""))
+	}
+	msg.Audios = audios
+	if len(notes) == 0 {
+		return
+	}
+	if msg.Text != "" {
+		notes = append(notes, msg.Text)
+	}
+	msg.Text = strings.Join(notes, "\n")
+}
+
+func mediaNote(kind string, name string) string {
+	if name == "" || strings.HasPrefix(name, "data:") {
+		return fmt.Sprintf("[%s omitted]", kind)
+	}
+	return fmt.Sprintf("[%s omitted: %s]", kind, name)
+}
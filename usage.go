@@ -5,3 +5,18 @@ type UsageSum struct {
 	OutputTokens int64
 	TotalTokens  int64
 }
+
+func (u *UsageSum) Add(v UsageSum) {
+	u.InputTokens += v.InputTokens
+	u.OutputTokens += v.OutputTokens
+	u.TotalTokens += v.TotalTokens
+}
+
+// ResponseMeta is the final metadata of a streamed response, usage is summed up over every round trip of the tool loop
+type ResponseMeta struct {
+	ID           string   `json:"id,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	FinishReason string   `json:"finish_reason,omitempty"`
+	StopSequence string   `json:"stop_sequence,omitempty"`
+	Usage        UsageSum `json:"usage"`
+}